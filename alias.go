@@ -1,12 +1,16 @@
 package dinghy
 
 import (
+	"github.com/johnhoman/dinghy/internal/build"
 	"github.com/johnhoman/dinghy/internal/fieldpath"
 	"github.com/johnhoman/dinghy/internal/generate"
+	"github.com/johnhoman/dinghy/internal/logging"
 	"github.com/johnhoman/dinghy/internal/mutate"
 	"github.com/johnhoman/dinghy/internal/path"
 	"github.com/johnhoman/dinghy/internal/resource"
 	"github.com/johnhoman/dinghy/internal/scheme"
+	"github.com/johnhoman/dinghy/internal/types"
+	"github.com/johnhoman/dinghy/internal/validate"
 	"github.com/johnhoman/dinghy/internal/visitor"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -22,17 +26,86 @@ type (
 	VisitorFunc = visitor.Func
 	Tree        = resource.Tree
 	Key         = resource.Key
+	Object      = resource.Object
+	Origin      = resource.Origin
+	MatchOption = resource.MatchOption
+	Selector    = resource.Selector
+	SortOrder   = resource.SortOrder
 
 	FieldPath = fieldpath.FieldPath
+
+	Config           = types.Config
+	Module           = types.Module
+	PluginSpec       = types.PluginSpec
+	GeneratorSpec    = types.GeneratorSpec
+	MutationSpec     = types.MutationSpec
+	ValidationSpec   = types.ValidationSpec
+	ResourceSelector = types.ResourceSelector
+
+	Registry  = build.Registry
+	Mutator   = mutate.Mutator
+	Generator = generate.Generator
+	Validator = validate.Validator
+
+	Logger = logging.Logger
+)
+
+// OriginAnnotation is the annotation added by WithOriginAnnotations
+const OriginAnnotation = resource.OriginAnnotation
+
+// The orders a Result returns resources in, set with WithSortOrder
+const (
+	SortLegacy = resource.SortLegacy
+	SortNone   = resource.SortNone
+	SortFIFO   = resource.SortFIFO
 )
 
 var (
-	ParsePath         = path.Parse
-	RegisterMutator   = mutate.MustRegister
-	RegisterGenerator = generate.Register
-	Scheme            = scheme.Scheme
+	ParsePath     = path.Parse
+	NewPath       = path.NewPath
+	NewMemoryPath = path.NewMemory
+	NewLocalPath  = path.NewLocal
+	NewGitHubPath = path.NewGitHub
+	Scheme        = scheme.Scheme
+
+	NewTree                 = resource.NewTree
+	Unstructured            = resource.Unstructured
+	ParseKey                = resource.ParseKey
+	NewSelector             = resource.NewSelector
+	ParseKind               = resource.ParseKind
+	MatchKinds              = resource.MatchKinds
+	MatchNames              = resource.MatchNames
+	MatchNamePatterns       = resource.MatchNamePatterns
+	MatchNamespaces         = resource.MatchNamespaces
+	MatchLabels             = resource.MatchLabels
+	MatchLabelSelector      = resource.MatchLabelSelector
+	MatchAnnotations        = resource.MatchAnnotations
+	MatchAnnotationSelector = resource.MatchAnnotationSelector
+	MatchScope              = resource.MatchScope
+	MatchExclude            = resource.MatchExclude
+
+	NewRegistry     = build.NewRegistry
+	DefaultRegistry = build.DefaultRegistry
 )
 
+// RegisterMutator adds a mutator to the default registry, which is used
+// by every build that isn't given a registry.
+//
+// Deprecated: register the mutator on a Registry, such as a copy of
+// DefaultRegistry, and pass it to the build with WithRegistry.
+func RegisterMutator(m Mutator) {
+	mutate.RegisterBuiltin(m)
+}
+
+// RegisterGenerator adds a generator to the default registry, which is
+// used by every build that isn't given a registry.
+//
+// Deprecated: register the generator on a Registry, such as a copy of
+// DefaultRegistry, and pass it to the build with WithRegistry.
+func RegisterGenerator(g Generator) {
+	generate.RegisterBuiltin(g)
+}
+
 func AddKnownTypes(kind schema.GroupVersion, o runtime.Object) {
 	scheme.Scheme.AddKnownTypes(kind, o)
 }
@@ -0,0 +1,212 @@
+package dinghy
+
+import (
+	gocontext "context"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/build"
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/logging"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// DinghyFile is the name of the config file read from each build path
+const DinghyFile = build.DinghyFile
+
+// Builder builds dinghy packages into Kubernetes resources. A Builder
+// is safe to reuse, and every build gets its own copy of the plugin
+// registry, so builds don't affect each other.
+type Builder struct {
+	opts []Option
+}
+
+// Option configures a Builder or a single build. Options passed to a
+// build are applied after the options of the Builder.
+type Option func(o *options)
+
+type options struct {
+	registry *Registry
+	tree     Tree
+	path     *Path
+	logger   *Logger
+
+	kubeVersion       string
+	originAnnotations bool
+	sortOrder         SortOrder
+}
+
+// WithRegistry sets the registry plugins are resolved from. The default
+// registry only has the builtin plugins.
+func WithRegistry(r *Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// WithTree builds into an existing tree, so that mutations and
+// validations also see the resources already in the tree.
+func WithTree(tree Tree) Option {
+	return func(o *options) {
+		o.tree = tree
+	}
+}
+
+// WithPath sets the path relative references in a Config are resolved
+// from. It's only used by BuildFromConfig.
+func WithPath(p Path) Option {
+	return func(o *options) {
+		o.path = &p
+	}
+}
+
+// WithLogger sets the logger that receives build and script output.
+// Output goes to stderr by default.
+func WithLogger(logger *Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithKubeVersion validates every resource the build produces against
+// the OpenAPI schemas of a Kubernetes version, e.g. 1.27. The build fails
+// if the version doesn't have embedded schemas.
+func WithKubeVersion(version string) Option {
+	return func(o *options) {
+		o.kubeVersion = version
+	}
+}
+
+// WithOriginAnnotations annotates every resource the build produces with
+// the file or generator it came from, and the dinghyfiles that included
+// it. The annotation is OriginAnnotation.
+func WithOriginAnnotations() Option {
+	return func(o *options) {
+		o.originAnnotations = true
+	}
+}
+
+// WithSortOrder sets the order Result.Objects and Result.WriteYAML return
+// resources in. It defaults to SortLegacy, which is apply order.
+func WithSortOrder(order SortOrder) Option {
+	return func(o *options) {
+		o.sortOrder = order
+	}
+}
+
+// NewBuilder returns a Builder that applies opts to every build
+func NewBuilder(opts ...Option) *Builder {
+	return &Builder{opts: opts}
+}
+
+// Build reads the dinghyfile at p and builds it. Relative references in
+// the dinghyfile are resolved from p. If ctx has a deadline, scripts
+// still running when it passes are interrupted.
+func (b *Builder) Build(ctx gocontext.Context, p Path, opts ...Option) (*Result, error) {
+	o, c, buildOpts, err := b.prepare(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := build.New().Build(c, p, buildOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Tree: tree, order: o.sortOrder}, nil
+}
+
+// BuildFromConfig builds a Config that wasn't read from a dinghyfile,
+// such as one created in code
+func (b *Builder) BuildFromConfig(ctx gocontext.Context, config *Config, opts ...Option) (*Result, error) {
+	o, c, buildOpts, err := b.prepare(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := build.New().BuildFromConfig(c, config, buildOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Tree: tree, order: o.sortOrder}, nil
+}
+
+// prepare converts the options into the build context and the
+// options used by the build package
+func (b *Builder) prepare(ctx gocontext.Context, opts []Option) (*options, *context.Context, []build.Option, error) {
+	o := &options{sortOrder: SortLegacy}
+	for _, f := range append(append([]Option{}, b.opts...), opts...) {
+		f(o)
+	}
+	// the order is checked up front, since Result.Objects can't return
+	// an error
+	if err := resource.Sort(nil, o.sortOrder); err != nil {
+		return nil, nil, nil, err
+	}
+
+	c := context.NewContext(false)
+	if ctx != nil {
+		c.Context = ctx
+	}
+	if o.logger != nil {
+		c.SetLogger(o.logger)
+	}
+
+	rv := make([]build.Option, 0)
+	if o.registry != nil {
+		rv = append(rv, build.WithRegistry(o.registry))
+	}
+	if o.tree != nil {
+		rv = append(rv, build.WithTree(o.tree))
+	}
+	if o.path != nil {
+		rv = append(rv, build.WithPath(*o.path))
+	}
+	if o.kubeVersion != "" {
+		rv = append(rv, build.WithKubeVersion(o.kubeVersion))
+	}
+	if o.originAnnotations {
+		rv = append(rv, build.WithOriginAnnotations())
+	}
+	return o, c, rv, nil
+}
+
+// Result is the output of a build
+type Result struct {
+	// Tree holds every resource produced by the build
+	Tree Tree
+	// order is the order Objects returns resources in
+	order SortOrder
+}
+
+// Objects returns every resource in the result, in the sort order of
+// the build, which is SortLegacy unless WithSortOrder was used
+func (r *Result) Objects() []*Object {
+	order := r.order
+	if order == "" {
+		order = SortLegacy
+	}
+	rv, _ := resource.Sorted(r.Tree, order)
+	return rv
+}
+
+// Get returns the resource identified by key. ErrNotFound is returned
+// if the result doesn't have the resource.
+func (r *Result) Get(key Key) (*Object, error) {
+	return resource.GetResource(r.Tree, key)
+}
+
+// WriteYAML writes every resource in the result to w as a stream of
+// YAML documents
+func (r *Result) WriteYAML(w io.Writer) error {
+	e := yaml.NewEncoder(w)
+	for _, obj := range r.Objects() {
+		if err := e.Encode(obj.Object); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+// NewLogger returns a Logger that writes to w
+func NewLogger(w io.Writer) *Logger {
+	return logging.NewWriter(w)
+}
@@ -0,0 +1,75 @@
+package dinghy_test
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy"
+)
+
+func TestResult_Objects(t *testing.T) {
+	tree := dinghy.NewTree()
+	for _, obj := range []map[string]any{
+		{"apiVersion": "v1", "kind": "Service", "metadata": map[string]any{"name": "web", "namespace": "app"}},
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web", "namespace": "app"}},
+		{"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]any{"name": "app"}},
+	} {
+		qt.Assert(t, tree.Insert(dinghy.Unstructured(obj)), qt.IsNil)
+	}
+	kinds := func(objs []*dinghy.Object) []string {
+		rv := make([]string, 0, len(objs))
+		for _, obj := range objs {
+			rv = append(rv, obj.GetKind())
+		}
+		return rv
+	}
+
+	tests := map[string]struct {
+		opts []dinghy.Option
+		want []string
+	}{
+		"Legacy": {want: []string{"Namespace", "Service", "Deployment"}},
+		"None":   {opts: []dinghy.Option{dinghy.WithSortOrder(dinghy.SortNone)}, want: []string{"Deployment", "Namespace", "Service"}},
+		"FIFO":   {opts: []dinghy.Option{dinghy.WithSortOrder(dinghy.SortFIFO)}, want: []string{"Service", "Deployment", "Namespace"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := append([]dinghy.Option{dinghy.WithTree(tree)}, tt.opts...)
+			result, err := dinghy.NewBuilder().BuildFromConfig(context.Background(), &dinghy.Config{}, opts...)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, kinds(result.Objects()), qt.DeepEquals, tt.want)
+		})
+	}
+
+	_, err := dinghy.NewBuilder(dinghy.WithSortOrder("random")).BuildFromConfig(context.Background(), &dinghy.Config{})
+	qt.Assert(t, err, qt.ErrorMatches, `unknown sort order "random".*`)
+}
+
+// deprecatedLabel is registered with the deprecated RegisterMutator
+type deprecatedLabel struct{}
+
+func (m *deprecatedLabel) Name() string { return "example.com/deprecated-label" }
+
+func (m *deprecatedLabel) Visit(obj *dinghy.Object) error {
+	obj.AddLabels(map[string]string{"registered": "true"})
+	return nil
+}
+
+func TestRegisterMutator(t *testing.T) {
+	dinghy.RegisterMutator(&deprecatedLabel{})
+	qt.Assert(t, dinghy.DefaultRegistry().Has("example.com/deprecated-label"), qt.IsTrue)
+
+	tree := dinghy.NewTree()
+	qt.Assert(t, tree.Insert(dinghy.Unstructured(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "web"},
+	})), qt.IsNil)
+	result, err := dinghy.NewBuilder().BuildFromConfig(context.Background(), &dinghy.Config{
+		Mutations: []dinghy.MutationSpec{{Uses: "example.com/deprecated-label"}},
+	}, dinghy.WithTree(tree))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, result.Objects()[0].GetLabels(), qt.DeepEquals, map[string]string{"registered": "true"})
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	gocontext "context"
 	"io"
+	"time"
 
 	"github.com/johnhoman/dinghy/internal/build"
 	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/output"
 	"github.com/johnhoman/dinghy/internal/path"
 	"github.com/johnhoman/dinghy/internal/resource"
 	"github.com/johnhoman/dinghy/internal/types"
@@ -13,39 +16,97 @@ import (
 type cmdBuild struct {
 	Dir       string `kong:"name=dir,arg"`
 	Kustomize bool   `kong:"default=false,short=k"`
+	// Timeout is the deadline for the whole build. Scripts that are
+	// running when it passes are interrupted.
+	Timeout time.Duration `kong:"name=timeout,help='Stop the build if it takes longer than the timeout, e.g. 1m'"`
+	// KubeVersion validates the output against the Kubernetes OpenAPI
+	// schemas of the version
+	KubeVersion string `kong:"name=kube-version,help='Validate resources against the OpenAPI schemas of a Kubernetes version, e.g. 1.27'"`
+	// Sort is the order resources are written in. It defaults to legacy,
+	// which is apply order.
+	Sort string `kong:"name=sort,default=legacy,enum='legacy,none,fifo',help='Write resources in apply order (legacy), by key (none), or in the order they were read (fifo)'"`
+	// AddOrigin annotates every resource with the file it was read from,
+	// or the generator that emitted it
+	AddOrigin bool `kong:"name=add-origin,help='Annotate resources with the file or generator they came from, and the dinghyfiles that included them'"`
+	// Output is the output format, see output.Parse. It defaults to yaml.
+	Output string `kong:"name=output,short=o,default=yaml,help='Write resources as yaml, json (a v1 List), ndjson, dir=<path> with a file per resource, or kustomize=<path> with a kustomization.yaml. Files written to the path by a previous build are replaced, and other files are kept'"`
 }
 
 // Run builds the kustomization package and emits the resources
 // to stdout
 func (cmd *cmdBuild) Run(stdout io.Writer) error {
-	// cmd.Dir could be relative to the current working directory, so it
-	// may need to be joined with the working directory
-	dir, err := path.Parse(cmd.Dir)
+	format, err := cmd.format()
 	if err != nil {
-		return nil
+		return err
 	}
 
 	c := context.NewContext(true)
+	if cmd.Timeout > 0 {
+		var cancel gocontext.CancelFunc
+		c.Context, cancel = gocontext.WithTimeout(c.Context, cmd.Timeout)
+		defer cancel()
+	}
+	opts := make([]build.Option, 0)
+	if cmd.KubeVersion != "" {
+		opts = append(opts, build.WithKubeVersion(cmd.KubeVersion))
+	}
+	if cmd.AddOrigin {
+		opts = append(opts, build.WithOriginAnnotations())
+	}
+	tree, err := buildTree(c, cmd.Dir, cmd.Kustomize, opts...)
+	if err != nil {
+		return err
+	}
+	return cmd.write(tree, format, stdout)
+}
+
+// buildTree builds the dinghyfile in dir, or the kustomization in dir if
+// kustomize is set
+func buildTree(c *context.Context, dir string, kustomize bool, opts ...build.Option) (resource.Tree, error) {
 	b := build.New()
-	if cmd.Kustomize {
-		tree, err := b.BuildFromConfig(c, &types.Config{
+	if kustomize {
+		return b.BuildFromConfig(c, &types.Config{
 			Generators: []types.GeneratorSpec{{
 				Uses: "builtin.dinghy.dev/kustomize",
 				With: map[string]any{
-					"source": cmd.Dir,
+					"source": dir,
 				},
 			}},
-		})
-		if err != nil {
-			return err
-		}
-		return resource.PrintTree(tree, stdout)
+		}, opts...)
 	}
-	c.SetRoot(cmd.Dir)
+	// dir could be relative to the current working directory, so it
+	// may need to be joined with the working directory
+	p, err := path.Parse(dir)
+	if err != nil {
+		return nil, err
+	}
+	c.SetRoot(dir)
+	return b.Build(c, p, opts...)
+}
 
-	tree, err := b.Build(c, dir)
+// write writes every resource in the tree in the output format
+func (cmd *cmdBuild) write(tree resource.Tree, format output.Format, stdout io.Writer) error {
+	objs, err := resource.Sorted(tree, cmd.sortOrder())
 	if err != nil {
 		return err
 	}
-	return resource.PrintTree(tree, stdout)
+	return format.Write(objs, stdout)
+}
+
+// format returns the output format. Commands created in code don't have
+// kong's defaults, so an empty format is yaml.
+func (cmd *cmdBuild) format() (output.Format, error) {
+	if cmd.Output == "" {
+		return output.YAML{}, nil
+	}
+	return output.Parse(cmd.Output)
+}
+
+// sortOrder returns the sort order of the output. Commands created in
+// code don't have kong's defaults, so an empty order is legacy.
+func (cmd *cmdBuild) sortOrder() resource.SortOrder {
+	if cmd.Sort == "" {
+		return resource.SortLegacy
+	}
+	return resource.SortOrder(cmd.Sort)
 }
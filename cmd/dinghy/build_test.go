@@ -46,6 +46,171 @@ func TestCmdBuild_Run(t *testing.T) {
 	}
 }
 
+func TestCmdBuild_Sort(t *testing.T) {
+	tests := map[string][]string{
+		"": {"Namespace", "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Service",
+			"ValidatingWebhookConfiguration"},
+		"legacy": {"Namespace", "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Service",
+			"ValidatingWebhookConfiguration"},
+		"none": {"ValidatingWebhookConfiguration", "ClusterRole", "ClusterRoleBinding", "Namespace",
+			"Service", "ServiceAccount"},
+		"fifo": {"Namespace", "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Service",
+			"ValidatingWebhookConfiguration"},
+	}
+	for order, want := range tests {
+		t.Run(order, func(t *testing.T) {
+			cmd := &cmdBuild{Dir: "../../examples/mutate-namespace-references", Sort: order}
+			buf := new(bytes.Buffer)
+			qt.Assert(t, cmd.Run(buf), qt.IsNil)
+			got := make([]string, 0)
+			d := yaml.NewDecoder(buf)
+			for {
+				var obj struct {
+					Kind string `yaml:"kind"`
+				}
+				err := d.Decode(&obj)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				qt.Assert(t, err, qt.IsNil)
+				got = append(got, obj.Kind)
+			}
+			qt.Assert(t, got, qt.DeepEquals, want)
+		})
+	}
+}
+
+func TestCmdBuild_Output(t *testing.T) {
+	example := "../../examples/mutate-namespace-references"
+	want := decodeExpected(t, example)
+
+	t.Run("json", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		qt.Assert(t, (&cmdBuild{Dir: example, Output: "json"}).Run(buf), qt.IsNil)
+		var list struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Items      []any  `yaml:"items"`
+		}
+		// JSON is YAML, so the list is decoded like the expected output
+		qt.Assert(t, yaml.NewDecoder(buf).Decode(&list), qt.IsNil)
+		qt.Assert(t, list.APIVersion, qt.Equals, "v1")
+		qt.Assert(t, list.Kind, qt.Equals, "List")
+		items := new(bytes.Buffer)
+		e := yaml.NewEncoder(items)
+		for _, item := range list.Items {
+			qt.Assert(t, e.Encode(item), qt.IsNil)
+		}
+		qt.Assert(t, decodeStream(t, items), qt.DeepEquals, want)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		qt.Assert(t, (&cmdBuild{Dir: example, Output: "ndjson"}).Run(buf), qt.IsNil)
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		qt.Assert(t, lines, qt.HasLen, len(want))
+		qt.Assert(t, decodeStream(t, strings.NewReader(strings.Join(lines, "\n---\n"))), qt.DeepEquals, want)
+	})
+
+	t.Run("kustomize", func(t *testing.T) {
+		dir := t.TempDir()
+		buf := new(bytes.Buffer)
+		qt.Assert(t, (&cmdBuild{Dir: example, Output: "kustomize=" + dir}).Run(buf), qt.IsNil)
+		qt.Assert(t, buf.Len(), qt.Equals, 0)
+		_, err := os.Stat(filepath.Join(dir, "namespace_prod.yaml"))
+		qt.Assert(t, err, qt.IsNil)
+
+		// the written kustomization builds the same resources
+		qt.Assert(t, (&cmdBuild{Dir: dir, Kustomize: true}).Run(buf), qt.IsNil)
+		qt.Assert(t, decodeStream(t, buf), qt.DeepEquals, want)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		err := (&cmdBuild{Dir: example, Output: "toml"}).Run(new(bytes.Buffer))
+		qt.Assert(t, err, qt.ErrorMatches, `unknown output format "toml".*`)
+	})
+}
+
+// TestCmdBuild_Kustomize builds the kustomize conformance corpus in
+// testdata/kustomize, where each case is a directory named
+// <feature>/<case> with a kustomization and the output of kustomize
+// build in expected.yaml
+func TestCmdBuild_Kustomize(t *testing.T) {
+	corpus := filepath.Join("testdata", "kustomize")
+	cases, err := filepath.Glob(filepath.Join(corpus, "*", "*", "expected.yaml"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, cases, qt.Not(qt.HasLen), 0)
+
+	features := make([]string, 0)
+	passed := make(map[string]int)
+	failed := make(map[string][]string)
+	for _, expected := range cases {
+		dir := filepath.Dir(expected)
+		feature, name := filepath.Base(filepath.Dir(dir)), filepath.Base(dir)
+		if _, ok := passed[feature]; !ok {
+			features = append(features, feature)
+			passed[feature] = 0
+		}
+		ok := t.Run(feature+"/"+name, func(t *testing.T) {
+			cmd := &cmdBuild{Dir: dir, Kustomize: true}
+			buf := new(bytes.Buffer)
+			qt.Assert(t, cmd.Run(buf), qt.IsNil)
+			qt.Assert(t, decodeStream(t, buf), qt.DeepEquals, decodeExpected(t, dir))
+		})
+		if ok {
+			passed[feature]++
+		} else {
+			failed[feature] = append(failed[feature], name)
+		}
+	}
+	for _, feature := range features {
+		if len(failed[feature]) == 0 {
+			t.Logf("PASS %s (%d/%d)", feature, passed[feature], passed[feature])
+			continue
+		}
+		t.Logf("FAIL %s (%d/%d): %s", feature, passed[feature], passed[feature]+len(failed[feature]),
+			strings.Join(failed[feature], ", "))
+	}
+}
+
+func TestCmdBuild_AddOrigin(t *testing.T) {
+	dir := "../../examples/mutate-namespace"
+	buf := new(bytes.Buffer)
+	qt.Assert(t, (&cmdBuild{Dir: dir, AddOrigin: true}).Run(buf), qt.IsNil)
+	got := decodeStream(t, buf)
+	qt.Assert(t, got, qt.HasLen, 1)
+
+	metadata := got[0].(map[string]any)["metadata"].(map[string]any)
+	qt.Assert(t, metadata["annotations"], qt.DeepEquals, map[string]any{
+		"dinghy.dev/origin": "path: " + filepath.Join(dir, "deployment.yaml") + "\n" +
+			"includedBy:\n  - " + filepath.Join(dir, "dinghyfile.yaml") + "\n",
+	})
+}
+
+func TestCmdBuild_AddOrigin_Kustomize(t *testing.T) {
+	origins := func(t *testing.T, dir string) map[string]any {
+		buf := new(bytes.Buffer)
+		qt.Assert(t, (&cmdBuild{Dir: dir, Kustomize: true, AddOrigin: true}).Run(buf), qt.IsNil)
+		rv := make(map[string]any)
+		for _, obj := range decodeStream(t, buf) {
+			u := &unstructured.Unstructured{Object: obj.(map[string]any)}
+			rv[u.GetKind()] = u.GetAnnotations()["dinghy.dev/origin"]
+		}
+		return rv
+	}
+
+	dir := "../../examples/generate-kustomize-local-nested/target"
+	qt.Assert(t, origins(t, dir), qt.DeepEquals, map[string]any{
+		"ConfigMap": "path: " + filepath.Join(dir, "nested", "configmap.yaml") + "\n",
+		"Service":   "path: " + filepath.Join(dir, "service.yaml") + "\n",
+	})
+
+	dir = "../../examples/generate-kustomize-configmapgenerator/kustomize"
+	qt.Assert(t, origins(t, dir), qt.DeepEquals, map[string]any{
+		"ConfigMap": "configuredIn: " + filepath.Join(dir, "kustomization.yaml") + "\nconfiguredBy: ConfigMapGenerator\n",
+	})
+}
+
 func decodeStream(t *testing.T, r io.Reader) []any {
 	rv := make([]any, 0)
 	d := yaml.NewDecoder(r)
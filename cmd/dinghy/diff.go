@@ -0,0 +1,135 @@
+package main
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// errDifferent is returned by cmdDiff with --exit-code if the trees
+// aren't the same. It exits with status 1 and doesn't print an error.
+var errDifferent = errors.New("the resources are different")
+
+// diffErrorCode is the exit status of dinghy diff if it fails, like
+// diff(1), so that it can't be mistaken for a difference
+const diffErrorCode = 2
+
+type cmdDiff struct {
+	// A and B are directories or URLs built like dinghy build, or YAML
+	// files that were rendered by dinghy build
+	A         string        `kong:"name=a,arg,help='The old dinghyfile directory, URL or rendered YAML file'"`
+	B         string        `kong:"name=b,arg,help='The new dinghyfile directory, URL or rendered YAML file'"`
+	Kustomize bool          `kong:"default=false,short=k,help='Build directories and URLs as kustomizations'"`
+	Timeout   time.Duration `kong:"name=timeout,help='Stop each build if it takes longer than the timeout, e.g. 1m'"`
+	// ExitCode makes the command exit with status 1 if there are any
+	// differences, like git diff --exit-code. Errors exit with status 2
+	// whether it's set or not.
+	ExitCode bool `kong:"name=exit-code,help='Exit with status 1 if the resources are different. Errors exit with status 2'"`
+}
+
+// Run builds both sides and writes a unified diff of every resource that
+// was added, removed or changed, matched by resource.Key
+func (cmd *cmdDiff) Run(stdout io.Writer) error {
+	n, err := cmd.run(stdout)
+	if err != nil {
+		return &exitError{err: err, code: diffErrorCode}
+	}
+	if n > 0 && cmd.ExitCode {
+		return errDifferent
+	}
+	return nil
+}
+
+// run writes the diff and returns the number of resources that are
+// different
+func (cmd *cmdDiff) run(stdout io.Writer) (int, error) {
+	a, err := cmd.load(cmd.A)
+	if err != nil {
+		return 0, errors.Wrap(err, cmd.A)
+	}
+	b, err := cmd.load(cmd.B)
+	if err != nil {
+		return 0, errors.Wrap(err, cmd.B)
+	}
+	return diffTrees(a, b, stdout)
+}
+
+// load reads the resources of a rendered YAML file, or builds a directory
+func (cmd *cmdDiff) load(side string) (resource.Tree, error) {
+	p, err := path.Parse(side)
+	if err != nil {
+		return nil, err
+	}
+	isDir, err := p.IsDir()
+	if err != nil {
+		return nil, err
+	}
+	if !isDir {
+		r, err := p.Reader()
+		if err != nil {
+			return nil, err
+		}
+		tree := resource.NewTree()
+		return tree, resource.InsertFromReader(tree, r)
+	}
+
+	c := context.NewContext(true)
+	if cmd.Timeout > 0 {
+		var cancel gocontext.CancelFunc
+		c.Context, cancel = gocontext.WithTimeout(c.Context, cmd.Timeout)
+		defer cancel()
+	}
+	return buildTree(c, side, cmd.Kustomize)
+}
+
+// diffTrees writes the diff of every resource that's different in a and
+// b, sorted by key, and returns the number of resources that are different
+func diffTrees(a, b resource.Tree, w io.Writer) (int, error) {
+	left, err := objectsByKey(a)
+	if err != nil {
+		return 0, err
+	}
+	right, err := objectsByKey(b)
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]resource.Key, 0, len(left)+len(right))
+	for key := range left {
+		keys = append(keys, key)
+	}
+	for key := range right {
+		if _, ok := left[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	n := 0
+	for _, key := range keys {
+		diff := left[key].Diff(right[key])
+		if diff == "" {
+			continue
+		}
+		n++
+		if _, err := fmt.Fprint(w, diff); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func objectsByKey(tree resource.Tree) (map[resource.Key]*resource.Object, error) {
+	objs := make(map[resource.Key]*resource.Object)
+	return objs, tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		objs[resource.ParseKey(obj)] = obj
+		return nil
+	}))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+const diffOld = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-v1
+  namespace: app
+data:
+  port: "8080"
+`
+
+const diffNew = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-v2
+  namespace: app
+data:
+  port: "8080"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.26
+`
+
+const diffWant = `--- a/apps.v1.Deployment/app/web
++++ b/apps.v1.Deployment/app/web
+@@ -8,5 +8,5 @@
+     template:
+         spec:
+             containers:
+-                - image: nginx:1.25
++                - image: nginx:1.26
+                   name: web
+--- a/v1.ConfigMap/app/web-v1
++++ /dev/null
+@@ -1,7 +0,0 @@
+-apiVersion: v1
+-data:
+-    port: "8080"
+-kind: ConfigMap
+-metadata:
+-    name: web-v1
+-    namespace: app
+--- /dev/null
++++ b/v1.ConfigMap/app/web-v2
+@@ -0,0 +1,7 @@
++apiVersion: v1
++data:
++    port: "8080"
++kind: ConfigMap
++metadata:
++    name: web-v2
++    namespace: app
+`
+
+func TestCmdDiff_Run(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	qt.Assert(t, os.WriteFile(a, []byte(diffOld), 0o644), qt.IsNil)
+	qt.Assert(t, os.WriteFile(b, []byte(diffNew), 0o644), qt.IsNil)
+
+	buf := new(bytes.Buffer)
+	qt.Assert(t, (&cmdDiff{A: a, B: b}).Run(buf), qt.IsNil)
+	qt.Assert(t, buf.String(), qt.Equals, diffWant)
+
+	buf.Reset()
+	qt.Assert(t, (&cmdDiff{A: a, B: b, ExitCode: true}).Run(buf), qt.ErrorIs, errDifferent)
+	qt.Assert(t, buf.String(), qt.Equals, diffWant)
+
+	buf.Reset()
+	qt.Assert(t, (&cmdDiff{A: a, B: a, ExitCode: true}).Run(buf), qt.IsNil)
+	qt.Assert(t, buf.String(), qt.Equals, "")
+}
+
+func TestCmdDiff_Run_Build(t *testing.T) {
+	// a dinghyfile directory is built, so it's the same as its rendered
+	// output
+	dir := "../../examples/mutate-namespace-references"
+	buf := new(bytes.Buffer)
+	cmd := &cmdDiff{A: dir, B: filepath.Join(dir, "expected.yaml"), ExitCode: true}
+	qt.Assert(t, cmd.Run(buf), qt.IsNil)
+	qt.Assert(t, buf.String(), qt.Equals, "")
+
+	cmd = &cmdDiff{A: dir, B: "../../examples/mutate-namespace", ExitCode: true}
+	qt.Assert(t, cmd.Run(buf), qt.ErrorIs, errDifferent)
+	qt.Assert(t, buf.String(), qt.Contains, "--- a/v1.ServiceAccount/")
+}
+
+func TestCmdDiff_ExitCode(t *testing.T) {
+	if args := os.Getenv("DINGHY_TEST_MAIN"); args != "" {
+		os.Args = append([]string{"dinghy"}, strings.Split(args, " ")...)
+		Main()
+		os.Exit(0)
+	}
+	dir := "../../examples/mutate-namespace-references"
+	tests := map[string]struct {
+		args string
+		code int
+	}{
+		"Same":      {args: "diff --exit-code " + dir + " " + filepath.Join(dir, "expected.yaml"), code: 0},
+		"Different": {args: "diff --exit-code " + dir + " ../../examples/mutate-namespace", code: 1},
+		"Error":     {args: "diff --exit-code " + dir + " " + filepath.Join(t.TempDir(), "missing"), code: 2},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestCmdDiff_ExitCode$")
+			cmd.Env = append(os.Environ(), "DINGHY_TEST_MAIN="+tt.args)
+			err := cmd.Run()
+			var exit *exec.ExitError
+			if tt.code == 0 {
+				qt.Assert(t, err, qt.IsNil)
+				return
+			}
+			qt.Assert(t, err, qt.ErrorAs, &exit)
+			qt.Assert(t, exit.ExitCode(), qt.Equals, tt.code)
+		})
+	}
+}
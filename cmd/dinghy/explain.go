@@ -0,0 +1,134 @@
+package main
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/johnhoman/dinghy/internal/build"
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/fieldpath"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+type cmdExplain struct {
+	// Resource is the resource to explain, written as kind/name. The kind
+	// can be Kind, group/Kind or group/version/Kind.
+	Resource string `kong:"name=resource,arg,help='The resource to explain, e.g. Deployment/web or apps/Deployment/web'"`
+	// FieldPath limits the events to the ones that changed the field, or
+	// any field under it
+	FieldPath string        `kong:"name=fieldpath,arg,optional,help='Only explain the field, e.g. spec.template.spec.containers[name=web].image'"`
+	Dir       string        `kong:"name=dir,short=d,default='.',help='The dinghyfile directory or URL to build'"`
+	Namespace string        `kong:"name=namespace,short=n,help='Only explain the resource in the namespace'"`
+	Kustomize bool          `kong:"default=false,short=k"`
+	Timeout   time.Duration `kong:"name=timeout,help='Stop the build if it takes longer than the timeout, e.g. 1m'"`
+}
+
+// Run builds the dinghyfile and writes the events of every resource that
+// matches, which are the steps of the build that created or changed it
+func (cmd *cmdExplain) Run(stdout io.Writer) error {
+	opts, err := cmd.matchOptions()
+	if err != nil {
+		return err
+	}
+	var fp *fieldpath.FieldPath
+	if cmd.FieldPath != "" {
+		if fp, err = fieldpath.Parse(cmd.FieldPath); err != nil {
+			return errors.Wrapf(err, "fieldpath %q", cmd.FieldPath)
+		}
+	}
+
+	c := context.NewContext(true)
+	if cmd.Timeout > 0 {
+		var cancel gocontext.CancelFunc
+		c.Context, cancel = gocontext.WithTimeout(c.Context, cmd.Timeout)
+		defer cancel()
+	}
+	dir := cmd.Dir
+	if dir == "" {
+		dir = "."
+	}
+	tree, err := buildTree(c, dir, cmd.Kustomize, build.WithEvents())
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	err = tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if n > 0 {
+			fmt.Fprintln(stdout)
+		}
+		n++
+		fmt.Fprintln(stdout, resource.ParseKey(obj).String())
+		for _, e := range obj.Events() {
+			if cmd.FieldPath != "" && e.Type == resource.EventChanged {
+				if e.Paths = cmd.related(e.Paths); len(e.Paths) == 0 {
+					continue
+				}
+			}
+			fmt.Fprintf(stdout, "  %s\n", e)
+		}
+		if fp == nil {
+			return nil
+		}
+		value, ok, err := fp.GetValue(obj.Object)
+		if err != nil {
+			return errors.Wrapf(err, "fieldpath %q", cmd.FieldPath)
+		}
+		if !ok {
+			fmt.Fprintf(stdout, "  %s is not set\n", cmd.FieldPath)
+			return nil
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "  %s = %s\n", cmd.FieldPath, data)
+		return nil
+	}), opts...)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.Errorf("no resources match %s", cmd.Resource)
+	}
+	return nil
+}
+
+// matchOptions returns the options that match the resource
+func (cmd *cmdExplain) matchOptions() ([]resource.MatchOption, error) {
+	i := strings.LastIndex(cmd.Resource, "/")
+	if i <= 0 || i == len(cmd.Resource)-1 {
+		return nil, errors.Errorf("resource %q must be kind/name", cmd.Resource)
+	}
+	gvk, err := resource.ParseKind(cmd.Resource[:i])
+	if err != nil {
+		return nil, errors.Wrap(err, "resource")
+	}
+	opts := []resource.MatchOption{resource.MatchKinds(gvk), resource.MatchNames(cmd.Resource[i+1:])}
+	if cmd.Namespace != "" {
+		opts = append(opts, resource.MatchNamespaces(cmd.Namespace))
+	}
+	return opts, nil
+}
+
+// related returns the paths that are the field path, or are above or
+// below it
+func (cmd *cmdExplain) related(paths []string) []string {
+	rv := make([]string, 0)
+	for _, p := range paths {
+		if p == cmd.FieldPath || isFieldPrefix(cmd.FieldPath, p) || isFieldPrefix(p, cmd.FieldPath) {
+			rv = append(rv, p)
+		}
+	}
+	return rv
+}
+
+func isFieldPrefix(prefix, path string) bool {
+	return strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCmdExplain_Run(t *testing.T) {
+	const file = "../../examples/mutate-jsonpatch/dinghyfile.yaml"
+	tests := map[string]struct {
+		cmd  cmdExplain
+		want string
+	}{
+		"Resource": {
+			cmd: cmdExplain{Resource: "Deployment/nginx-deployment"},
+			want: "apps.v1.Deployment/nginx-deployment\n" +
+				"  resources[0] (deployment.yaml) in " + file + ": created\n" +
+				"  mutate[0] (builtin.dinghy.dev/jsonpatch) in " + file + ": changed spec.replicas, " +
+				"spec.selector.matchLabels['app.kubernetes.io/name'], spec.template.metadata.labels['app.kubernetes.io/name']\n",
+		},
+		"FieldPath": {
+			cmd: cmdExplain{Resource: "apps/v1/Deployment/nginx-deployment", FieldPath: "spec.replicas"},
+			want: "apps.v1.Deployment/nginx-deployment\n" +
+				"  resources[0] (deployment.yaml) in " + file + ": created\n" +
+				"  mutate[0] (builtin.dinghy.dev/jsonpatch) in " + file + ": changed spec.replicas\n" +
+				"  spec.replicas = 1\n",
+		},
+		"FieldPathUnchanged": {
+			cmd: cmdExplain{Resource: "Deployment/nginx-deployment", FieldPath: "spec.template.spec.containers[name=nginx].image"},
+			want: "apps.v1.Deployment/nginx-deployment\n" +
+				"  resources[0] (deployment.yaml) in " + file + ": created\n" +
+				"  spec.template.spec.containers[name=nginx].image = \"nginx:1.14.2\"\n",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.cmd.Dir = "../../examples/mutate-jsonpatch"
+			buf := new(bytes.Buffer)
+			qt.Assert(t, tt.cmd.Run(buf), qt.IsNil)
+			qt.Assert(t, buf.String(), qt.Equals, tt.want)
+		})
+	}
+}
+
+func TestCmdExplain_Run_Errors(t *testing.T) {
+	tests := map[string]struct {
+		resource string
+		err      string
+	}{
+		"NoName":   {resource: "Deployment", err: `resource "Deployment" must be kind/name`},
+		"Kind":     {resource: "apps/v1/Deployment/web/x", err: `resource: .* must be Kind, group/Kind or group/version/Kind`},
+		"NotFound": {resource: "Service/nginx-deployment", err: `no resources match Service/nginx-deployment`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := &cmdExplain{Resource: tt.resource, Dir: "../../examples/mutate-jsonpatch"}
+			qt.Assert(t, cmd.Run(new(bytes.Buffer)), qt.ErrorMatches, tt.err)
+		})
+	}
+}
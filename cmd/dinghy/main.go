@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"os"
 	"runtime/pprof"
@@ -9,8 +10,10 @@ import (
 )
 
 var commandLine struct {
-	Build   cmdBuild `kong:"cmd"`
-	Profile bool     `kong:"name=pprof"`
+	Build   cmdBuild   `kong:"cmd"`
+	Diff    cmdDiff    `kong:"cmd"`
+	Explain cmdExplain `kong:"cmd"`
+	Profile bool       `kong:"name=pprof"`
 }
 
 func Main() {
@@ -29,7 +32,28 @@ func Main() {
 	}
 
 	cmd.BindTo(os.Stdout, (*io.Writer)(nil))
-	cmd.FatalIfErrorf(cmd.Run())
+	err := cmd.Run()
+	if errors.Is(err, errDifferent) {
+		cmd.Exit(1)
+	}
+	var exit *exitError
+	if errors.As(err, &exit) {
+		cmd.Errorf("%s", exit.err)
+		cmd.Exit(exit.code)
+	}
+	cmd.FatalIfErrorf(err)
+}
+
+// exitError is an error that exits with a status other than 1, such as
+// the errors of dinghy diff, which exits with 1 if the resources are
+// different
+type exitError struct {
+	err  error
+	code int
 }
 
+func (e *exitError) Error() string { return e.err.Error() }
+
+func (e *exitError) Unwrap() error { return e.err }
+
 func main() { Main() }
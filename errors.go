@@ -0,0 +1,38 @@
+package dinghy
+
+import (
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// The errors returned by a build. Use errors.As to inspect them, since
+// they're usually wrapped.
+type (
+	// ErrConfig is an invalid entry in a dinghyfile, with the file,
+	// line and column of the entry
+	ErrConfig = errors.ErrConfig
+	// ErrDecodePlugin is a plugin `with` config that doesn't match
+	// the plugin schema
+	ErrDecodePlugin = errors.ErrDecodePlugin
+	// ErrValidation holds every violation reported by the validators
+	ErrValidation = errors.ErrValidation
+	Violation     = errors.Violation
+	// ErrScript is an exception, syntax error or timeout in a script,
+	// with the script name, line and column
+	ErrScript = errors.ErrScript
+	// ErrorList is a list of errors, such as every invalid entry
+	// in a dinghyfile
+	ErrorList = errors.List
+	// ConflictError is two different resources with the same key, with
+	// the files or generators they came from. It wraps
+	// ErrResourceConflict.
+	ConflictError = resource.ConflictError
+)
+
+var (
+	// ErrNotFound is returned when a resource isn't in a Tree
+	ErrNotFound = resource.ErrNotFound
+	// ErrResourceConflict is returned when two different resources with
+	// the same key are built
+	ErrResourceConflict = resource.ErrResourceConflict
+)
@@ -0,0 +1,84 @@
+package dinghy_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/johnhoman/dinghy"
+)
+
+func ExampleBuilder_Build() {
+	mem := dinghy.NewMemoryPath()
+	files := map[string]string{
+		"app/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- configmap.yaml
+mutate:
+- uses: builtin.dinghy.dev/metadata/labels
+  with:
+    app: web
+`,
+		"app/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  port: "8080"
+`,
+	}
+	for name, content := range files {
+		if err := mem.WriteFile(name, []byte(content)); err != nil {
+			panic(err)
+		}
+	}
+
+	result, err := dinghy.NewBuilder().Build(context.Background(), dinghy.NewPath(mem, "app"))
+	if err != nil {
+		panic(err)
+	}
+	if err := result.WriteYAML(os.Stdout); err != nil {
+		panic(err)
+	}
+	// Output:
+	// apiVersion: v1
+	// data:
+	//     port: "8080"
+	// kind: ConfigMap
+	// metadata:
+	//     labels:
+	//         app: web
+	//     name: web
+}
+
+func ExampleBuilder_BuildFromConfig() {
+	tree := dinghy.NewTree()
+	err := tree.Insert(dinghy.Unstructured(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "web"},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = dinghy.NewBuilder().BuildFromConfig(context.Background(), &dinghy.Config{
+		Validations: []dinghy.ValidationSpec{{
+			Uses: "builtin.dinghy.dev/requiredLabels",
+			With: map[string]any{"keys": []string{"app"}},
+		}},
+	}, dinghy.WithTree(tree))
+
+	var validationErr *dinghy.ErrValidation
+	if errors.As(err, &validationErr) {
+		for _, v := range validationErr.Violations {
+			fmt.Printf("%s: %s\n", v.Resource, v.Message)
+		}
+	}
+	// Output:
+	// v1.ConfigMap/web: missing required label "app"
+}
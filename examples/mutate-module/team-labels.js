@@ -0,0 +1,4 @@
+function mutate(obj, config) {
+  obj.metadata.labels = obj.metadata.labels || {}
+  obj.metadata.labels["example.com/team"] = config.team
+}
@@ -3,18 +3,18 @@ package build
 import (
 	"bytes"
 	"fmt"
-	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/johnhoman/dinghy/internal/context"
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
 	"github.com/johnhoman/dinghy/internal/generate"
 	"github.com/johnhoman/dinghy/internal/mutate"
 	"github.com/johnhoman/dinghy/internal/path"
 	"github.com/johnhoman/dinghy/internal/resource"
 	"github.com/johnhoman/dinghy/internal/types"
+	"github.com/johnhoman/dinghy/internal/validate"
 )
 
 const (
@@ -62,6 +62,62 @@ func WithPath(path path.Path) Option {
 	}
 }
 
+// WithRegistry sets the registry plugins are resolved from. The
+// registry is shared with every nested dinghyfile in the build. If it
+// isn't set, the builtin plugins are used.
+func WithRegistry(r *Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// WithKubeVersion validates every resource in the final tree against
+// the OpenAPI schemas of the Kubernetes version, e.g. 1.27. Nested builds
+// patch resources with the schemas of the version too, but only the top
+// level build validates them, since nested builds aren't final.
+func WithKubeVersion(version string) Option {
+	return func(o *options) {
+		o.kubeVersion = version
+		o.validateSchemas = true
+	}
+}
+
+// withPatchVersion sets the Kubernetes version of a nested build, whose
+// resources are patched with the schemas of the version but aren't
+// validated against them
+func withPatchVersion(version string) Option {
+	return func(o *options) {
+		o.kubeVersion = version
+	}
+}
+
+// WithOriginAnnotations adds the resource.OriginAnnotation to every
+// resource in the final tree that has a known origin. Like WithKubeVersion,
+// it only applies to the top level build.
+func WithOriginAnnotations() Option {
+	return func(o *options) {
+		o.originAnnotations = true
+	}
+}
+
+// WithEvents records an event on every resource for each step of the
+// build that created, included or changed it. Events are recorded in
+// nested builds too. Recording copies the tree for every step, so it's
+// off unless the events are needed.
+func WithEvents() Option {
+	return func(o *options) {
+		o.events = true
+	}
+}
+
+// withFile sets the name of the file the Config was read from, so
+// that config errors can point at it
+func withFile(file string) Option {
+	return func(o *options) {
+		o.file = file
+	}
+}
+
 type options struct {
 	// tree is an optional resource Tree to augment. If a tree
 	// is provided, mutations and validations will consider existing
@@ -70,6 +126,22 @@ type options struct {
 	// path is the current build path, which is required for relative references
 	// to files in the build path
 	path path.Path
+	// file is the config file being built. It's empty if the config
+	// wasn't read from a file
+	file string
+	// registry resolves the plugins used by the config
+	registry *Registry
+	// kubeVersion is the Kubernetes version of the schemas resources are
+	// patched with, and validated against if validateSchemas is set
+	kubeVersion string
+	// validateSchemas validates every resource against the schemas of
+	// kubeVersion
+	validateSchemas bool
+	// originAnnotations adds the origin of each resource to it as an
+	// annotation
+	originAnnotations bool
+	// events records the steps of the build on each resource
+	events bool
 }
 
 type dinghy struct{}
@@ -77,14 +149,44 @@ type dinghy struct{}
 func (d *dinghy) BuildFromConfig(ctx *context.Context, c *types.Config, opts ...Option) (resource.Tree, error) {
 	o := newOptions(opts...)
 
+	// load every plugin before building anything, so that configuration
+	// errors are reported up front instead of halfway through a build
+	mods, err := loadModules(c, o.path, o.registry)
+	if err != nil {
+		setConfigFile(err, o.file)
+		return nil, err
+	}
+	p, err := load(c, mods.register(o.registry))
+	if err != nil {
+		setConfigFile(err, o.file)
+		return nil, err
+	}
+	if o.validateSchemas {
+		p.validations = append(p.validations, validation{
+			validator: &validate.OpenAPI{KubeVersion: o.kubeVersion},
+		})
+	}
+	p.setEnv(types.Env{
+		Context:     ctx,
+		Logger:      ctx.Logger(),
+		Tree:        o.tree,
+		Path:        o.path,
+		KubeVersion: o.kubeVersion,
+		Schemas:     c.Schemas,
+	})
+
 	// build resources
-	for _, r := range c.Resources {
+	for k, r := range c.Resources {
 		// sub-resources, such as other dinghy packages can contain
 		// transformers that should only act on their set of resources,
 		// so we need to provide a new tree so that none of the current
 		// resources are mutated
 		rt := resource.NewTree()
-		if err := d.buildResource(ctx, r, o.path, rt); err != nil {
+		event := resource.Event{File: o.file, Field: fmt.Sprintf("resources[%d]", k), Uses: r}
+		err := o.record(rt, event, func() error {
+			return d.buildResource(ctx, r, o, rt)
+		})
+		if err != nil {
 			return nil, err
 		}
 		if err := resource.CopyTree(o.tree, rt); err != nil {
@@ -92,46 +194,49 @@ func (d *dinghy) BuildFromConfig(ctx *context.Context, c *types.Config, opts ...
 		}
 	}
 
-	for _, r := range c.Overlays {
-		if err := d.buildResource(ctx, r, o.path, o.tree); err != nil {
-			return nil, err
-		}
-	}
-
-	for _, m := range c.Mutations {
-		typed, err := mutate.Get(m.Uses)
-		if err != nil {
-			return nil, err
-		}
-		data, err := yaml.Marshal(m.With)
+	for k, r := range c.Overlays {
+		event := resource.Event{File: o.file, Field: fmt.Sprintf("overlays[%d]", k), Uses: r}
+		err := o.record(o.tree, event, func() error {
+			return d.buildResource(ctx, r, o, o.tree)
+		})
 		if err != nil {
 			return nil, err
 		}
-		d := yaml.NewDecoder(bytes.NewBuffer(data))
-		d.KnownFields(true)
-		if err = d.Decode(typed); err != nil {
-			return nil, err
-		}
-		vis := typed.(resource.Visitor)
+	}
 
-		kinds := make([]schema.GroupVersionKind, 0)
-		for _, kind := range m.Selector.Kinds {
-			kinds = append(kinds, parseKind(kind))
-		}
+	for k, m := range p.mutations {
+		vis := m.visitor
 		if se, ok := vis.(mutate.SideEffectVisitor); ok {
 			vis = mutate.SideEffect(se, o.tree)
 		}
 
-		if err := o.tree.Visit(vis,
-			resource.MatchLabels(m.Selector.MatchLabels),
-			resource.MatchNames(m.Selector.Names...),
-			resource.MatchNamespaces(m.Selector.Namespaces...),
-			resource.MatchKinds(kinds...)); err != nil {
+		spec := c.Mutations[k]
+		event := resource.Event{File: o.file, Field: fmt.Sprintf("mutate[%d]", k), Name: spec.Name, Uses: spec.Uses}
+		err := o.record(o.tree, event, func() error {
+			return keepOrigins(o.tree, func() error {
+				return o.tree.Visit(vis, m.opts...)
+			})
+		})
+		if err != nil {
 			return nil, err
 		}
 	}
-	for _, spec := range c.Generators {
-		sub, err := d.doGenerate(ctx, spec)
+	for k, gen := range p.generators {
+		spec := c.Generators[k]
+		event := resource.Event{File: o.file, Field: fmt.Sprintf("generate[%d]", k), Name: spec.Name, Uses: spec.Uses}
+		sub := resource.NewTree()
+		err := o.record(sub, event, func() error {
+			emitted, err := gen.Emit(ctx)
+			if err != nil {
+				return err
+			}
+			return emitted.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+				if obj.Origin() == nil {
+					obj.SetOrigin(&resource.Origin{ConfiguredIn: o.file, ConfiguredBy: spec.Uses})
+				}
+				return sub.Insert(obj)
+			}))
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -139,12 +244,37 @@ func (d *dinghy) BuildFromConfig(ctx *context.Context, c *types.Config, opts ...
 			return nil, err
 		}
 	}
+	// generated resources with a name suffix hash are named once
+	// everything they could be referenced by is in the tree
+	event := resource.Event{File: o.file, Field: "generate", Uses: "name suffix hash"}
+	if err := o.record(o.tree, event, func() error { return generate.HashNames(o.tree) }); err != nil {
+		return nil, err
+	}
+	if o.originAnnotations {
+		if err := o.tree.Visit(resource.VisitorFunc(addOriginAnnotation)); err != nil {
+			return nil, err
+		}
+	}
+
+	// validations run last, so they see the final form of every resource
+	// in the tree. Violations from every validator are collected before
+	// failing the build
+	report := &dinghyerrors.ErrValidation{}
+	for _, v := range p.validations {
+		vis := validate.Collect(v.validator, report)
+		if err := o.tree.Visit(vis, v.opts...); err != nil {
+			return nil, err
+		}
+	}
+	if !report.Empty() {
+		return nil, report
+	}
 
 	return o.tree, nil
 }
 
-func (d *dinghy) buildResource(ctx *context.Context, r string, root path.Path, tree resource.Tree) error {
-	target := root.Join(r)
+func (d *dinghy) buildResource(ctx *context.Context, r string, o *options, tree resource.Tree) error {
+	target := o.path.Join(r)
 	if !path.IsRelative(r) {
 		parsed, err := path.Parse(r)
 		if err != nil {
@@ -159,48 +289,49 @@ func (d *dinghy) buildResource(ctx *context.Context, r string, root path.Path, t
 	}
 	if isDir {
 		var sub resource.Tree
-		sub, err = d.Build(ctx, target)
+		opts := []Option{WithRegistry(o.registry), withPatchVersion(o.kubeVersion)}
+		if o.events {
+			opts = append(opts, WithEvents())
+		}
+		sub, err = d.Build(ctx, target, opts...)
 		if err != nil {
 			return err
 		}
-		return resource.CopyTree(tree, sub)
+		return sub.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+			if origin := obj.Origin(); origin != nil && o.file != "" {
+				included := *origin
+				included.IncludedBy = append(append([]string(nil), origin.IncludedBy...), o.file)
+				obj.SetOrigin(&included)
+			}
+			return tree.Insert(obj)
+		}))
 	}
 
 	f, err := target.Reader()
 	if err != nil {
 		return err
 	}
-	return resource.InsertFromReader(tree, f)
-}
-
-func (d *dinghy) doGenerate(ctx *context.Context, spec types.GeneratorSpec) (resource.Tree, error) {
-	typed, err := generate.Get(spec.Uses)
-	if err != nil {
-		return nil, err
+	origin := resource.Origin{}
+	origin.Repo, origin.Ref, origin.Path = target.Origin()
+	if o.file != "" {
+		origin.IncludedBy = []string{o.file}
 	}
-	data, err := yaml.Marshal(spec.With)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := yaml.Unmarshal(data, typed); err != nil {
-		return nil, err
-	}
-
-	return typed.(generate.Generator).Emit(ctx)
+	return resource.InsertFromFile(tree, f, origin)
 }
 
 func (d *dinghy) Build(ctx *context.Context, path path.Path, opts ...Option) (resource.Tree, error) {
 	c, err := ReadDinghyFile(path)
 	if err != nil {
+		setConfigFile(err, path.String(DinghyFile))
 		return nil, errors.Wrapf(err, ErrReadDinghyFile)
 	}
-	return d.BuildFromConfig(ctx, c, append(opts, WithPath(path))...)
+	return d.BuildFromConfig(ctx, c, append(opts, WithPath(path), withFile(path.String(DinghyFile)))...)
 }
 
 func newOptions(opts ...Option) *options {
 	o := &options{
-		tree: resource.NewTree(),
+		tree:     resource.NewTree(),
+		registry: DefaultRegistry(),
 	}
 	for _, f := range opts {
 		f(o)
@@ -218,17 +349,3 @@ func ReadDinghyFile(p path.Path) (*types.Config, error) {
 	c := &types.Config{}
 	return c, yaml.NewDecoder(bytes.NewReader(data)).Decode(c)
 }
-
-func parseKind(kind string) schema.GroupVersionKind {
-	parts := strings.Split(kind, "/")
-	switch len(parts) {
-	case 0:
-		return schema.GroupVersionKind{Group: "*", Version: "*", Kind: parts[0]}
-	case 1:
-		return schema.GroupVersionKind{Group: parts[0], Version: "*", Kind: parts[1]}
-	case 2:
-		return schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}
-	default:
-		panic("invalid gvk string")
-	}
-}
@@ -0,0 +1,413 @@
+package build
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/openapi"
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func newMemoryPath(t *testing.T, files map[string]string) path.Path {
+	mem := path.NewMemory()
+	for name, content := range files {
+		qt.Assert(t, mem.WriteFile("app/"+name, []byte(content)), qt.IsNil)
+	}
+	return path.NewPath(mem, "app")
+}
+
+func TestDinghy_Build_Validations(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- configmap.yaml
+validate:
+- uses: builtin.dinghy.dev/requiredLabels
+  with:
+    keys:
+    - team
+- uses: builtin.dinghy.dev/requiredAnnotations
+  with:
+    keys:
+    - owner
+`,
+		"configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: bar
+`,
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	qt.Assert(t, err, qt.IsNotNil)
+
+	var report *errors.ErrValidation
+	qt.Assert(t, err, qt.ErrorAs, &report)
+	qt.Assert(t, report.Violations, qt.DeepEquals, []errors.Violation{
+		{
+			Validator: "builtin.dinghy.dev/requiredLabels",
+			Resource:  "v1.ConfigMap/bar/foo",
+			Message:   `missing required label "team"`,
+		},
+		{
+			Validator: "builtin.dinghy.dev/requiredAnnotations",
+			Resource:  "v1.ConfigMap/bar/foo",
+			Message:   `missing required annotation "owner"`,
+		},
+	})
+}
+
+func TestDinghy_Build_KubeVersion(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- resources.yaml
+`,
+		"resources.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+  - port: http
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: string
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: web
+spec:
+  color: red
+`,
+	})
+
+	// resources aren't validated against a schema by default
+	_, err := New().Build(context.NewContext(false), p)
+	qt.Assert(t, err, qt.IsNil)
+
+	_, err = New().Build(context.NewContext(false), p, WithKubeVersion("1.27"))
+	var report *errors.ErrValidation
+	qt.Assert(t, err, qt.ErrorAs, &report)
+	qt.Assert(t, report.Violations, qt.ContentEquals, []errors.Violation{
+		{
+			Validator: "builtin.dinghy.dev/openapi",
+			Resource:  "v1.Service/web",
+			Message:   "spec.ports[0].port: expected an integer, got a string",
+		},
+		{
+			Validator: "builtin.dinghy.dev/openapi",
+			Resource:  "example.com.v1.Widget/web",
+			Message:   `spec.color: unknown field "color"`,
+		},
+	})
+
+	// a version without schemas isn't validated against another version
+	_, err = New().Build(context.NewContext(false), p, WithKubeVersion("1.26"))
+	qt.Assert(t, err, qt.ErrorIs, openapi.ErrUnknownVersion)
+
+	_, err = New().Build(context.NewContext(false), p, WithKubeVersion("latest"))
+	qt.Assert(t, err, qt.ErrorMatches, `failed to load schemas for builtin.dinghy.dev/openapi: .*`)
+}
+
+func TestDinghy_Build_KubeVersion_Nested(t *testing.T) {
+	// nested builds patch resources with the schemas of the kubernetes
+	// version of the top level build
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- base
+`,
+		"base/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- configmap.yaml
+mutate:
+- uses: builtin.dinghy.dev/strategicMergePatch
+  with:
+    data:
+      port: "9090"
+`,
+		"base/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+`,
+	})
+
+	_, err := New().Build(context.NewContext(false), p, WithKubeVersion("1.27"))
+	qt.Assert(t, err, qt.IsNil)
+
+	_, err = New().Build(context.NewContext(false), p, WithKubeVersion("1.26"))
+	qt.Assert(t, err, qt.ErrorIs, openapi.ErrUnknownVersion)
+	qt.Assert(t, err, qt.ErrorMatches, `failed to load schemas for builtin.dinghy.dev/strategicMergePatch: .*`)
+}
+
+func TestDinghy_Build_Events(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- base
+mutate:
+- name: move
+  uses: builtin.dinghy.dev/metadata/namespace
+  with:
+    name: web
+- uses: builtin.dinghy.dev/metadata/labels
+  with:
+    app.kubernetes.io/name: web
+`,
+		"base/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- configmap.yaml
+mutate:
+- uses: builtin.dinghy.dev/jsonpatch
+  with:
+  - {op: replace, path: /data/port, value: "9090"}
+`,
+		"base/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  port: "8080"
+`,
+	})
+
+	tree, err := New().Build(context.NewContext(false), p, WithEvents())
+	qt.Assert(t, err, qt.IsNil)
+	obj, err := resource.GetResource(tree, resource.Key{GroupVersion: "v1", Kind: "ConfigMap", Namespace: "web", Name: "web"})
+	qt.Assert(t, err, qt.IsNil)
+
+	file, base := p.String(DinghyFile), p.Join("base").String(DinghyFile)
+	qt.Assert(t, obj.Events(), qt.DeepEquals, []resource.Event{
+		{File: base, Field: "resources[0]", Uses: "configmap.yaml", Type: resource.EventCreated},
+		{File: base, Field: "mutate[0]", Uses: "builtin.dinghy.dev/jsonpatch", Type: resource.EventChanged, Paths: []string{"data.port"}},
+		{File: file, Field: "resources[0]", Uses: "base", Type: resource.EventIncluded},
+		{File: file, Field: "mutate[0]", Name: "move", Uses: "builtin.dinghy.dev/metadata/namespace", Type: resource.EventChanged, Paths: []string{"metadata.namespace"}},
+		{File: file, Field: "mutate[1]", Uses: "builtin.dinghy.dev/metadata/labels", Type: resource.EventChanged, Paths: []string{"metadata.labels['app.kubernetes.io/name']"}},
+	})
+
+	// events are only recorded when they're requested
+	tree, err = New().Build(context.NewContext(false), p)
+	qt.Assert(t, err, qt.IsNil)
+	obj, err = resource.GetResource(tree, resource.Key{GroupVersion: "v1", Kind: "ConfigMap", Namespace: "web", Name: "web"})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, obj.Events(), qt.HasLen, 0)
+}
+
+func TestDinghy_Build_OriginAnnotations(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- base
+generate:
+- uses: builtin.dinghy.dev/configMap
+  with:
+    name: env
+    literals: [PORT=8080]
+`,
+		"base/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- resources.yaml
+`,
+		"base/resources.yaml": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`,
+	})
+
+	tree, err := New().Build(context.NewContext(false), p, WithOriginAnnotations())
+	qt.Assert(t, err, qt.IsNil)
+
+	annotations := make(map[string]string)
+	err = tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		annotations[obj.GetKind()] = obj.GetAnnotations()[resource.OriginAnnotation]
+		return nil
+	}))
+	qt.Assert(t, err, qt.IsNil)
+	file, base := p.String(DinghyFile), p.Join("base").String(DinghyFile)
+	qt.Assert(t, annotations, qt.DeepEquals, map[string]string{
+		"ServiceAccount": "path: app/base/resources.yaml\nincludedBy:\n  - " + base + "\n  - " + file + "\n",
+		"Service":        "path: app/base/resources.yaml\ndocumentIndex: 1\nincludedBy:\n  - " + base + "\n  - " + file + "\n",
+		"ConfigMap":      "configuredIn: " + file + "\nconfiguredBy: builtin.dinghy.dev/configMap\n",
+	})
+}
+
+func TestDinghy_Build_Conflict(t *testing.T) {
+	const configMap = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  port: %q
+`
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- base
+- configmap.yaml
+`,
+		"base/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- configmap.yaml
+`,
+		"base/configmap.yaml": fmt.Sprintf(configMap, "8080"),
+		"configmap.yaml":      fmt.Sprintf(configMap, "9090"),
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	qt.Assert(t, err, qt.ErrorIs, resource.ErrResourceConflict)
+	file, base := p.String(DinghyFile), p.Join("base").String(DinghyFile)
+	qt.Assert(t, err, qt.ErrorMatches, ".*"+regexp.QuoteMeta(`v1.ConfigMap/web is in both `+
+		`app/base/configmap.yaml (document 0) included by `+base+`, `+file+` and `+
+		`app/configmap.yaml (document 0) included by `+file))
+}
+
+func TestDinghy_Build_Identical(t *testing.T) {
+	// identical resources from different files aren't a conflict, even
+	// though their origins and events differ
+	const configMap = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  port: "8080"
+`
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- base
+- configmap.yaml
+`,
+		"base/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- configmap.yaml
+`,
+		"base/configmap.yaml": configMap,
+		"configmap.yaml":      configMap,
+	})
+
+	for name, opts := range map[string][]Option{
+		"Default":           nil,
+		"Events":            {WithEvents()},
+		"OriginAnnotations": {WithOriginAnnotations()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tree, err := New().Build(context.NewContext(false), p, opts...)
+			qt.Assert(t, err, qt.IsNil)
+			objs, err := resource.Sorted(tree, resource.SortLegacy)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, objs, qt.HasLen, 1)
+		})
+	}
+}
+
+func TestDinghy_Build_GeneratorFiles(t *testing.T) {
+	// files are read relative to the dinghyfile that declares the
+	// generator, not the root of the build
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- base
+`,
+		"base/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+generate:
+- uses: builtin.dinghy.dev/configMap
+  with:
+    name: web
+    files: [config.json]
+    envs: [app.env]
+- uses: builtin.dinghy.dev/secret
+  with:
+    name: web
+    files: [token]
+`,
+		"base/config.json": `{"debug": true}`,
+		"base/app.env":     "LOG_LEVEL=info\n",
+		"base/token":       "secret",
+	})
+
+	tree, err := New().Build(context.NewContext(false), p)
+	qt.Assert(t, err, qt.IsNil)
+
+	data := make(map[string]any)
+	err = tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		data[obj.GetKind()] = obj.Object["data"]
+		return nil
+	}))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, data, qt.DeepEquals, map[string]any{
+		"ConfigMap": map[string]any{"config.json": `{"debug": true}`, "LOG_LEVEL": "info"},
+		"Secret":    map[string]any{"token": "c2VjcmV0"},
+	})
+}
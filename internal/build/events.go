@@ -0,0 +1,107 @@
+package build
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// record runs a step of the build, and records an event on every
+// resource in the tree that the step created, included or changed if
+// events are recorded. Steps usually change resources in place, but a
+// resource that was replaced by the step, such as by a script, keeps the
+// events of the resource it replaced if it has the same key.
+func (o *options) record(tree resource.Tree, event resource.Event, step func() error) error {
+	if !o.events {
+		return step()
+	}
+	before := make(map[*resource.Object]*resource.Object)
+	byKey := make(map[resource.Key]*resource.Object)
+	err := tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		c := obj.Copy()
+		before[obj] = c
+		byKey[resource.ParseKey(obj)] = c
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+
+	if err := step(); err != nil {
+		return err
+	}
+
+	return tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		old, ok := before[obj]
+		if !ok {
+			if old, ok = byKey[resource.ParseKey(obj)]; ok && len(obj.Events()) == 0 {
+				for _, e := range old.Events() {
+					obj.Record(e)
+				}
+			}
+		}
+		e := event
+		switch {
+		case ok:
+			e.Type = resource.EventChanged
+			e.Paths = resource.ChangedFields(old.Object, obj.Object)
+			if len(e.Paths) == 0 {
+				return nil
+			}
+		case len(obj.Events()) > 0:
+			e.Type = resource.EventIncluded
+		default:
+			e.Type = resource.EventCreated
+		}
+		obj.Record(e)
+		return nil
+	}))
+}
+
+// keepOrigins runs a step of the build that can replace resources in
+// the tree, such as a script. A resource that was replaced keeps the
+// origin of the resource it replaced if it has the same key.
+func keepOrigins(tree resource.Tree, step func() error) error {
+	origins := make(map[resource.Key]*resource.Origin)
+	err := tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if origin := obj.Origin(); origin != nil {
+			origins[resource.ParseKey(obj)] = origin
+		}
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+
+	if err := step(); err != nil {
+		return err
+	}
+
+	return tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if obj.Origin() == nil {
+			if origin, ok := origins[resource.ParseKey(obj)]; ok {
+				obj.SetOrigin(origin)
+			}
+		}
+		return nil
+	}))
+}
+
+// addOriginAnnotation adds the origin of obj to it as an annotation, if
+// the origin is known
+func addOriginAnnotation(obj *resource.Object) error {
+	origin := obj.Origin()
+	if origin == nil {
+		return nil
+	}
+	var value bytes.Buffer
+	e := yaml.NewEncoder(&value)
+	e.SetIndent(2)
+	if err := e.Encode(origin); err != nil {
+		return err
+	}
+	obj.AddAnnotations(map[string]string{resource.OriginAnnotation: value.String()})
+	return nil
+}
@@ -0,0 +1,221 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/decode"
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/generate"
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/script"
+	"github.com/johnhoman/dinghy/internal/types"
+	"github.com/johnhoman/dinghy/internal/validate"
+)
+
+// plugins are the typed plugins referenced by a Config, in the
+// order they're declared
+type plugins struct {
+	generators  []generate.Generator
+	mutations   []mutation
+	validations []validation
+}
+
+type mutation struct {
+	visitor resource.Visitor
+	// opts select the resources that are mutated
+	opts []resource.MatchOption
+}
+
+type validation struct {
+	validator validate.Validator
+	// opts select the resources that are validated
+	opts []resource.MatchOption
+}
+
+// load resolves every plugin referenced by the config and decodes its
+// `with` config into the plugin's typed config. Loading happens before
+// anything is built, and every invalid entry is collected so that
+// all of them are reported at once. Plugins are resolved from the
+// registry r.
+func load(c *types.Config, r *Registry) (*plugins, error) {
+	errs := &dinghyerrors.List{}
+	p := &plugins{}
+	for k, spec := range c.Generators {
+		typed, err := loadPlugin(&pluginRef{
+			kind:  "generator",
+			field: fmt.Sprintf("generate[%d]", k),
+			uses:  spec.Uses,
+			with:  spec.With,
+			node:  spec.Node,
+		}, r.Generators.Get)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		p.generators = append(p.generators, typed.(generate.Generator))
+	}
+	for k, spec := range c.Mutations {
+		typed, err := loadPlugin(&pluginRef{
+			kind:  "mutator",
+			field: fmt.Sprintf("mutate[%d]", k),
+			uses:  spec.Uses,
+			with:  spec.With,
+			node:  spec.Node,
+		}, r.Mutators.Get)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		opts, err := loadSelector(spec, fmt.Sprintf("mutate[%d]", k))
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		p.mutations = append(p.mutations, mutation{
+			visitor: typed.(resource.Visitor),
+			opts:    opts,
+		})
+	}
+	for k, spec := range c.Validations {
+		typed, err := loadPlugin(&pluginRef{
+			kind:  "validator",
+			field: fmt.Sprintf("validate[%d]", k),
+			uses:  spec.Uses,
+			with:  spec.With,
+			node:  spec.Node,
+		}, r.Validators.Get)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		opts, err := loadSelector(spec, fmt.Sprintf("validate[%d]", k))
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		p.validations = append(p.validations, validation{
+			validator: typed.(validate.Validator),
+			opts:      opts,
+		})
+	}
+	return p, errs.Err()
+}
+
+// loadSelector returns the match options of a plugin's selector. field
+// is the path to the spec in the config file.
+func loadSelector(spec types.PluginSpec, field string) ([]resource.MatchOption, error) {
+	opts, err := spec.Selector.MatchOptions()
+	if err != nil {
+		return nil, errorAt(decode.MappingValue(spec.Node, "selector"), field+".selector", err)
+	}
+	return opts, nil
+}
+
+// setEnv sets the build every plugin runs in. Scripts get the parts of
+// it that their javascript host exposes.
+func (p *plugins) setEnv(env types.Env) {
+	host := script.Host{Context: env.Context, Logger: env.Logger, Tree: env.Tree}
+	inject := func(plugin any) {
+		if ea, ok := plugin.(types.EnvAware); ok {
+			ea.SetEnv(env)
+		}
+		if ha, ok := plugin.(script.HostAware); ok {
+			ha.SetHost(host)
+		}
+	}
+	for _, gen := range p.generators {
+		inject(gen)
+	}
+	for _, m := range p.mutations {
+		inject(m.visitor)
+	}
+	for _, v := range p.validations {
+		inject(v.validator)
+	}
+}
+
+// pluginRef is a reference to a plugin from a config file
+type pluginRef struct {
+	// kind is the kind of plugin, e.g. generator
+	kind string
+	// field is the path to the spec in the config file
+	field string
+	uses  string
+	with  any
+	node  *yaml.Node
+}
+
+func loadPlugin(ref *pluginRef, get func(name string) (any, error)) (any, error) {
+	if ref.uses == "" {
+		return nil, ref.errorAt(ref.node, ".uses", errors.New("is a required field"))
+	}
+	typed, err := get(ref.uses)
+	if err != nil {
+		return nil, ref.errorAt(decode.MappingValue(ref.node, "uses"), ".uses",
+			errors.Wrapf(err, "%q", ref.uses))
+	}
+
+	with := decode.MappingValue(ref.node, "with")
+	if ref.node == nil {
+		// the spec was created in code, so there is no node
+		// to decode from
+		err = decodeValue(ref.with, typed)
+	} else if with != nil {
+		err = decode.Node(with, typed, "")
+	}
+	if err != nil {
+		var decodeErr *dinghyerrors.ErrDecodePlugin
+		if !errors.As(err, &decodeErr) {
+			err = &dinghyerrors.ErrDecodePlugin{
+				Kind:   ref.kind,
+				Name:   ref.uses,
+				Schema: decode.Schema(typed),
+				Err:    err,
+			}
+		}
+		return nil, ref.errorAt(with, ".with", err)
+	}
+	if l, ok := typed.(script.Loader); ok {
+		// scripts without any config aren't compiled when they're
+		// decoded
+		if err := l.Load(); err != nil {
+			return nil, ref.errorAt(decode.MappingValue(ref.node, "uses"), ".uses",
+				errors.Wrapf(err, "%q", ref.uses))
+		}
+	}
+	return typed, nil
+}
+
+func (ref *pluginRef) errorAt(node *yaml.Node, field string, err error) error {
+	return errorAt(node, ref.field+field, err)
+}
+
+// decodeValue decodes an arbitrary value into out, failing on any
+// unknown fields
+func decodeValue(value any, out any) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	d := yaml.NewDecoder(bytes.NewBuffer(data))
+	d.KnownFields(true)
+	return d.Decode(out)
+}
+
+// setConfigFile sets the file on every config error in err
+func setConfigFile(err error, file string) {
+	switch e := err.(type) {
+	case *dinghyerrors.List:
+		for _, item := range e.Errors() {
+			setConfigFile(item, file)
+		}
+	case *dinghyerrors.ErrConfig:
+		if e.File == "" {
+			e.File = file
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package build
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
+)
+
+func TestDinghy_Build_LoadErrors(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- does-not-exist.yaml
+generate:
+- uses: builtin.dinghy.dev/template
+  with:
+    src: template
+mutate:
+- uses: builtin.dinghy.dev/does-not-exist
+- with:
+    name: foo
+- uses: builtin.dinghy.dev/metadata/name
+  with:
+    prefix: foo-
+    sufix: -bar
+validate:
+- uses: builtin.dinghy.dev/requiredLabels
+  with:
+    keys: team
+`,
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	qt.Assert(t, err, qt.IsNotNil)
+
+	var list *errors.List
+	qt.Assert(t, err, qt.ErrorAs, &list)
+	qt.Assert(t, list.Errors(), qt.HasLen, 5)
+
+	want := []struct {
+		line   int
+		column int
+		field  string
+	}{
+		{line: 8, column: 5, field: "generate[0].with"},
+		{line: 10, column: 9, field: "mutate[0].uses"},
+		{line: 11, column: 3, field: "mutate[1].uses"},
+		{line: 15, column: 5, field: "mutate[2].with"},
+		{line: 20, column: 5, field: "validate[0].with"},
+	}
+	for k, e := range list.Errors() {
+		var configErr *errors.ErrConfig
+		qt.Assert(t, e, qt.ErrorAs, &configErr)
+		qt.Assert(t, configErr.File, qt.Equals, "app/dinghyfile.yaml")
+		qt.Assert(t, configErr.Line, qt.Equals, want[k].line)
+		qt.Assert(t, configErr.Column, qt.Equals, want[k].column)
+		qt.Assert(t, configErr.Field, qt.Equals, want[k].field)
+	}
+
+	var decodeErr *errors.ErrDecodePlugin
+	qt.Assert(t, list.Errors()[3], qt.ErrorAs, &decodeErr)
+	qt.Assert(t, decodeErr.Kind, qt.Equals, "mutator")
+	qt.Assert(t, decodeErr.Name, qt.Equals, "builtin.dinghy.dev/metadata/name")
+	qt.Assert(t, decodeErr.Schema, qt.IsNotNil)
+	qt.Assert(t, decodeErr.Schema.Properties.Keys(), qt.DeepEquals, []string{"prefix", "suffix", "references"})
+}
+
+func TestDinghy_BuildFromConfig_LoadErrors(t *testing.T) {
+	_, err := New().BuildFromConfig(context.NewContext(false), &types.Config{
+		Mutations: []types.MutationSpec{{
+			Uses: "builtin.dinghy.dev/metadata/name",
+			With: map[string]any{"sufix": "-bar"},
+		}},
+	})
+	var configErr *errors.ErrConfig
+	qt.Assert(t, err, qt.ErrorAs, &configErr)
+	qt.Assert(t, configErr.Field, qt.Equals, "mutate[0].with")
+}
+
+func TestDinghy_Build_SelectorErrors(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `apiVersion: dinghy.dev/v1alpha1
+kind: Config
+mutate:
+- uses: builtin.dinghy.dev/metadata/annotations
+  selector:
+    names: ['/web(/']
+  with:
+    team: web
+validate:
+- uses: builtin.dinghy.dev/requiredLabels
+  selector:
+    exclude:
+      scope: Global
+  with:
+    keys: [team]
+`,
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	var list *errors.List
+	qt.Assert(t, err, qt.ErrorAs, &list)
+	qt.Assert(t, list.Errors(), qt.HasLen, 2)
+
+	want := []struct {
+		line  int
+		field string
+		err   string
+	}{
+		{line: 6, field: "mutate[0].selector", err: `.*names: "/web\(/": error parsing regexp.*`},
+		{line: 12, field: "validate[0].selector", err: `.*exclude: scope: "Global" must be Namespaced or Cluster`},
+	}
+	for k, e := range list.Errors() {
+		var configErr *errors.ErrConfig
+		qt.Assert(t, e, qt.ErrorAs, &configErr)
+		qt.Assert(t, configErr.Line, qt.Equals, want[k].line)
+		qt.Assert(t, configErr.Field, qt.Equals, want[k].field)
+		qt.Assert(t, e, qt.ErrorMatches, want[k].err)
+	}
+}
+
+// envMutator records the Env it's given. The registry creates a new
+// mutator for each config, so the Env is kept outside of it.
+type envMutator struct{}
+
+var mutatorEnv types.Env
+
+func (m *envMutator) Name() string                     { return "example.com/env" }
+func (m *envMutator) Visit(obj *resource.Object) error { return nil }
+func (m *envMutator) SetEnv(env types.Env)             { mutatorEnv = env }
+
+func TestDinghy_Build_SetEnv(t *testing.T) {
+	r := DefaultRegistry()
+	r.RegisterMutator(&envMutator{})
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+mutate:
+- uses: example.com/env
+`,
+	})
+	ctx := context.NewContext(false)
+	tree := resource.NewTree()
+	_, err := New().Build(ctx, p, WithRegistry(r), WithTree(tree))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, mutatorEnv.Context, qt.Equals, ctx)
+	qt.Assert(t, mutatorEnv.Logger, qt.Equals, ctx.Logger())
+	qt.Assert(t, mutatorEnv.Tree, qt.Equals, tree)
+	qt.Assert(t, mutatorEnv.Path.String(), qt.Equals, p.String())
+}
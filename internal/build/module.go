@@ -0,0 +1,124 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/decode"
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/generate"
+	"github.com/johnhoman/dinghy/internal/mutate"
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/script"
+	"github.com/johnhoman/dinghy/internal/types"
+	"github.com/johnhoman/dinghy/internal/validate"
+)
+
+// module is an external javascript file that provides plugins, which
+// can be referenced by the module name
+type module struct {
+	name    string
+	source  string
+	timeout time.Duration
+}
+
+// options are the script options for the module
+func (m *module) options() []script.Option {
+	return []script.Option{script.WithTimeout(m.timeout)}
+}
+
+// modules are the modules declared by a Config, keyed by name. A module
+// can be used as a generator, mutator or validator, depending on which
+// of the generate, mutate and validate functions it declares.
+type modules map[string]*module
+
+// register returns a copy of the registry with every module registered
+// as a generator, mutator and validator. Modules can only use names that
+// aren't already registered, so they never replace a plugin.
+func (m modules) register(r *Registry) *Registry {
+	r = r.Clone()
+	for _, mod := range m {
+		mod := mod
+		r.Generators.RegisterFunc(mod.name, func() any {
+			return generate.NewScript(mod.name, mod.source, mod.options()...)
+		})
+		r.Mutators.RegisterFunc(mod.name, func() any {
+			return mutate.NewScript(mod.name, mod.source, mod.options()...)
+		})
+		r.Validators.RegisterFunc(mod.name, func() any {
+			return validate.NewScript(mod.name, mod.source, mod.options()...)
+		})
+	}
+	return r
+}
+
+// loadModules fetches the source of every module declared in the config,
+// checks it against the module checksum, and compiles it. Relative
+// sources are read relative to root. Module names can't conflict with
+// any plugin in the registry.
+func loadModules(c *types.Config, root path.Path, r *Registry) (modules, error) {
+	errs := &dinghyerrors.List{}
+	rv := make(modules)
+	for k, m := range c.Modules {
+		field := fmt.Sprintf("modules[%d]", k)
+		if m.Name == "" {
+			errs.Append(errorAt(m.Node, field+".name", errors.New("is a required field")))
+			continue
+		}
+		if _, ok := rv[m.Name]; ok || r.Has(m.Name) {
+			errs.Append(errorAt(decode.MappingValue(m.Node, "name"), field+".name",
+				errors.Errorf("%q is already registered", m.Name)))
+			continue
+		}
+		if m.Source == "" {
+			errs.Append(errorAt(m.Node, field+".source", errors.New("is a required field")))
+			continue
+		}
+		data, err := path.ReadSource(string(m.Source), root)
+		if err != nil {
+			errs.Append(errorAt(decode.MappingValue(m.Node, "source"), field+".source", err))
+			continue
+		}
+		if err := checkSum(data, m.Checksum); err != nil {
+			errs.Append(errorAt(decode.MappingValue(m.Node, "checksum"), field+".checksum", err))
+			continue
+		}
+		mod := &module{name: m.Name, source: string(data), timeout: m.Timeout}
+		// compile the module, so that syntax errors are reported here
+		// rather than by every plugin that uses it
+		if _, err := script.Compile(mod.source, append(mod.options(), script.WithName(mod.name))...); err != nil {
+			errs.Append(errorAt(decode.MappingValue(m.Node, "source"), field+".source", err))
+			continue
+		}
+		rv[m.Name] = mod
+	}
+	return rv, errs.Err()
+}
+
+// checkSum compares the sha256 sum of data with the expected hex encoded
+// sum. An empty sum isn't checked.
+func checkSum(data []byte, sum string) error {
+	if sum == "" {
+		return nil
+	}
+	sum = strings.TrimPrefix(sum, "sha256:")
+	got := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(got[:]), sum) {
+		return errors.Errorf("checksum mismatch: expected sha256 %s, got %s", sum, hex.EncodeToString(got[:]))
+	}
+	return nil
+}
+
+func errorAt(node *yaml.Node, field string, err error) error {
+	if node == nil {
+		// configs created in code don't have a position
+		return &dinghyerrors.ErrConfig{Field: field, Err: err}
+	}
+	return decode.NodeError(node, field, err)
+}
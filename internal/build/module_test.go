@@ -0,0 +1,220 @@
+package build
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+const namespaceModule = `
+function mutate(obj, config) {
+  obj.metadata.namespace = config.namespace
+}
+`
+
+func TestDinghy_Build_ModuleChecksumMismatch(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+modules:
+- name: set-namespace
+  source: modules/namespace.js
+  checksum: sha256:dcd4a3d1d8d2f3a4b5f5c9a5eb7ec8b2c2a70d9aa5a33a92d8be5e6b7cf07bc5
+resources:
+- configmap.yaml
+mutate:
+- uses: set-namespace
+  with:
+    namespace: bar
+`,
+		"modules/namespace.js": namespaceModule,
+		"configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`,
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	var configErr *errors.ErrConfig
+	qt.Assert(t, err, qt.ErrorAs, &configErr)
+	qt.Assert(t, configErr.Field, qt.Equals, "modules[0].checksum")
+	qt.Assert(t, configErr.Line, qt.Equals, 7)
+	qt.Assert(t, err, qt.ErrorMatches, `(?s).*checksum mismatch.*`)
+}
+
+func TestDinghy_Build_ModulesWithoutChecksum(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+modules:
+- name: set-namespace
+  source: modules/namespace.js
+resources:
+- configmap.yaml
+mutate:
+- uses: set-namespace
+  with:
+    namespace: bar
+`,
+		"modules/namespace.js": namespaceModule,
+		"configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`,
+	})
+
+	tree, err := New().Build(context.NewContext(false), p)
+	qt.Assert(t, err, qt.IsNil)
+	_, err = resource.GetResource(tree, resource.Key{
+		GroupVersion: "v1",
+		Kind:         "ConfigMap",
+		Name:         "foo",
+		Namespace:    "bar",
+	})
+	qt.Assert(t, err, qt.IsNil)
+}
+
+func TestCheckSum(t *testing.T) {
+	data := []byte("function mutate(obj, config) {}\n")
+	sum := "5328385efbeeabd51cca965647743cf39bda126d0c171d05ab839cfe145a1e79"
+	qt.Assert(t, checkSum(data, ""), qt.IsNil)
+	qt.Assert(t, checkSum(data, sum), qt.IsNil)
+	qt.Assert(t, checkSum(data, "sha256:"+sum), qt.IsNil)
+	qt.Assert(t, checkSum([]byte("function mutate() {}"), sum), qt.IsNotNil)
+}
+
+func TestDinghy_Build_ModuleStages(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+modules:
+- name: service-accounts
+  source: modules/service-accounts.js
+generate:
+- uses: service-accounts
+  with:
+    names: [foo, bar]
+validate:
+- uses: service-accounts
+`,
+		"modules/service-accounts.js": `
+function generate(config) {
+  return config.names.map(name => ({apiVersion: "v1", kind: "ServiceAccount", metadata: {name: name}}))
+}
+
+function validate(obj, config) {
+  if (obj.metadata.name === "bar") {
+    return ["bar is reserved"]
+  }
+}
+`,
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	var report *errors.ErrValidation
+	qt.Assert(t, err, qt.ErrorAs, &report)
+	qt.Assert(t, report.Violations, qt.DeepEquals, []errors.Violation{{
+		Validator: "service-accounts",
+		Resource:  "v1.ServiceAccount/bar",
+		Message:   "bar is reserved",
+	}})
+}
+
+func TestDinghy_Build_ModuleTimeout(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+modules:
+- name: forever
+  source: modules/forever.js
+  timeout: 50ms
+resources:
+- configmap.yaml
+mutate:
+- uses: forever
+`,
+		"modules/forever.js": `
+function mutate(obj, config) {
+  while (true) {}
+}
+`,
+		"configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`,
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	var scriptErr *errors.ErrScript
+	qt.Assert(t, err, qt.ErrorAs, &scriptErr)
+	qt.Assert(t, scriptErr.Script, qt.Equals, "forever")
+	qt.Assert(t, err, qt.ErrorMatches, `script forever:\d+:\d+: timed out after 50ms`)
+}
+
+func TestDinghy_Build_ModuleMissingFunction(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+modules:
+- name: set-namespace
+  source: modules/namespace.js
+resources:
+- configmap.yaml
+validate:
+- uses: set-namespace
+`,
+		"modules/namespace.js": namespaceModule,
+		"configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`,
+	})
+
+	// the module doesn't declare validate, which is reported when the
+	// config is loaded rather than when the first resource is validated
+	_, err := New().Build(context.NewContext(false), p)
+	var configErr *errors.ErrConfig
+	qt.Assert(t, err, qt.ErrorAs, &configErr)
+	qt.Assert(t, configErr.Field, qt.Equals, "validate[0].uses")
+	qt.Assert(t, configErr.Line, qt.Equals, 10)
+	qt.Assert(t, err, qt.ErrorMatches, `(?s).*"set-namespace": validate function not found.*`)
+}
+
+func TestDinghy_Build_ModuleSyntaxError(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+modules:
+- name: set-namespace
+  source: modules/namespace.js
+`,
+		"modules/namespace.js": "function mutate(obj, config) {\n",
+	})
+
+	_, err := New().Build(context.NewContext(false), p)
+	var configErr *errors.ErrConfig
+	qt.Assert(t, err, qt.ErrorAs, &configErr)
+	qt.Assert(t, configErr.Field, qt.Equals, "modules[0].source")
+	qt.Assert(t, configErr.Line, qt.Equals, 6)
+	var scriptErr *errors.ErrScript
+	qt.Assert(t, err, qt.ErrorAs, &scriptErr)
+	qt.Assert(t, scriptErr.Script, qt.Equals, "set-namespace")
+}
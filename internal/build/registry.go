@@ -0,0 +1,66 @@
+package build
+
+import (
+	"github.com/johnhoman/dinghy/internal/generate"
+	"github.com/johnhoman/dinghy/internal/mutate"
+	"github.com/johnhoman/dinghy/internal/validate"
+)
+
+// Registry holds the plugins a build can use. Each build resolves the
+// `uses` of its generators, mutators and validators from its own
+// registry, so builds in the same process can use different plugins.
+type Registry struct {
+	Generators *generate.Registry
+	Mutators   *mutate.Registry
+	Validators *validate.Registry
+}
+
+// NewRegistry returns a registry without any plugins
+func NewRegistry() *Registry {
+	return &Registry{
+		Generators: generate.NewRegistry(),
+		Mutators:   mutate.NewRegistry(),
+		Validators: validate.NewRegistry(),
+	}
+}
+
+// DefaultRegistry returns a copy of the registry of builtin plugins,
+// which can be extended without changing the builtins
+func DefaultRegistry() *Registry {
+	return &Registry{
+		Generators: generate.Default(),
+		Mutators:   mutate.Default(),
+		Validators: validate.Default(),
+	}
+}
+
+// Clone returns a copy of the registry. Registering plugins on the
+// copy doesn't change the original.
+func (r *Registry) Clone() *Registry {
+	return &Registry{
+		Generators: r.Generators.Clone(),
+		Mutators:   r.Mutators.Clone(),
+		Validators: r.Validators.Clone(),
+	}
+}
+
+// Has reports whether a generator, mutator or validator is
+// registered under name
+func (r *Registry) Has(name string) bool {
+	return r.Generators.Has(name) || r.Mutators.Has(name) || r.Validators.Has(name)
+}
+
+// RegisterGenerator registers a generator under its name
+func (r *Registry) RegisterGenerator(g generate.Generator) {
+	r.Generators.Register(g)
+}
+
+// RegisterMutator registers a mutator under its name
+func (r *Registry) RegisterMutator(m mutate.Mutator) {
+	r.Mutators.Register(m)
+}
+
+// RegisterValidator registers a validator under its name
+func (r *Registry) RegisterValidator(v validate.Validator) {
+	r.Validators.Register(v)
+}
@@ -0,0 +1,103 @@
+package build
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/mutate"
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
+)
+
+// teamLabel is a mutator that's only registered by the tests
+type teamLabel struct {
+	Team string `yaml:"team"`
+}
+
+func (t *teamLabel) Name() string { return "example.com/teamLabel" }
+
+func (t *teamLabel) Visit(obj *resource.Object) error {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels["example.com/team"] = t.Team
+	obj.SetLabels(labels)
+	return nil
+}
+
+var _ mutate.Mutator = &teamLabel{}
+
+func TestDinghy_BuildFromConfig_WithRegistry(t *testing.T) {
+	c := &types.Config{
+		Mutations: []types.MutationSpec{{
+			Uses: "example.com/teamLabel",
+			With: map[string]any{"team": "platform"},
+		}},
+	}
+	tree := resource.NewTree()
+	qt.Assert(t, tree.Insert(resource.Unstructured(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "foo"},
+	})), qt.IsNil)
+
+	r := DefaultRegistry()
+	r.RegisterMutator(&teamLabel{})
+	got, err := New().BuildFromConfig(context.NewContext(false), c, WithTree(tree), WithRegistry(r))
+	qt.Assert(t, err, qt.IsNil)
+	obj, err := resource.GetResource(got, resource.Key{GroupVersion: "v1", Kind: "ConfigMap", Name: "foo"})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, obj.GetLabels(), qt.DeepEquals, map[string]string{"example.com/team": "platform"})
+
+	// the mutator was only registered on r, so other builds can't use it
+	_, err = New().BuildFromConfig(context.NewContext(false), c)
+	qt.Assert(t, err, qt.ErrorMatches, `(?s)mutate\[0\]\.uses: "example.com/teamLabel": mutator not found`)
+	qt.Assert(t, DefaultRegistry().Has("example.com/teamLabel"), qt.IsFalse)
+}
+
+func TestDinghy_Build_NestedRegistry(t *testing.T) {
+	p := newMemoryPath(t, map[string]string{
+		"dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- nested
+`,
+		"nested/dinghyfile.yaml": `
+apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- configmap.yaml
+mutate:
+- uses: example.com/teamLabel
+  with:
+    team: data
+`,
+		"nested/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`,
+	})
+
+	r := DefaultRegistry()
+	r.RegisterMutator(&teamLabel{})
+	got, err := New().Build(context.NewContext(false), p, WithRegistry(r))
+	qt.Assert(t, err, qt.IsNil)
+	obj, err := resource.GetResource(got, resource.Key{GroupVersion: "v1", Kind: "ConfigMap", Name: "foo"})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, obj.GetLabels(), qt.DeepEquals, map[string]string{"example.com/team": "data"})
+}
+
+func TestRegistry_Clone(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterMutator(&teamLabel{})
+	c := r.Clone()
+	c.RegisterMutator(&mutate.Labels{})
+	qt.Assert(t, r.Mutators.Names(), qt.DeepEquals, []string{"example.com/teamLabel"})
+	qt.Assert(t, c.Mutators.Names(), qt.DeepEquals, []string{"builtin.dinghy.dev/metadata/labels", "example.com/teamLabel"})
+}
@@ -3,6 +3,8 @@ package context
 import (
 	"context"
 	"sync"
+
+	"github.com/johnhoman/dinghy/internal/logging"
 )
 
 type Context struct {
@@ -11,6 +13,21 @@ type Context struct {
 	values map[string]any
 	mu     sync.RWMutex
 	debug  bool
+	logger *logging.Logger
+}
+
+// Logger returns the logger for the build
+func (ctx *Context) Logger() *logging.Logger {
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+	return ctx.logger
+}
+
+// SetLogger replaces the logger for the build
+func (ctx *Context) SetLogger(logger *logging.Logger) {
+	ctx.mu.Lock()
+	ctx.logger = logger
+	ctx.mu.Unlock()
 }
 
 func (ctx *Context) SetRoot(root string) {
@@ -34,5 +51,7 @@ func NewContext(debug bool) *Context {
 		Context: context.Background(),
 		values:  make(map[string]any),
 		mu:      sync.RWMutex{},
+		debug:   debug,
+		logger:  logging.New(),
 	}
 }
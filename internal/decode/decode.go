@@ -0,0 +1,204 @@
+// Package decode decodes YAML nodes while keeping track of the position
+// of each node, so that errors can point at the offending line and column
+// of a config file.
+package decode
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
+)
+
+var (
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+	reflector = &jsonschema.Reflector{
+		Anonymous:                  true,
+		ExpandedStruct:             true,
+		DoNotReference:             true,
+		RequiredFromJSONSchemaTags: true,
+		// plugin configs are tagged for yaml, and the yaml keys are
+		// the lower camel case field names
+		KeyNamer: func(s string) string {
+			return strings.ToLower(s[:1]) + s[1:]
+		},
+	}
+)
+
+// Schema returns the JSON schema of a plugin's typed config. Types that
+// decode themselves should implement JSONSchema() *jsonschema.Schema
+// to describe the config they accept.
+func Schema(v any) *jsonschema.Schema {
+	if s, ok := v.(interface{ JSONSchema() *jsonschema.Schema }); ok {
+		return s.JSONSchema()
+	}
+	return reflector.Reflect(v)
+}
+
+// Node decodes node into out, reporting any keys that don't map to
+// a field of out. yaml.Node.Decode doesn't support the KnownFields flag,
+// and decoding through an intermediate document loses the position of
+// each key, so the known fields check is done here against the node.
+// Every error returned is an *errors.ErrConfig pointing at the offending
+// node. field is the path of node in the config file, and is used as
+// the prefix of the reported field paths.
+func Node(node *yaml.Node, out any, field string) error {
+	errs := &dinghyerrors.List{}
+	checkKnownFields(node, reflect.TypeOf(out), field, errs)
+	if !errs.Empty() {
+		return errs
+	}
+	if err := node.Decode(out); err != nil {
+		switch err.(type) {
+		case *dinghyerrors.ErrConfig, *dinghyerrors.List:
+			// the error came from a type that decodes itself with
+			// Node, so it already has a position
+			return err
+		}
+		return NodeError(node, field, err)
+	}
+	return nil
+}
+
+// NodeError returns an error located at the provided node
+func NodeError(node *yaml.Node, field string, err error) error {
+	return &dinghyerrors.ErrConfig{
+		Line:   node.Line,
+		Column: node.Column,
+		Field:  field,
+		Err:    err,
+	}
+}
+
+// MappingValue returns the value of key in a mapping node. If the node
+// isn't a mapping, or the key doesn't exist, nil is returned.
+func MappingValue(node *yaml.Node, key string) *yaml.Node {
+	node = resolve(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for k := 0; k+1 < len(node.Content); k += 2 {
+		if node.Content[k].Value == key {
+			return node.Content[k+1]
+		}
+	}
+	return nil
+}
+
+// SequenceItem returns the item at index of a sequence node. If the node
+// isn't a sequence, or the index is out of range, nil is returned.
+func SequenceItem(node *yaml.Node, index int) *yaml.Node {
+	node = resolve(node)
+	if node == nil || node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+		return nil
+	}
+	return node.Content[index]
+}
+
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch {
+		case node.Kind == yaml.DocumentNode && len(node.Content) > 0:
+			node = node.Content[0]
+		case node.Kind == yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+func checkKnownFields(node *yaml.Node, t reflect.Type, field string, errs *dinghyerrors.List) {
+	node = resolve(node)
+	if node == nil || t == nil {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Implements(unmarshalerType) || reflect.PointerTo(t).Implements(unmarshalerType) {
+		// the type decodes itself
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			// type mismatches are reported by yaml when decoding
+			return
+		}
+		fields := structFields(t)
+		for k := 0; k+1 < len(node.Content); k += 2 {
+			key, value := node.Content[k], node.Content[k+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				errs.Append(NodeError(key, join(field, key.Value),
+					errors.Errorf("unknown field %q", key.Value)))
+				continue
+			}
+			checkKnownFields(value, ft, join(field, key.Value), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for k, item := range node.Content {
+			checkKnownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", field, k), errs)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for k := 0; k+1 < len(node.Content); k += 2 {
+			checkKnownFields(node.Content[k+1], t.Elem(), join(field, node.Content[k].Value), errs)
+		}
+	}
+}
+
+// structFields returns the fields of a struct by the key yaml
+// uses to decode them
+func structFields(t reflect.Type) map[string]reflect.Type {
+	rv := make(map[string]reflect.Type)
+	for k := 0; k < t.NumField(); k++ {
+		f := t.Field(k)
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(opts, "inline") {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for key, value := range structFields(ft) {
+					rv[key] = value
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		rv[name] = f.Type
+	}
+	return rv
+}
+
+func join(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
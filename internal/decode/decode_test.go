@@ -0,0 +1,75 @@
+package decode
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/errors"
+)
+
+type nested struct {
+	Name string `yaml:"name"`
+}
+
+type config struct {
+	Items  []nested          `yaml:"items"`
+	Labels map[string]string `yaml:"labels"`
+	Inline nested            `yaml:",inline"`
+	Any    any               `yaml:"any"`
+}
+
+func parse(t *testing.T, data string) *yaml.Node {
+	node := &yaml.Node{}
+	qt.Assert(t, yaml.Unmarshal([]byte(data), node), qt.IsNil)
+	return node
+}
+
+func TestNode(t *testing.T) {
+	c := &config{}
+	err := Node(parse(t, `
+name: foo
+items:
+- name: bar
+labels:
+  app: baz
+any:
+  whatever: true
+`), c, "")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, c.Inline.Name, qt.Equals, "foo")
+	qt.Assert(t, c.Items, qt.DeepEquals, []nested{{Name: "bar"}})
+	qt.Assert(t, c.Labels, qt.DeepEquals, map[string]string{"app": "baz"})
+}
+
+func TestNode_UnknownFields(t *testing.T) {
+	err := Node(parse(t, `
+nme: foo
+items:
+- name: bar
+- nam: baz
+`), &config{}, "with")
+
+	var list *errors.List
+	qt.Assert(t, err, qt.ErrorAs, &list)
+	qt.Assert(t, list.Errors(), qt.HasLen, 2)
+	qt.Assert(t, list.Errors()[0], qt.ErrorMatches, `2:1: with.nme: unknown field "nme"`)
+	qt.Assert(t, list.Errors()[1], qt.ErrorMatches, `5:3: with.items\[1\].nam: unknown field "nam"`)
+}
+
+func TestNode_TypeError(t *testing.T) {
+	err := Node(parse(t, `
+items: foo
+`), &config{}, "with")
+
+	var configErr *errors.ErrConfig
+	qt.Assert(t, err, qt.ErrorAs, &configErr)
+	qt.Assert(t, configErr.Line, qt.Equals, 2)
+	qt.Assert(t, configErr.Field, qt.Equals, "with")
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema(&nested{})
+	qt.Assert(t, s.Properties.Keys(), qt.DeepEquals, []string{"name"})
+}
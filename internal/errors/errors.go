@@ -15,9 +15,9 @@ import (
 const GroupName = "builtin.dinghy.dev"
 
 // ErrPatchStrategicMergeUnregisteredSchema occurs when a provided resource
-// doesn't have a struct type registered scheme.Scheme. The struct should
-// contain the tags that identify fields to merge on, such as the `name`
-// field of a container
+// doesn't have a struct type registered scheme.Scheme or an OpenAPI schema.
+// The struct should contain the tags that identify fields to merge on, such
+// as the `name` field of a container
 type ErrPatchStrategicMergeUnregisteredSchema struct {
 	GroupVersionKind schema.GroupVersionKind
 	Name             string
@@ -37,7 +37,15 @@ A strategicMergePatch requires a schema that contains merge keys used
 to identify merge points of a resource, for example, the "name" attribute
 of a container identifies a container in an array of containers. Without
 the schema, a strategicMergePatch is no different than a merge patch.
-Please consider using one of the following mutators instead
+
+Custom resources are patched with the schema of their CustomResourceDefinition,
+either from the build or from a file listed in the schemas section of the
+dinghyfile, for example
+
+   schemas:
+   - crds/rollouts.yaml
+
+Otherwise, please consider using one of the following mutators instead
 
 * %[1]s/patch - merge a single value using an array of field paths as a target 
    Examples
@@ -145,6 +153,9 @@ func (l *List) First() error {
 }
 
 func (l *List) Append(err error) {
+	if err == nil {
+		return
+	}
 	if in, ok := err.(*List); ok {
 		l.Extend(in)
 		return
@@ -152,29 +163,88 @@ func (l *List) Append(err error) {
 	l.errs = append(l.errs, err)
 }
 
+// Errors returns every error in the list
+func (l *List) Errors() []error {
+	return l.errs
+}
+
+func (l *List) Unwrap() []error {
+	return l.errs
+}
+
+// Err returns the list if it has any errors, otherwise nil
+func (l *List) Err() error {
+	if l.Empty() {
+		return nil
+	}
+	return l
+}
+
 func (l *List) Extend(in *List) {
 	for _, e := range in.errs {
 		l.Append(e)
 	}
 }
 
-type ErrDecodeGenerator struct {
+// ErrDecodePlugin occurs when the `with` config of a generator, mutator or
+// validator can't be decoded into the plugin's typed config. The schema
+// of the typed config is included to help fix the config.
+type ErrDecodePlugin struct {
+	// Kind is the kind of plugin, e.g. generator, mutator or validator
+	Kind   string
 	Name   string
 	Schema *jsonschema.Schema
 	Err    error
 }
 
-func (err ErrDecodeGenerator) Error() string {
+func (err ErrDecodePlugin) Error() string {
+	kind := err.Kind
+	if kind == "" {
+		kind = "plugin"
+	}
 	data, _ := json.MarshalIndent(err.Schema, "", "  ")
 	return fmt.Sprintf(`
-The generator %q could not be decoded into it's typed config
+The %s %q could not be decoded into it's typed config
 
 Schema: %s
 
 Caused by: %s
-`, err.Name, string(data), fmt.Sprintf(err.Err.Error()))
+`, kind, err.Name, string(data), err.Err.Error())
+}
+
+func (err ErrDecodePlugin) Unwrap() error { return err.Err }
+
+// ErrConfig occurs when an entry in a config file is invalid. Line and
+// Column locate the offending YAML node in File.
+type ErrConfig struct {
+	File   string
+	Line   int
+	Column int
+	// Field is the path to the invalid entry, e.g. mutate[1].uses
+	Field string
+	Err   error
+}
+
+func (err *ErrConfig) Error() string {
+	parts := make([]string, 0, 3)
+	loc := err.File
+	if err.Line > 0 {
+		loc = fmt.Sprintf("%d:%d", err.Line, err.Column)
+		if err.File != "" {
+			loc = err.File + ":" + loc
+		}
+	}
+	if loc != "" {
+		parts = append(parts, loc)
+	}
+	if err.Field != "" {
+		parts = append(parts, err.Field)
+	}
+	return strings.Join(append(parts, err.Err.Error()), ": ")
 }
 
+func (err *ErrConfig) Unwrap() error { return err.Err }
+
 type ErrParseSourcePath struct {
 	Path string
 	Err  error
@@ -232,3 +302,71 @@ Patch:
 Error caused by: %[4]s
 `, name, string(objBytes), string(patchBytes), e.Err)
 }
+
+// Violation is a single rule violation reported by a validator
+type Violation struct {
+	// Validator is the name of the validator that reported the violation
+	Validator string
+	// Resource identifies the resource that violates the rule
+	Resource string
+	// Message describes the violation
+	Message string
+}
+
+// ErrValidation occurs when one or more resources in the build
+// violate a validation rule. All violations are collected before the
+// error is returned so that every problem can be reported at once.
+type ErrValidation struct {
+	Violations []Violation
+}
+
+func (e *ErrValidation) Error() string {
+	order := make([]string, 0)
+	byResource := make(map[string][]Violation)
+	for _, v := range e.Violations {
+		if _, ok := byResource[v.Resource]; !ok {
+			order = append(order, v.Resource)
+		}
+		byResource[v.Resource] = append(byResource[v.Resource], v)
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "\nValidation failed with %d violation(s)\n", len(e.Violations))
+	for _, res := range order {
+		fmt.Fprintf(buf, "\n  %s\n", res)
+		for _, v := range byResource[res] {
+			fmt.Fprintf(buf, "    - %s: %s\n", v.Validator, v.Message)
+		}
+	}
+	return buf.String()
+}
+
+func (e *ErrValidation) Empty() bool {
+	return len(e.Violations) == 0
+}
+
+func (e *ErrValidation) Append(v ...Violation) {
+	e.Violations = append(e.Violations, v...)
+}
+
+// ErrScript occurs when a script throws an exception, fails to compile
+// or runs out of time. Line and Column locate where the error was thrown
+// in the script, and are zero if the position isn't known.
+type ErrScript struct {
+	// Script is the name of the script, e.g. the module name
+	Script  string
+	Line    int
+	Column  int
+	Message string
+	Err     error
+}
+
+func (err *ErrScript) Error() string {
+	loc := err.Script
+	if err.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", loc, err.Line, err.Column)
+	}
+	return fmt.Sprintf("script %s: %s", loc, err.Message)
+}
+
+func (err *ErrScript) Unwrap() error { return err.Err }
@@ -55,6 +55,60 @@ type FieldPath struct {
 	fieldPath string
 }
 
+// GetValue returns the value at the field path. If any of the fields
+// along the path aren't set, false is returned.
+func (fp *FieldPath) GetValue(m map[string]any) (any, bool, error) {
+	var current any = m
+	for _, index := range fp.indexes {
+		switch index.it {
+		case IndexTypeMapKey:
+			mapping, ok := current.(map[string]any)
+			if !ok {
+				return nil, false, errors.Errorf("expected type `map[string]any{}`, got `%T`", current)
+			}
+			v, ok := mapping[index.index]
+			if !ok {
+				return nil, false, nil
+			}
+			current = v
+		case IndexTypeArrayIndex, IndexTypeQuery:
+			it, ok := current.([]any)
+			if !ok {
+				return nil, false, errors.Errorf("expected type `[]any`, got `%T`", current)
+			}
+			if index.it == IndexTypeArrayIndex {
+				rank, err := strconv.Atoi(index.index)
+				if err != nil {
+					return nil, false, errors.Wrapf(err, "failed to convert index to int: %q", index.index)
+				}
+				if rank >= len(it) {
+					return nil, false, nil
+				}
+				current = it[rank]
+				continue
+			}
+			var match any
+			for _, e := range it {
+				m, ok := e.(map[string]any)
+				if !ok {
+					return nil, false, errors.Errorf("expected type map[string]any, got %T", e)
+				}
+				if v, ok := m[index.index]; ok && v == index.query.argument {
+					match = m
+					break
+				}
+			}
+			if match == nil {
+				return nil, false, nil
+			}
+			current = match
+		default:
+			panic("BUG: there are no other types")
+		}
+	}
+	return current, true, nil
+}
+
 func (fp *FieldPath) SetValue(m map[string]any, value any) error {
 	return fp.MergeValue(m, value, false)
 }
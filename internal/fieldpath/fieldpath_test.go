@@ -99,6 +99,53 @@ func TestFieldPath_SetValue(t *testing.T) {
 	}
 }
 
+func TestFieldPath_GetValue(t *testing.T) {
+	in := map[string]any{
+		"spec": map[string]any{
+			"containers": []any{
+				map[string]any{"name": "main", "image": "nginx"},
+				map[string]any{"name": "sidecar", "image": "envoy"},
+			},
+		},
+	}
+	cases := map[string]struct {
+		fieldPath string
+		value     any
+		found     bool
+	}{
+		"GetsAValueInAMap": {
+			fieldPath: "spec.containers[0].name",
+			value:     "main",
+			found:     true,
+		},
+		"GetsAValueByQuery": {
+			fieldPath: "spec.containers[name=sidecar].image",
+			value:     "envoy",
+			found:     true,
+		},
+		"MissingKey": {
+			fieldPath: "spec.replicas",
+		},
+		"IndexOutOfRange": {
+			fieldPath: "spec.containers[2].name",
+		},
+		"NoQueryMatch": {
+			fieldPath: "spec.containers[name=other].image",
+		},
+	}
+
+	for name, testcase := range cases {
+		t.Run(name, func(t *testing.T) {
+			fp, err := parseFieldPath(testcase.fieldPath)
+			qt.Assert(t, err, qt.IsNil)
+			value, found, err := fp.GetValue(in)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, found, qt.Equals, testcase.found)
+			qt.Assert(t, value, qt.DeepEquals, testcase.value)
+		})
+	}
+}
+
 func TestFieldPathParser(t *testing.T) {
 	cases := map[string]struct {
 		indexes []Index
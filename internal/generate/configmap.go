@@ -1,10 +1,310 @@
 package generate
 
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/decode"
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/resource"
+	dinghytypes "github.com/johnhoman/dinghy/internal/types"
+)
+
+var (
+	_ Generator            = &ConfigMap{}
+	_ Generator            = &Secret{}
+	_ yaml.Unmarshaler     = &ConfigMap{}
+	_ yaml.Unmarshaler     = &Secret{}
+	_ dinghytypes.EnvAware = &ConfigMap{}
+	_ dinghytypes.EnvAware = &Secret{}
+)
+
+// DataSource are the inputs of the configMap and secret generators.
+// Files are relative to the dinghyfile that declares the generator.
+type DataSource struct {
+	// Literals are key value pairs, e.g. port=8080
+	Literals []string `yaml:"literals" json:"literals"`
+	// Files will be read and added by file name, or by the key before
+	// the =, e.g. config.json=config/app.json
+	Files []string `yaml:"files" json:"files"`
+	// Envs are files containing key value pairs like <key>=<value>,
+	// one per line. Empty lines and lines starting with # are skipped.
+	Envs []string `yaml:"envs" json:"envs"`
+}
+
+type configMapConfig struct {
+	Name        string            `yaml:"name" json:"name" dinghy:"required"`
+	Namespace   string            `yaml:"namespace" json:"namespace"`
+	Labels      map[string]string `yaml:"labels" json:"labels"`
+	Annotations map[string]string `yaml:"annotations" json:"annotations"`
+	Immutable   bool              `yaml:"immutable" json:"immutable"`
+	// NameSuffixHash appends a hash of the data to the name, and updates
+	// every reference to it in the tree, so that workloads using it are
+	// rolled out when the data changes
+	NameSuffixHash bool `yaml:"nameSuffixHash" json:"nameSuffixHash"`
+	DataSource     `yaml:",inline"`
+}
+
+type secretConfig struct {
+	configMapConfig `yaml:",inline"`
+	// Type is the type of the secret. It defaults to Opaque.
+	Type string `yaml:"type" json:"type"`
+}
+
+// ConfigMap generates a ConfigMap from literals, files and env files
 type ConfigMap struct {
-	Literals []string
-	// Files will be read and added to the config file by file name.
-	Files []string
-	// EnvFiles are files containing key value pairs like
-	// <key>=<value>
-	EnvFiles []string
+	configMapConfig
+	dir path.Path
+}
+
+// SetEnv sets the directory files are read from, which is the
+// directory of the dinghyfile that declares the generator
+func (c *ConfigMap) SetEnv(env dinghytypes.Env) {
+	c.dir = env.Path
+}
+
+func (c *ConfigMap) Name() string {
+	return "builtin.dinghy.dev/configMap"
+}
+
+func (c *ConfigMap) UnmarshalYAML(value *yaml.Node) error {
+	return decodeGenerator(value, &c.configMapConfig, c.Name(), c.JSONSchema())
+}
+
+func (c *ConfigMap) JSONSchema() *jsonschema.Schema {
+	return decode.Schema(&configMapConfig{})
+}
+
+func (c *ConfigMap) Emit(ctx *context.Context) (resource.Tree, error) {
+	dir, err := generatorDir(ctx, c.dir)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := c.Generate(dir)
+	if err != nil {
+		return nil, err
+	}
+	tree := resource.NewTree()
+	return tree, tree.Insert(obj)
+}
+
+// Generate returns the ConfigMap, with files read relative to dir. Values
+// that aren't valid UTF-8 are added to binaryData.
+func (c *ConfigMap) Generate(dir path.Path) (*resource.Object, error) {
+	data, err := c.DataSource.Read(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ConfigMap %s", c.configMapConfig.Name)
+	}
+	obj := c.object("ConfigMap")
+	text, binary := make(map[string]any), make(map[string]any)
+	for key, value := range data {
+		if utf8.Valid(value) {
+			text[key] = string(value)
+		} else {
+			binary[key] = base64.StdEncoding.EncodeToString(value)
+		}
+	}
+	if len(text) > 0 {
+		obj.Object["data"] = text
+	}
+	if len(binary) > 0 {
+		obj.Object["binaryData"] = binary
+	}
+	return obj, nil
+}
+
+// object returns a resource of kind with the metadata of the config
+func (c *configMapConfig) object(kind string) *resource.Object {
+	obj := resource.Unstructured(map[string]any{
+		"apiVersion": "v1",
+		"kind":       kind,
+		"metadata":   map[string]any{"name": c.Name},
+	})
+	if c.Namespace != "" {
+		obj.SetNamespace(c.Namespace)
+	}
+	if len(c.Labels) > 0 {
+		obj.AddLabels(c.Labels)
+	}
+	if len(c.Annotations) > 0 {
+		obj.AddAnnotations(c.Annotations)
+	}
+	if c.Immutable {
+		obj.Object["immutable"] = true
+	}
+	if c.NameSuffixHash {
+		obj.AddAnnotations(map[string]string{AnnotationNameSuffixHash: "true"})
+	}
+	return obj
+}
+
+// Secret generates a Secret from literals, files and env files
+type Secret struct {
+	secretConfig
+	dir path.Path
+}
+
+// SetEnv sets the directory files are read from, which is the
+// directory of the dinghyfile that declares the generator
+func (s *Secret) SetEnv(env dinghytypes.Env) {
+	s.dir = env.Path
+}
+
+func (s *Secret) Name() string {
+	return "builtin.dinghy.dev/secret"
+}
+
+func (s *Secret) UnmarshalYAML(value *yaml.Node) error {
+	return decodeGenerator(value, &s.secretConfig, s.Name(), s.JSONSchema())
+}
+
+func (s *Secret) JSONSchema() *jsonschema.Schema {
+	return decode.Schema(&secretConfig{})
+}
+
+func (s *Secret) Emit(ctx *context.Context) (resource.Tree, error) {
+	dir, err := generatorDir(ctx, s.dir)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.Generate(dir)
+	if err != nil {
+		return nil, err
+	}
+	tree := resource.NewTree()
+	return tree, tree.Insert(obj)
+}
+
+// Generate returns the Secret, with files read relative to dir
+func (s *Secret) Generate(dir path.Path) (*resource.Object, error) {
+	data, err := s.DataSource.Read(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Secret %s", s.configMapConfig.Name)
+	}
+	obj := s.object("Secret")
+	typ := s.Type
+	if typ == "" {
+		typ = "Opaque"
+	}
+	obj.Object["type"] = typ
+	encoded := make(map[string]any, len(data))
+	for key, value := range data {
+		encoded[key] = base64.StdEncoding.EncodeToString(value)
+	}
+	if len(encoded) > 0 {
+		obj.Object["data"] = encoded
+	}
+	return obj, nil
+}
+
+// generatorDir returns the directory files are read from. It's the
+// build root if the generator wasn't given a path.
+func generatorDir(ctx *context.Context, dir path.Path) (path.Path, error) {
+	if !dir.IsZero() {
+		return dir, nil
+	}
+	return path.Parse(ctx.Root())
+}
+
+// decodeGenerator decodes the config of the configMap and secret generators
+func decodeGenerator(value *yaml.Node, out any, name string, schema *jsonschema.Schema) error {
+	pluginErr := func(err error) error {
+		return &dinghyerrors.ErrDecodePlugin{Kind: "generator", Name: name, Schema: schema, Err: err}
+	}
+	if err := decode.Node(value, out, ""); err != nil {
+		return pluginErr(err)
+	}
+	var in struct {
+		Name string `yaml:"name"`
+	}
+	if err := value.Decode(&in); err != nil {
+		return pluginErr(err)
+	}
+	if in.Name == "" {
+		return pluginErr(decode.NodeError(value, "name", errors.New("is a required field")))
+	}
+	return nil
+}
+
+// Read returns the data of every source by key. Keys must be valid
+// ConfigMap keys, and can't be repeated.
+func (d DataSource) Read(dir path.Path) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	add := func(key string, value []byte) error {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return errors.Errorf("invalid key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if _, ok := data[key]; ok {
+			return errors.Errorf("key %q is defined more than once", key)
+		}
+		data[key] = value
+		return nil
+	}
+
+	for _, literal := range d.Literals {
+		key, value, ok := strings.Cut(literal, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid literal %q: expected <key>=<value>", literal)
+		}
+		if err := add(key, []byte(unquote(value))); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range d.Files {
+		key, name, ok := strings.Cut(file, "=")
+		if !ok {
+			name = file
+			key = name[strings.LastIndex(name, "/")+1:]
+		}
+		content, err := dir.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read file %s", name)
+		}
+		if err := add(key, content); err != nil {
+			return nil, err
+		}
+	}
+	for _, env := range d.Envs {
+		content, err := dir.ReadFile(env)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read env file %s", env)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(text, "=")
+			if !ok {
+				return nil, errors.Errorf("%s:%d: expected <key>=<value>", env, line)
+			}
+			if err := add(key, []byte(value)); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("%s:%d", env, line))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// unquote removes the quotes around a literal value, e.g. "a b"
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
 }
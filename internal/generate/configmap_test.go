@@ -0,0 +1,130 @@
+package generate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/path"
+)
+
+func newMemoryPath(t *testing.T, files map[string]string) path.Path {
+	mem := path.NewMemory()
+	for name, content := range files {
+		qt.Assert(t, mem.WriteFile("app/"+name, []byte(content)), qt.IsNil)
+	}
+	return path.NewPath(mem, "app")
+}
+
+func TestConfigMap_Generate(t *testing.T) {
+	dir := newMemoryPath(t, map[string]string{
+		"config/app.json": `{"debug": true}`,
+		"logo.png":        "\x89PNG\x00\xff",
+		"app.env":         "# comment\n\nLOG_LEVEL=info\nGREETING=hello=world\n",
+	})
+	var gen ConfigMap
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+name: app
+namespace: web
+labels: {team: web}
+literals:
+- port=8080
+- 'message="hello world"'
+files:
+- config.json=config/app.json
+- logo.png
+envs:
+- app.env
+`), &gen), qt.IsNil)
+
+	obj, err := gen.Generate(dir)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, obj.Object, qt.DeepEquals, map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"name":      "app",
+			"namespace": "web",
+			"labels":    map[string]any{"team": "web"},
+		},
+		"data": map[string]any{
+			"port":        "8080",
+			"message":     "hello world",
+			"config.json": `{"debug": true}`,
+			"LOG_LEVEL":   "info",
+			"GREETING":    "hello=world",
+		},
+		"binaryData": map[string]any{
+			"logo.png": "iVBORwD/",
+		},
+	})
+}
+
+func TestConfigMap_Generate_Errors(t *testing.T) {
+	dir := newMemoryPath(t, map[string]string{
+		"app.env": "PORT=8080\nDEBUG\n",
+	})
+	tests := map[string]struct {
+		source DataSource
+		want   string
+	}{
+		"InvalidLiteral": {
+			source: DataSource{Literals: []string{"port"}},
+			want:   `ConfigMap app: invalid literal "port": expected <key>=<value>`,
+		},
+		"InvalidKey": {
+			source: DataSource{Literals: []string{"a b=c"}},
+			want:   `ConfigMap app: invalid key "a b": .*`,
+		},
+		"DuplicateKey": {
+			source: DataSource{Literals: []string{"PORT=80"}, Envs: []string{"app.env"}},
+			want:   `ConfigMap app: app.env:1: key "PORT" is defined more than once`,
+		},
+		"InvalidEnv": {
+			source: DataSource{Envs: []string{"app.env"}},
+			want:   `ConfigMap app: app.env:2: expected <key>=<value>`,
+		},
+		"MissingFile": {
+			source: DataSource{Files: []string{"missing.json"}},
+			want:   `ConfigMap app: failed to read file missing.json: .*`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			gen := &ConfigMap{configMapConfig: configMapConfig{Name: "app", DataSource: tt.source}}
+			_, err := gen.Generate(dir)
+			qt.Assert(t, err, qt.ErrorMatches, tt.want)
+		})
+	}
+}
+
+func TestConfigMap_UnmarshalYAML_RequiresName(t *testing.T) {
+	err := yaml.Unmarshal([]byte(`literals: [port=8080]`), &ConfigMap{})
+	var configErr *errors.ErrConfig
+	qt.Assert(t, err, qt.ErrorAs, &configErr)
+	qt.Assert(t, configErr.Field, qt.Equals, "name")
+}
+
+func TestSecret_Generate(t *testing.T) {
+	var gen Secret
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+name: creds
+literals: [password=hunter2]
+nameSuffixHash: true
+`), &gen), qt.IsNil)
+
+	obj, err := gen.Generate(newMemoryPath(t, nil))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, obj.Object, qt.DeepEquals, map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata": map[string]any{
+			"name":        "creds",
+			"annotations": map[string]any{AnnotationNameSuffixHash: "true"},
+		},
+		"data": map[string]any{"password": "aHVudGVyMg=="},
+	})
+}
@@ -0,0 +1,117 @@
+package generate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/johnhoman/dinghy/internal/mutate"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// AnnotationNameSuffixHash marks a generated resource that needs a hash
+// of its content appended to its name. The annotation is removed when the
+// hash is added by HashNames.
+const AnnotationNameSuffixHash = "generate.dinghy.dev/name-suffix-hash"
+
+// HashNames appends a hash of the content to the name of every resource
+// marked with AnnotationNameSuffixHash, and renames every reference to it
+// in the tree. The hash is the same one kustomize adds to generated
+// ConfigMaps and Secrets.
+func HashNames(tree resource.Tree) error {
+	marked := make([]*resource.Object, 0)
+	err := tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if _, ok := obj.GetAnnotations()[AnnotationNameSuffixHash]; ok {
+			marked = append(marked, obj)
+		}
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+	for _, obj := range marked {
+		old, err := tree.Pop(resource.ParseKey(obj))
+		if err != nil {
+			return err
+		}
+		annotations := old.GetAnnotations()
+		delete(annotations, AnnotationNameSuffixHash)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		old.SetAnnotations(annotations)
+
+		hash, err := contentHash(old)
+		if err != nil {
+			return errors.Wrapf(err, "failed to hash %s", resource.ParseKey(old))
+		}
+		obj := old.Copy()
+		obj.SetName(old.GetName() + "-" + hash)
+		if err := mutate.RenameReferences(tree, old, obj.GetName(), nil); err != nil {
+			return err
+		}
+		if err := tree.Insert(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentHash returns the hash of the kind and data of a ConfigMap or
+// Secret, or of the whole content of other kinds. kustomize looks up
+// metadata/name as a single field, so the name in its hash is always
+// empty. It's left empty here too, so that generated names match the
+// names kustomize generates.
+func contentHash(obj *resource.Object) (string, error) {
+	var m any = obj.Object
+	field := func(name string) any {
+		if v, ok := obj.Object[name]; ok && v != nil {
+			return v
+		}
+		return ""
+	}
+	switch obj.GetKind() {
+	case "ConfigMap":
+		cm := map[string]any{"kind": "ConfigMap", "name": "", "data": field("data")}
+		if binary, ok := obj.Object["binaryData"].(map[string]any); ok {
+			cm["binaryData"] = binary
+		}
+		m = cm
+	case "Secret":
+		secret := map[string]any{"kind": "Secret", "type": field("type"), "name": "", "data": field("data")}
+		if stringData, ok := obj.Object["stringData"].(map[string]any); ok {
+			secret["stringData"] = stringData
+		}
+		m = secret
+	}
+	// json.Marshal sorts the keys, so the hash is stable
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return encodeHash(hex.EncodeToString(sum[:])), nil
+}
+
+// encodeHash shortens the hash to 10 characters, and replaces characters
+// that could spell out words
+func encodeHash(hash string) string {
+	enc := []rune(hash[:10])
+	for k := range enc {
+		switch enc[k] {
+		case '0':
+			enc[k] = 'g'
+		case '1':
+			enc[k] = 'h'
+		case '3':
+			enc[k] = 'k'
+		case 'a':
+			enc[k] = 'm'
+		case 'e':
+			enc[k] = 't'
+		}
+	}
+	return string(enc)
+}
@@ -0,0 +1,53 @@
+package generate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func TestHashNames(t *testing.T) {
+	gen := &ConfigMap{configMapConfig: configMapConfig{
+		Name:           "app",
+		NameSuffixHash: true,
+		DataSource:     DataSource{Literals: []string{"port=8080"}},
+	}}
+	cm, err := gen.Generate(newMemoryPath(t, nil))
+	qt.Assert(t, err, qt.IsNil)
+
+	var m map[string]any
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        envFrom: [{configMapRef: {name: app}}]
+`), &m), qt.IsNil)
+	deploy := resource.Unstructured(m)
+
+	tree := resource.NewTree()
+	qt.Assert(t, tree.Insert(cm), qt.IsNil)
+	qt.Assert(t, tree.Insert(deploy), qt.IsNil)
+	qt.Assert(t, HashNames(tree), qt.IsNil)
+
+	names := make(map[string]string)
+	err = tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		names[obj.GetKind()] = obj.GetName()
+		qt.Assert(t, obj.GetAnnotations(), qt.HasLen, 0)
+		return nil
+	}))
+	qt.Assert(t, err, qt.IsNil)
+	// the hash matches the one kustomize generates for the same data
+	qt.Assert(t, names["ConfigMap"], qt.Equals, "app-9hdd6gt8fb")
+	envFrom := deploy.Containers()[0]["envFrom"].([]any)
+	qt.Assert(t, envFrom[0], qt.DeepEquals, map[string]any{
+		"configMapRef": map[string]any{"name": "app-9hdd6gt8fb"},
+	})
+}
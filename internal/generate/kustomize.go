@@ -2,22 +2,35 @@ package generate
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/kustomize/api/konfig"
 	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 
 	"github.com/johnhoman/dinghy/internal/context"
 	"github.com/johnhoman/dinghy/internal/mutate"
+	"github.com/johnhoman/dinghy/internal/openapi"
 	"github.com/johnhoman/dinghy/internal/path"
 	"github.com/johnhoman/dinghy/internal/resource"
+	dinghytypes "github.com/johnhoman/dinghy/internal/types"
 )
 
+// ErrKustomizeUnsupported is returned for kustomization fields that
+// can't be built, rather than ignoring them
+var ErrKustomizeUnsupported = errors.New("unsupported kustomization field")
+
+// kustomizeOriginAnnotation is the annotation added by the
+// originAnnotations build metadata option
+const kustomizeOriginAnnotation = "config.kubernetes.io/origin"
+
 type Kustomize struct {
 	Source string `yaml:"source"`
 }
@@ -44,7 +57,7 @@ func (c *Kustomize) Emit(ctx *context.Context) (resource.Tree, error) {
 		src = pth.String(c.Source)
 	}
 
-	b := &kustomize{}
+	b := newKustomize()
 	source, err := path.Parse(src)
 	if err != nil {
 		return nil, err
@@ -53,14 +66,53 @@ func (c *Kustomize) Emit(ctx *context.Context) (resource.Tree, error) {
 	return b.Build(source)
 }
 
-type kustomize struct{}
+// kustomize builds a kustomization and the kustomizations it references
+type kustomize struct {
+	// ids are the previous keys of each resource. Selectors match any of
+	// them, the way kustomize matches the names of resources before a
+	// prefix or namespace was added.
+	ids map[*resource.Object][]resource.Key
+	// origins are where each resource was read or generated, relative to
+	// the kustomization that's being built
+	origins map[*resource.Object]*kustomizeOrigin
+}
+
+func newKustomize() *kustomize {
+	return &kustomize{
+		ids:     make(map[*resource.Object][]resource.Key),
+		origins: make(map[*resource.Object]*kustomizeOrigin),
+	}
+}
+
+// kustomizeOrigin is the value of the origin annotation that's added by
+// the originAnnotations build metadata option
+type kustomizeOrigin struct {
+	Path         string            `yaml:"path,omitempty"`
+	ConfiguredIn string            `yaml:"configuredIn,omitempty"`
+	ConfiguredBy map[string]string `yaml:"configuredBy,omitempty"`
+}
+
+// in returns the origin relative to the parent directory dir
+func (o kustomizeOrigin) in(dir string) *kustomizeOrigin {
+	if o.Path != "" {
+		o.Path = dir + "/" + o.Path
+	}
+	if o.ConfiguredIn != "" {
+		o.ConfiguredIn = dir + "/" + o.ConfiguredIn
+	}
+	return &o
+}
 
-func (k *kustomize) Build(path path.Path) (resource.Tree, error) {
-	c, err := ReadKustomizationFile(path)
+func (k *kustomize) Build(dir path.Path) (resource.Tree, error) {
+	name, err := kustomizationFileName(dir)
 	if err != nil {
 		return nil, err
 	}
-	return k.buildFromConfig(c, path)
+	c, err := readKustomization(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return k.buildFromConfig(c, dir, name)
 }
 
 func (k *kustomize) buildResource(r string, dir path.Path, tree resource.Tree) error {
@@ -72,6 +124,7 @@ func (k *kustomize) buildResource(r string, dir path.Path, tree resource.Tree) e
 			return err
 		}
 	}
+	r = strings.TrimSuffix(strings.TrimPrefix(r, "./"), "/")
 	ok, err := target.IsDir()
 	if err != nil {
 		return err
@@ -81,23 +134,42 @@ func (k *kustomize) buildResource(r string, dir path.Path, tree resource.Tree) e
 		if err != nil {
 			return err
 		}
-		if err := resource.CopyTree(tree, sub); err != nil {
-			return err
-		}
-		return nil
+		return sub.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+			if origin, ok := k.origins[obj]; ok {
+				k.origins[obj] = origin.in(r)
+			}
+			return tree.Insert(obj)
+		}))
 	}
 	// read the file
 	f, err := target.Reader()
 	if err != nil {
 		return err
 	}
-	return resource.InsertFromReader(tree, f)
+	// the origin of the resource is also kept on the resource, so dinghy
+	// knows where resources built with kustomize came from
+	origin := resource.Origin{}
+	origin.Repo, origin.Ref, origin.Path = target.Origin()
+	list := resource.NewList()
+	if err := resource.InsertFromFile(list, f, origin); err != nil {
+		return err
+	}
+	return list.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		k.origins[obj] = &kustomizeOrigin{Path: r}
+		return tree.Insert(obj)
+	}))
 }
 
-func (k *kustomize) buildFromConfig(c *types.Kustomization, dir path.Path) (resource.Tree, error) {
+// buildFromConfig builds the kustomization c, which was read from file in
+// dir. Fields are applied in the same order as kustomize.
+func (k *kustomize) buildFromConfig(c *types.Kustomization, dir path.Path, file string) (resource.Tree, error) {
+	if err := kustomizeUnsupported(c); err != nil {
+		return nil, errors.Wrap(err, dir.String(file))
+	}
 
 	tree := resource.NewTree()
-	for _, r := range c.Resources {
+	// bases are deprecated, and are the same as resources
+	for _, r := range append(append([]string{}, c.Resources...), c.Bases...) {
 		// This resource could be a relative local path, which means it needs to get
 		// joined from the provided dir, otherwise it's an absolute path and should be parsed
 		t := resource.NewTree()
@@ -113,98 +185,790 @@ func (k *kustomize) buildFromConfig(c *types.Kustomization, dir path.Path) (reso
 			return nil, err
 		}
 	}
-	// namePrefix
-	// nameSuffix
-	if len(c.NamePrefix) > 0 || len(c.NameSuffix) > 0 {
-		if err := tree.Visit(&mutate.Name{Prefix: c.NamePrefix, Suffix: c.NameSuffix}); err != nil {
+	// configMapGenerator
+	// secretGenerator
+	if err := k.generate(c, dir, file, tree); err != nil {
+		return nil, err
+	}
+	k.remember(tree)
+
+	schemas, err := kustomizeSchemas(c, dir, tree)
+	if err != nil {
+		return nil, err
+	}
+	// patchesStrategicMerge
+	for _, patch := range c.PatchesStrategicMerge {
+		if err := k.patchStrategicMerge(dir, string(patch), tree, schemas); err != nil {
+			return nil, err
+		}
+	}
+	// patches
+	for _, patch := range c.Patches {
+		if err := k.patch(dir, patch, tree, schemas); err != nil {
 			return nil, err
 		}
 	}
 	// namespace
 	if len(c.Namespace) > 0 {
-		if err := tree.Visit(&mutate.Namespace{Namespace: c.Namespace}); err != nil {
+		k.remember(tree)
+		ns := &mutate.Namespace{Namespace: c.Namespace}
+		ns.SetEnv(dinghytypes.Env{Tree: tree})
+		if err := tree.Visit(mutate.SideEffect(ns, tree)); err != nil {
+			return nil, err
+		}
+	}
+	// namePrefix
+	// nameSuffix
+	if len(c.NamePrefix) > 0 || len(c.NameSuffix) > 0 {
+		k.remember(tree)
+		name := &mutate.Name{Prefix: c.NamePrefix, Suffix: c.NameSuffix}
+		renamed := func(obj *resource.Object) bool {
+			return !kustomizeUnprefixedKinds[obj.GroupVersionKind().GroupKind().String()]
+		}
+		if err := tree.Visit(kustomizeFilter(renamed, mutate.SideEffect(name, tree))); err != nil {
 			return nil, err
 		}
 	}
+	// labels
 	// commonLabels
+	labels := append([]types.Label{}, c.Labels...)
+	if len(c.CommonLabels) > 0 {
+		labels = append(labels, types.Label{Pairs: c.CommonLabels, IncludeSelectors: true})
+	}
+	for _, l := range labels {
+		if err := tree.Visit(kustomizeLabels(l)); err != nil {
+			return nil, err
+		}
+	}
 	// commonAnnotations
 	if len(c.CommonAnnotations) > 0 {
-		mu := mutate.Annotations(c.CommonAnnotations)
-		if err := tree.Visit(&mu); err != nil {
+		if err := tree.Visit(kustomizeAnnotations(c.CommonAnnotations)); err != nil {
 			return nil, err
 		}
 	}
-	// patches is either a strategicMergePatch or a json patch. I guess it's
-	// up to me to guess which one, since they deprecated the method of
-	// explicitly choosing one
-	for _, patch := range c.Patches {
-		if err := kustomizePatch(dir, patch, tree); err != nil {
+	// patchesJson6902
+	for _, patch := range c.PatchesJson6902 {
+		if err := k.patchJSON6902(dir, patch, tree); err != nil {
+			return nil, err
+		}
+	}
+	// replicas
+	for _, replica := range c.Replicas {
+		if err := k.replicas(replica, tree); err != nil {
 			return nil, err
 		}
 	}
+	// images
+	// imageTags
+	if images := append(append([]types.Image{}, c.Images...), c.ImageTags...); len(images) > 0 {
+		if err := tree.Visit(kustomizeImages(images)); err != nil {
+			return nil, err
+		}
+	}
+	// replacements
+	if err := k.replace(c.Replacements, dir, tree); err != nil {
+		return nil, err
+	}
+	// buildMetadata
+	if err := k.buildMetadata(c.BuildMetadata, tree); err != nil {
+		return nil, err
+	}
 	return tree, nil
 }
 
-func ReadKustomizationFile(path path.Path) (*types.Kustomization, error) {
-	for _, name := range konfig.RecognizedKustomizationFileNames() {
-		ok, err := path.Exists(name)
+// kustomizeUnsupported returns an error for the first field of the
+// kustomization that can't be built, instead of ignoring it
+func kustomizeUnsupported(c *types.Kustomization) error {
+	type field struct {
+		name string
+		set  bool
+	}
+	fields := []field{
+		{"vars", len(c.Vars) > 0},
+		{"helmGlobals", c.HelmGlobals != nil},
+		{"helmCharts", len(c.HelmCharts) > 0},
+		{"helmChartInflationGenerator", len(c.HelmChartInflationGenerator) > 0},
+		{"configurations", len(c.Configurations) > 0},
+		{"generators", len(c.Generators) > 0},
+		{"transformers", len(c.Transformers) > 0},
+		{"validators", len(c.Validators) > 0},
+		{"sortOptions", c.SortOptions != nil},
+	}
+	for k, l := range c.Labels {
+		fields = append(fields, field{fmt.Sprintf("labels[%d].fields", k), len(l.FieldSpecs) > 0})
+	}
+	for k, image := range append(append([]types.Image{}, c.Images...), c.ImageTags...) {
+		fields = append(fields, field{fmt.Sprintf("images[%d].tagSuffix", k), image.TagSuffix != ""})
+	}
+	for _, field := range fields {
+		if field.set {
+			return errors.Wrap(ErrKustomizeUnsupported, field.name)
+		}
+	}
+	return nil
+}
+
+// remember adds the current key of every resource to its previous keys
+func (k *kustomize) remember(tree resource.Tree) {
+	_ = tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		key := resource.ParseKey(obj)
+		if ids := k.ids[obj]; len(ids) == 0 || ids[len(ids)-1] != key {
+			k.ids[obj] = append(ids, key)
+		}
+		return nil
+	}))
+}
+
+// matchKeys reports whether the current key or any previous key of the
+// resource matches
+func (k *kustomize) matchKeys(obj *resource.Object, match func(key resource.Key) bool) bool {
+	if match(resource.ParseKey(obj)) {
+		return true
+	}
+	for _, key := range k.ids[obj] {
+		if match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedBy reports whether any key of the resource is selected by id.
+// Fields that aren't set in id match every resource.
+func (k *kustomize) selectedBy(obj *resource.Object, id resid.ResId) bool {
+	return k.matchKeys(obj, func(key resource.Key) bool {
+		return keySelectedBy(obj, key, id)
+	})
+}
+
+func keySelectedBy(obj *resource.Object, key resource.Key, id resid.ResId) bool {
+	gvk := obj.GroupVersionKind()
+	return resid.NewGvk(gvk.Group, gvk.Version, gvk.Kind).IsSelected(&id.Gvk) &&
+		(id.Name == "" || id.Name == key.Name) &&
+		(id.Namespace == "" || effectiveNamespace(id.Namespace) == effectiveNamespace(key.Namespace))
+}
+
+// selector returns a function that reports whether a resource is selected
+// by the target of a patch. The kind, name and namespace are regular
+// expressions, and the labels and annotations are label selectors.
+func (k *kustomize) selector(sel *types.Selector) (func(obj *resource.Object) bool, error) {
+	re, err := types.NewSelectorRegex(sel)
+	if err != nil {
+		return nil, err
+	}
+	labelSelector, err := labels.Parse(sel.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	annotationSelector, err := labels.Parse(sel.AnnotationSelector)
+	if err != nil {
+		return nil, err
+	}
+	return func(obj *resource.Object) bool {
+		gvk := obj.GroupVersionKind()
+		if !re.MatchGvk(resid.NewGvk(gvk.Group, gvk.Version, gvk.Kind)) ||
+			!labelSelector.Matches(labels.Set(obj.GetLabels())) ||
+			!annotationSelector.Matches(labels.Set(obj.GetAnnotations())) {
+			return false
+		}
+		return k.matchKeys(obj, func(key resource.Key) bool {
+			return re.MatchName(key.Name) && re.MatchNamespace(effectiveNamespace(key.Namespace))
+		})
+	}, nil
+}
+
+// effectiveNamespace is the namespace of a resource without one
+func effectiveNamespace(namespace string) string {
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
+// kustomizeFilter only visits the resources that match
+func kustomizeFilter(match func(obj *resource.Object) bool, next resource.Visitor) resource.Visitor {
+	return resource.VisitorFunc(func(obj *resource.Object) error {
+		if !match(obj) {
+			return nil
+		}
+		return next.Visit(obj)
+	})
+}
+
+// patchStrategicMerge applies a patchesStrategicMerge entry, which is
+// either a file or inline patches. Each patch is applied to the resource
+// with its kind, name and namespace, and a patch with $patch: delete
+// removes the resource.
+func (k *kustomize) patchStrategicMerge(dir path.Path, patch string, tree resource.Tree, schemas *openapi.Schemas) error {
+	raw, name := []byte(patch), "inline patch"
+	if !strings.Contains(patch, "\n") {
+		ok, err := dir.Exists(patch)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if ok {
-			f, err := path.Reader(name)
+		if !ok {
+			return errors.Wrapf(os.ErrNotExist, dir.String(patch))
+		}
+		if raw, err = dir.ReadFile(patch); err != nil {
+			return err
+		}
+		name = patch
+	}
+	_, patches, err := kustomizeDecodePatch(raw)
+	if err == nil && patches == nil {
+		err = errors.New("expected strategic merge patches, but got a JSON patch")
+	}
+	if err != nil {
+		return errors.Wrapf(err, "patchesStrategicMerge: %s", name)
+	}
+	for _, p := range patches {
+		target, err := k.patchTarget(p, tree)
+		if err != nil {
+			return errors.Wrapf(err, "patchesStrategicMerge: %s", name)
+		}
+		if err := kustomizeStrategicMerge(target, p, nil, tree, schemas); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patch applies a patches entry, which is either a JSON patch or a
+// strategic merge patch. JSON patches are applied to the resources that
+// match the target. Strategic merge patches are applied to the resources
+// that match the target, or without a target, to the resource with the
+// kind, name and namespace of the patch.
+func (k *kustomize) patch(dir path.Path, patch types.Patch, tree resource.Tree, schemas *openapi.Schemas) error {
+	name := patch.Path
+	if name == "" {
+		name = "inline patch"
+	}
+	raw, err := kustomizePatchContent(dir, patch)
+	if err != nil {
+		return err
+	}
+	jp, patches, err := kustomizeDecodePatch(raw)
+	if err != nil {
+		return errors.Wrapf(err, "patches: %s", name)
+	}
+	var match func(obj *resource.Object) bool
+	if patch.Target != nil {
+		if match, err = k.selector(patch.Target); err != nil {
+			return errors.Wrapf(err, "patches: %s", name)
+		}
+	}
+	if jp != nil {
+		if match == nil {
+			return errors.Errorf("patches: %s: a JSON patch must have a target", name)
+		}
+		return tree.Visit(kustomizeFilter(match, jp))
+	}
+	if len(patches) > 1 {
+		return errors.Errorf("patches: %s: a patch can only have one strategic merge patch", name)
+	}
+	if match == nil {
+		target, err := k.patchTarget(patches[0], tree)
+		if err != nil {
+			return errors.Wrapf(err, "patches: %s", name)
+		}
+		return kustomizeStrategicMerge(target, patches[0], patch.Options, tree, schemas)
+	}
+	var targets []*resource.Object
+	if err := tree.Visit(kustomizeFilter(match, resource.VisitorFunc(func(obj *resource.Object) error {
+		targets = append(targets, obj)
+		return nil
+	}))); err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if err := kustomizeStrategicMerge(target, patches[0], patch.Options, tree, schemas); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchTarget returns the resource with the kind, name and namespace of
+// a strategic merge patch
+func (k *kustomize) patchTarget(p *resource.Object, tree resource.Tree) (*resource.Object, error) {
+	gvk := p.GroupVersionKind()
+	id := resid.NewResIdWithNamespace(resid.NewGvk(gvk.Group, gvk.Version, gvk.Kind), p.GetName(), p.GetNamespace())
+	var matches []*resource.Object
+	err := tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if k.selectedBy(obj, id) {
+			matches = append(matches, obj)
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) != 1 {
+		return nil, errors.Errorf("expected one resource to match %s, found %d", resource.ParseKey(p), len(matches))
+	}
+	return matches[0], nil
+}
+
+// kustomizeStrategicMerge applies the patch p to the target, or removes
+// the target if the patch is $patch: delete. The patch can't change the
+// name or kind of the target unless the allowNameChange or
+// allowKindChange options are set.
+func kustomizeStrategicMerge(target, p *resource.Object, options map[string]bool, tree resource.Tree, schemas *openapi.Schemas) error {
+	if p.Object["$patch"] == "delete" {
+		_, err := tree.Pop(resource.ParseKey(target))
+		return err
+	}
+	patch := p.Copy()
+	if !options["allowNameChange"] {
+		patch.SetName(target.GetName())
+		patch.SetNamespace(target.GetNamespace())
+	}
+	if !options["allowKindChange"] {
+		patch.SetAPIVersion(target.GetAPIVersion())
+		patch.SetKind(target.GetKind())
+	}
+	// the target is patched while it's visited, so that it's moved in
+	// the tree if the patch changes its name
+	return tree.Visit(kustomizeFilter(
+		func(obj *resource.Object) bool { return obj == target },
+		resource.VisitorFunc(func(obj *resource.Object) error {
+			return obj.StrategicMergePatch(patch.Object, schemas)
+		}),
+	))
+}
+
+// kustomizeDecodePatch decodes a patch, which is either a JSON patch, a
+// list of operations in YAML or JSON, or a stream of strategic merge
+// patches
+func kustomizeDecodePatch(raw []byte) (*mutate.JSONPatch, []*resource.Object, error) {
+	var docs []*yaml.Node
+	d := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var doc yaml.Node
+		if err := d.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, err
+		}
+		if len(doc.Content) > 0 && doc.Content[0].Tag != "!!null" {
+			docs = append(docs, doc.Content[0])
+		}
+	}
+	if len(docs) == 0 {
+		return nil, nil, errors.New("the patch is empty")
+	}
+	if len(docs) == 1 && docs[0].Kind == yaml.SequenceNode {
+		var ops []map[string]any
+		if err := docs[0].Decode(&ops); err != nil {
+			return nil, nil, errors.Wrap(err, "expected a list of JSON patch operations")
+		}
+		for n, op := range ops {
+			for _, field := range []string{"op", "path"} {
+				if _, ok := op[field].(string); !ok {
+					return nil, nil, errors.Errorf("JSON patch operation %d: %s is required", n, field)
+				}
+			}
+		}
+		jp := &mutate.JSONPatch{}
+		return jp, nil, docs[0].Decode(jp)
+	}
+	patches := make([]*resource.Object, 0, len(docs))
+	for _, doc := range docs {
+		if doc.Kind != yaml.MappingNode {
+			return nil, nil, errors.Errorf("line %d: expected a strategic merge patch or a JSON patch", doc.Line)
+		}
+		var m map[string]any
+		if err := doc.Decode(&m); err != nil {
+			return nil, nil, err
+		}
+		patches = append(patches, resource.Unstructured(m))
+	}
+	return nil, patches, nil
+}
+
+// patchJSON6902 applies a patchesJson6902 entry to the resources that
+// match its target
+func (k *kustomize) patchJSON6902(dir path.Path, patch types.Patch, tree resource.Tree) error {
+	if patch.Target == nil {
+		return errors.New("patchesJson6902: target is required")
+	}
+	raw, err := kustomizePatchContent(dir, patch)
+	if err != nil {
+		return err
+	}
+	jp, _, err := kustomizeDecodePatch(raw)
+	if err == nil && jp == nil {
+		err = errors.New("expected a JSON patch, but got a strategic merge patch")
+	}
+	if err != nil {
+		return errors.Wrapf(err, "patchesJson6902: %s", patch.Target)
+	}
+	match, err := k.selector(patch.Target)
+	if err != nil {
+		return err
+	}
+	return tree.Visit(kustomizeFilter(match, jp))
+}
+
+// kustomizeLabels returns the mutator of a labels entry. Selectors are
+// only changed with includeSelectors, and templates with includeTemplates.
+func kustomizeLabels(l types.Label) resource.Visitor {
+	switch {
+	case l.IncludeSelectors:
+		return mutate.NewMatchLabels(l.Pairs, false)
+	case l.IncludeTemplates:
+		return mutate.NewMatchLabels(l.Pairs, true)
+	}
+	mu := mutate.Labels(l.Pairs)
+	return &mu
+}
+
+// kustomizeUnprefixedKinds are the kinds that namePrefix and nameSuffix
+// don't rename
+var kustomizeUnprefixedKinds = map[string]bool{
+	"CustomResourceDefinition.apiextensions.k8s.io": true,
+	"APIService.apiregistration.k8s.io":             true,
+	"Namespace":                                     true,
+}
+
+// kustomizeAnnotationPaths are the template annotations, by kind, that
+// commonAnnotations are added to
+var kustomizeAnnotationPaths = map[string][][]string{
+	"ReplicationController": {{"spec", "template", "metadata", "annotations"}},
+	"Deployment.apps":       {{"spec", "template", "metadata", "annotations"}},
+	"ReplicaSet.apps":       {{"spec", "template", "metadata", "annotations"}},
+	"DaemonSet.apps":        {{"spec", "template", "metadata", "annotations"}},
+	"StatefulSet.apps":      {{"spec", "template", "metadata", "annotations"}},
+	"Job.batch":             {{"spec", "template", "metadata", "annotations"}},
+	"CronJob.batch": {
+		{"spec", "jobTemplate", "metadata", "annotations"},
+		{"spec", "jobTemplate", "spec", "template", "metadata", "annotations"},
+	},
+}
+
+// kustomizeAnnotations returns the mutator of the commonAnnotations
+// field, which also annotates the templates of workloads
+func kustomizeAnnotations(annotations map[string]string) resource.Visitor {
+	return resource.VisitorFunc(func(obj *resource.Object) error {
+		obj.AddAnnotations(annotations)
+		for _, path := range kustomizeAnnotationPaths[obj.GroupVersionKind().GroupKind().String()] {
+			current, _, err := unstructured.NestedStringMap(obj.Object, path...)
 			if err != nil {
-				return nil, err
+				return errors.Wrapf(err, "%s", resource.ParseKey(obj))
+			}
+			if current == nil {
+				current = make(map[string]string, len(annotations))
+			}
+			for k, v := range annotations {
+				current[k] = v
+			}
+			if err := unstructured.SetNestedStringMap(obj.Object, current, path...); err != nil {
+				return errors.Wrapf(err, "%s", resource.ParseKey(obj))
 			}
-			c := &types.Kustomization{}
-			return c, yaml.NewDecoder(f).Decode(c)
-		}
-	}
-	return nil, errors.Wrapf(os.ErrNotExist, path.String(konfig.DefaultKustomizationFileName()))
-}
-
-func kustomizePatch(path path.Path, patch types.Patch, tree resource.Tree) error {
-	var o []resource.MatchOption
-	if target := patch.Target; target != nil {
-		o = append(o,
-			resource.MatchNames(target.Name),
-			resource.MatchNamespaces(target.Namespace),
-			resource.MatchKinds(schema.GroupVersionKind{
-				Group:   target.Group,
-				Version: target.Version,
-				Kind:    target.Kind,
-			}),
-		)
-	}
-	var content io.Reader = strings.NewReader(patch.Patch)
-	if len(patch.Path) > 0 {
-		pp := path.Join(patch.Path)
-		ok, err := pp.Exists()
+		}
+		return nil
+	})
+}
+
+// kustomizeReplicaKinds are the kinds that the replicas field changes
+var kustomizeReplicaKinds = map[string]bool{
+	"Deployment.apps":       true,
+	"ReplicaSet.apps":       true,
+	"StatefulSet.apps":      true,
+	"ReplicationController": true,
+}
+
+// replicas sets the replicas of the workloads with the name of replica
+func (k *kustomize) replicas(replica types.Replica, tree resource.Tree) error {
+	found := false
+	err := tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if !kustomizeReplicaKinds[obj.GroupVersionKind().GroupKind().String()] {
+			return nil
+		}
+		if !k.matchKeys(obj, func(key resource.Key) bool { return key.Name == replica.Name }) {
+			return nil
+		}
+		found = true
+		return unstructured.SetNestedField(obj.Object, replica.Count, "spec", "replicas")
+	}))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("replicas: no Deployment, ReplicaSet, StatefulSet or ReplicationController named %s",
+			replica.Name)
+	}
+	return nil
+}
+
+// kustomizeImages returns the mutator of the images field
+func kustomizeImages(images []types.Image) resource.Visitor {
+	mu := &mutate.Images{}
+	for _, image := range images {
+		mu.Images = append(mu.Images, mutate.Image{
+			Name:    image.Name,
+			NewName: image.NewName,
+			NewTag:  image.NewTag,
+			Digest:  image.Digest,
+		})
+	}
+	return mu
+}
+
+// buildMetadata adds the build metadata options to every resource
+func (k *kustomize) buildMetadata(options []string, tree resource.Tree) error {
+	for _, option := range options {
+		var visitor resource.VisitorFunc
+		switch option {
+		case types.ManagedByLabelOption:
+			visitor = func(obj *resource.Object) error {
+				obj.AddLabels(map[string]string{konfig.ManagedbyLabelKey: "dinghy"})
+				return nil
+			}
+		case types.OriginAnnotations:
+			visitor = func(obj *resource.Object) error {
+				origin, ok := k.origins[obj]
+				if !ok {
+					return nil
+				}
+				var value bytes.Buffer
+				e := yaml.NewEncoder(&value)
+				e.SetIndent(2)
+				if err := e.Encode(origin); err != nil {
+					return err
+				}
+				obj.AddAnnotations(map[string]string{kustomizeOriginAnnotation: value.String()})
+				return nil
+			}
+		case types.TransformerAnnotations:
+			return errors.Wrap(ErrKustomizeUnsupported, "buildMetadata: "+option)
+		default:
+			return errors.Errorf("buildMetadata: unknown option %q", option)
+		}
+		if err := tree.Visit(visitor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kustomizeSchemas loads the schemas used to patch custom resources from
+// the crds files, the openapi field and the CustomResourceDefinitions in
+// the tree
+func kustomizeSchemas(c *types.Kustomization, dir path.Path, tree resource.Tree) (*openapi.Schemas, error) {
+	for field := range c.OpenAPI {
+		if field != "path" && field != "version" {
+			return nil, errors.Errorf("openapi: unknown field %q, expected path or version", field)
+		}
+	}
+	schemas, err := openapi.Load(c.OpenAPI["version"])
+	if err != nil {
+		return nil, err
+	}
+	files := append([]string{}, c.Crds...)
+	if name, ok := c.OpenAPI["path"]; ok {
+		files = append(files, name)
+	}
+	for _, name := range files {
+		data, err := dir.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := schemas.AddFile(data); err != nil {
+			return nil, errors.Wrapf(err, "failed to read schemas from %s", name)
+		}
+	}
+	return schemas, schemas.AddCRDs(tree)
+}
+
+// generate adds the resources of the configMapGenerator and
+// secretGenerator of the kustomization in file to the tree
+func (k *kustomize) generate(c *types.Kustomization, dir path.Path, file string, tree resource.Tree) error {
+	origin := func(kind string) *kustomizeOrigin {
+		return &kustomizeOrigin{
+			ConfiguredIn: file,
+			ConfiguredBy: map[string]string{"apiVersion": "builtin", "kind": kind},
+		}
+	}
+	for _, args := range c.ConfigMapGenerator {
+		gen := &ConfigMap{configMapConfig: kustomizeGeneratorConfig(args.GeneratorArgs, c.GeneratorOptions)}
+		obj, err := gen.Generate(dir)
 		if err != nil {
 			return err
 		}
-		if !ok {
-			return errors.Wrapf(os.ErrNotExist, pp.String())
+		k.origins[obj] = origin("ConfigMapGenerator")
+		obj.SetOrigin(&resource.Origin{ConfiguredIn: dir.String(file), ConfiguredBy: "ConfigMapGenerator"})
+		if err := kustomizeInsertGenerated(tree, obj, args.Behavior); err != nil {
+			return err
 		}
-		content, err = pp.Reader()
+	}
+	for _, args := range c.SecretGenerator {
+		gen := &Secret{secretConfig: secretConfig{
+			configMapConfig: kustomizeGeneratorConfig(args.GeneratorArgs, c.GeneratorOptions),
+			Type:            args.Type,
+		}}
+		obj, err := gen.Generate(dir)
 		if err != nil {
 			return err
 		}
+		k.origins[obj] = origin("SecretGenerator")
+		obj.SetOrigin(&resource.Origin{ConfiguredIn: dir.String(file), ConfiguredBy: "SecretGenerator"})
+		if err := kustomizeInsertGenerated(tree, obj, args.Behavior); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kustomizeGeneratorConfig merges the generatorOptions into the options
+// of a generator
+func kustomizeGeneratorConfig(args types.GeneratorArgs, global *types.GeneratorOptions) configMapConfig {
+	c := configMapConfig{
+		Name:           args.Name,
+		Namespace:      args.Namespace,
+		Labels:         make(map[string]string),
+		Annotations:    make(map[string]string),
+		NameSuffixHash: true,
+		DataSource: DataSource{
+			Literals: args.LiteralSources,
+			Files:    args.FileSources,
+			Envs:     args.EnvSources,
+		},
+	}
+	if args.EnvSource != "" {
+		c.Envs = append(c.Envs, args.EnvSource)
+	}
+	for _, opts := range []*types.GeneratorOptions{global, args.Options} {
+		if opts == nil {
+			continue
+		}
+		for k, v := range opts.Labels {
+			c.Labels[k] = v
+		}
+		for k, v := range opts.Annotations {
+			c.Annotations[k] = v
+		}
+		if opts.DisableNameSuffixHash {
+			c.NameSuffixHash = false
+		}
+		if opts.Immutable {
+			c.Immutable = true
+		}
+	}
+	return c
+}
+
+// kustomizeInsertGenerated inserts a generated resource into the tree.
+// The merge and replace behaviors change a resource of the same kind and
+// name that's already in the tree.
+func kustomizeInsertGenerated(tree resource.Tree, obj *resource.Object, behavior string) error {
+	switch behavior {
+	case "", "create":
+		return tree.Insert(obj)
+	case "merge", "replace":
+	default:
+		return errors.Errorf("%s %s: unknown behavior %q", obj.GetKind(), obj.GetName(), behavior)
 	}
-	raw, err := io.ReadAll(content)
+
+	var existing *resource.Object
+	err := tree.Visit(resource.VisitorFunc(func(o *resource.Object) error {
+		if o.GetKind() == obj.GetKind() && o.GetName() == obj.GetName() &&
+			(obj.GetNamespace() == "" || o.GetNamespace() == obj.GetNamespace()) {
+			existing = o
+		}
+		return nil
+	}))
 	if err != nil {
 		return err
 	}
-
-	// TODO: read the json patch spec
-	var jp mutate.JSONPatch
-	// try jsonpatch first, if it doesn't decode, assume it's a strategicMergePatch
-	if err = yaml.NewDecoder(bytes.NewReader(raw)).Decode(&jp); err == nil {
-		return tree.Visit(&jp)
+	if existing == nil {
+		return errors.Errorf("%s %s: no existing resource to %s", obj.GetKind(), obj.GetName(), behavior)
 	}
-	var mergePatch mutate.StrategicMergePatch
-	if err := yaml.Unmarshal(raw, &mergePatch); err != nil {
+	existing, err = tree.Pop(resource.ParseKey(existing))
+	if err != nil {
 		return err
 	}
-	return tree.Visit(&mergePatch, o...)
+	obj.SetNamespace(existing.GetNamespace())
+	if behavior == "merge" {
+		for _, field := range []string{"data", "binaryData"} {
+			data, _ := existing.Object[field].(map[string]any)
+			if patch, ok := obj.Object[field].(map[string]any); ok {
+				if data == nil {
+					data = make(map[string]any)
+				}
+				for k, v := range patch {
+					data[k] = v
+				}
+			}
+			if data != nil {
+				obj.Object[field] = data
+			}
+		}
+		labels, annotations := obj.GetLabels(), obj.GetAnnotations()
+		obj.SetLabels(existing.GetLabels())
+		obj.AddLabels(labels)
+		obj.SetAnnotations(existing.GetAnnotations())
+		obj.AddAnnotations(annotations)
+	}
+	return tree.Insert(obj)
+}
+
+func ReadKustomizationFile(path path.Path) (*types.Kustomization, error) {
+	name, err := kustomizationFileName(path)
+	if err != nil {
+		return nil, err
+	}
+	return readKustomization(path, name)
+}
+
+// kustomizationFileName returns the name of the kustomization file in dir
+func kustomizationFileName(dir path.Path) (string, error) {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		ok, err := dir.Exists(name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return name, nil
+		}
+	}
+	return "", errors.Wrapf(os.ErrNotExist, dir.String(konfig.DefaultKustomizationFileName()))
+}
+
+// readKustomization decodes the kustomization file name in dir. Unknown
+// fields are an error.
+func readKustomization(dir path.Path, name string) (*types.Kustomization, error) {
+	f, err := dir.Reader(name)
+	if err != nil {
+		return nil, err
+	}
+	c := &types.Kustomization{}
+	d := yaml.NewDecoder(f)
+	d.KnownFields(true)
+	if err := d.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, dir.String(name))
+	}
+	return c, nil
+}
+
+// kustomizePatchContent returns the inline patch, or the content of the
+// patch file
+func kustomizePatchContent(dir path.Path, patch types.Patch) ([]byte, error) {
+	if len(patch.Path) == 0 {
+		return []byte(patch.Patch), nil
+	}
+	pp := dir.Join(patch.Path)
+	ok, err := pp.Exists()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrapf(os.ErrNotExist, pp.String())
+	}
+	content, err := pp.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(content)
 }
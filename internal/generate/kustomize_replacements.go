@@ -0,0 +1,448 @@
+package generate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/kustomize/api/types"
+
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// replace applies the replacements in order. Each replacement copies a
+// field of one source resource to fields of the target resources.
+func (k *kustomize) replace(fields []types.ReplacementField, dir path.Path, tree resource.Tree) error {
+	for _, field := range fields {
+		replacements := []types.Replacement{field.Replacement}
+		if field.Path != "" {
+			var err error
+			if replacements, err = readReplacements(dir, field.Path); err != nil {
+				return err
+			}
+		}
+		for _, r := range replacements {
+			if err := k.replacement(r, tree); err != nil {
+				return errors.Wrap(err, "replacements")
+			}
+		}
+	}
+	return nil
+}
+
+// readReplacements reads a file with either a list of replacements, or
+// a single replacement
+func readReplacements(dir path.Path, name string) ([]types.Replacement, error) {
+	data, err := dir.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var list []types.Replacement
+	if err := yaml.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+	var r types.Replacement
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil, errors.Wrapf(err, "failed to read replacements from %s", name)
+	}
+	return []types.Replacement{r}, nil
+}
+
+func (k *kustomize) replacement(r types.Replacement, tree resource.Tree) error {
+	if r.Source == nil || len(r.Targets) == 0 {
+		return errors.New("a replacement must have a source and at least one target")
+	}
+	value, err := k.replacementValue(r.Source, tree)
+	if err != nil {
+		return err
+	}
+	for _, target := range r.Targets {
+		if err := k.replaceTarget(target, value, tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacementValue returns the value of the source field. The source must
+// select exactly one resource.
+func (k *kustomize) replacementValue(source *types.SourceSelector, tree resource.Tree) (any, error) {
+	if source.Options != nil && source.Options.Encoding != "" {
+		return nil, errors.Wrap(ErrKustomizeUnsupported, "options.encoding")
+	}
+	var matches []*resource.Object
+	err := tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if k.selectedBy(obj, source.ResId) {
+			matches = append(matches, obj)
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(matches) == 0:
+		return nil, errors.Errorf("nothing selected by the source %s", source.ResId)
+	case len(matches) > 1:
+		return nil, errors.Errorf("multiple resources selected by the source %s", source.ResId)
+	}
+
+	fieldPath := source.FieldPath
+	if fieldPath == "" {
+		fieldPath = types.DefaultReplacementFieldPath
+	}
+	fields, err := lookupFields(matches[0].Object, nil, splitFieldPath(fieldPath), false)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 || fields[0].get() == nil {
+		return nil, errors.Errorf("fieldPath %q is missing for the source %s", fieldPath, source.ResId)
+	}
+	value := fields[0].get()
+	if source.Options == nil || source.Options.Delimiter == "" {
+		return copyFieldValue(value), nil
+	}
+	if !isScalar(value) {
+		return nil, errors.New("the delimiter option can only be used with scalar fields")
+	}
+	parts := strings.Split(fmt.Sprint(value), source.Options.Delimiter)
+	if index := source.Options.Index; index < 0 || index >= len(parts) {
+		return nil, errors.Errorf("options.index %d is out of bounds for the value %v", index, value)
+	}
+	return parts[source.Options.Index], nil
+}
+
+// replaceTarget copies the value to the fields of every resource that's
+// selected and isn't rejected by the target
+func (k *kustomize) replaceTarget(target *types.TargetSelector, value any, tree resource.Tree) error {
+	if target.Select == nil {
+		return errors.New("a target must select resources")
+	}
+	if target.Options != nil && target.Options.Encoding != "" {
+		return errors.Wrap(ErrKustomizeUnsupported, "options.encoding")
+	}
+	fieldPaths := target.FieldPaths
+	if len(fieldPaths) == 0 {
+		fieldPaths = []string{types.DefaultReplacementFieldPath}
+	}
+	create := target.Options != nil && target.Options.Create
+
+	return tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		ok, err := selectedByTarget(obj, target)
+		if err != nil || !ok {
+			return err
+		}
+		// the resource is selected if any of its keys is selected and
+		// isn't rejected
+		if !k.matchKeys(obj, func(key resource.Key) bool {
+			if !keySelectedBy(obj, key, target.Select.ResId) {
+				return false
+			}
+			for _, reject := range target.Reject {
+				if !reject.ResId.IsEmpty() && keySelectedBy(obj, key, reject.ResId) {
+					return false
+				}
+			}
+			return true
+		}) {
+			return nil
+		}
+		for _, fieldPath := range fieldPaths {
+			fields, err := lookupFields(obj.Object, nil, splitFieldPath(fieldPath), create)
+			if err != nil {
+				return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), fieldPath)
+			}
+			if len(fields) == 0 {
+				return errors.Errorf("%s: unable to find field %q in replacement target", resource.ParseKey(obj), fieldPath)
+			}
+			for _, field := range fields {
+				v, err := replaceField(field.get(), value, target.Options)
+				if err != nil {
+					return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), fieldPath)
+				}
+				field.set(v)
+			}
+		}
+		return nil
+	}))
+}
+
+// selectedByTarget reports whether the labels and annotations of the
+// resource match the select label and annotation selectors, and don't
+// match those of any reject
+func selectedByTarget(obj *resource.Object, target *types.TargetSelector) (bool, error) {
+	ok, err := matchesLabelSelectors(obj, target.Select)
+	if err != nil || !ok {
+		return false, err
+	}
+	for _, reject := range target.Reject {
+		if reject.LabelSelector == "" && reject.AnnotationSelector == "" {
+			continue
+		}
+		if ok, err := matchesLabelSelectors(obj, reject); ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchesLabelSelectors(obj *resource.Object, sel *types.Selector) (bool, error) {
+	labelSelector, err := labels.Parse(sel.LabelSelector)
+	if err != nil {
+		return false, err
+	}
+	annotationSelector, err := labels.Parse(sel.AnnotationSelector)
+	if err != nil {
+		return false, err
+	}
+	return labelSelector.Matches(labels.Set(obj.GetLabels())) &&
+		annotationSelector.Matches(labels.Set(obj.GetAnnotations())), nil
+}
+
+// replaceField returns the new value of a target field. A delimiter
+// replaces one part of the field, and scalar fields keep their type,
+// e.g. a string field is still a string when the value is a number.
+func replaceField(current, value any, options *types.FieldOptions) (any, error) {
+	value = copyFieldValue(value)
+	if options != nil && options.Delimiter != "" {
+		if current == nil {
+			current = ""
+		}
+		if !isScalar(current) || !isScalar(value) {
+			return nil, errors.New("the delimiter option can only be used with scalar fields")
+		}
+		parts := strings.Split(fmt.Sprint(current), options.Delimiter)
+		v := fmt.Sprint(value)
+		switch {
+		case options.Index < 0:
+			parts = append([]string{v}, parts...)
+		case options.Index >= len(parts):
+			parts = append(parts, v)
+		default:
+			parts[options.Index] = v
+		}
+		value = strings.Join(parts, options.Delimiter)
+	}
+	if current == nil || !isScalar(current) || !isScalar(value) {
+		return value, nil
+	}
+	s := fmt.Sprint(value)
+	switch current.(type) {
+	case string:
+		return s, nil
+	case int, int64:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+	case float64:
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n, nil
+		}
+	case bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return value, nil
+}
+
+func isScalar(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	return true
+}
+
+// copyFieldValue returns a deep copy of a field, so the same value can be
+// set on more than one target
+func copyFieldValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[key] = copyFieldValue(item)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for k, item := range v {
+			l[k] = copyFieldValue(item)
+		}
+		return l
+	}
+	return value
+}
+
+// splitFieldPath splits a replacement field path on the dots that aren't
+// in brackets, e.g. spec.containers.[name=app].image
+func splitFieldPath(fieldPath string) []string {
+	var rv []string
+	depth, start := 0, 0
+	for k, c := range fieldPath {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				rv = append(rv, fieldPath[start:k])
+				start = k + 1
+			}
+		}
+	}
+	return append(rv, fieldPath[start:])
+}
+
+// fieldRef is a field found by a field path
+type fieldRef struct {
+	get func() any
+	set func(value any)
+}
+
+// lookupFields returns the fields at path in value. Items of a list are
+// selected by [key=value], [=value] for lists of scalars, an index, or
+// * for every item. If create is true, missing fields and list items are
+// created, and set replaces value itself, e.g. when an item is appended
+// to a list.
+func lookupFields(value any, set func(any), path []string, create bool) ([]fieldRef, error) {
+	segment, rest := path[0], path[1:]
+	switch v := value.(type) {
+	case map[string]any:
+		if strings.HasPrefix(segment, "[") {
+			return nil, errors.Errorf("expected a list at %s, but got a mapping", segment)
+		}
+		next, ok := v[segment]
+		if len(rest) == 0 {
+			if !ok && !create {
+				return nil, nil
+			}
+			return []fieldRef{{
+				get: func() any { return v[segment] },
+				set: func(value any) { v[segment] = value },
+			}}, nil
+		}
+		if !ok || next == nil {
+			if !create {
+				return nil, nil
+			}
+			next = newFieldContainer(rest[0])
+			v[segment] = next
+		}
+		return lookupFields(next, func(value any) { v[segment] = value }, rest, create)
+	case []any:
+		indexes, err := listIndexes(v, segment)
+		if err != nil {
+			return nil, err
+		}
+		if len(indexes) == 0 && create && canAppend(v, segment) {
+			item, err := newListItem(segment, rest)
+			if err != nil {
+				return nil, err
+			}
+			v = append(v, item)
+			set(v)
+			indexes = []int{len(v) - 1}
+		}
+		var fields []fieldRef
+		for _, k := range indexes {
+			k := k
+			if len(rest) == 0 {
+				fields = append(fields, fieldRef{
+					get: func() any { return v[k] },
+					set: func(value any) { v[k] = value },
+				})
+				continue
+			}
+			if v[k] == nil {
+				if !create {
+					continue
+				}
+				v[k] = newFieldContainer(rest[0])
+			}
+			found, err := lookupFields(v[k], func(value any) { v[k] = value }, rest, create)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, found...)
+		}
+		return fields, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, errors.Errorf("expected a mapping or a list at %s, but got %T", segment, value)
+}
+
+// listIndexes returns the indexes of the items of a list that are
+// selected by segment
+func listIndexes(list []any, segment string) ([]int, error) {
+	if segment == "*" {
+		indexes := make([]int, len(list))
+		for k := range list {
+			indexes[k] = k
+		}
+		return indexes, nil
+	}
+	if n, err := strconv.Atoi(segment); err == nil {
+		if n < 0 || n >= len(list) {
+			return nil, nil
+		}
+		return []int{n}, nil
+	}
+	key, value, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]"), "=")
+	if !strings.HasPrefix(segment, "[") || !ok {
+		return nil, errors.Errorf("expected [key=value], an index or * to select list items, got %s", segment)
+	}
+	var indexes []int
+	for k, item := range list {
+		if key == "" {
+			if isScalar(item) && fmt.Sprint(item) == value {
+				indexes = append(indexes, k)
+			}
+			continue
+		}
+		if m, ok := item.(map[string]any); ok && isScalar(m[key]) && fmt.Sprint(m[key]) == value {
+			indexes = append(indexes, k)
+		}
+	}
+	return indexes, nil
+}
+
+// canAppend reports whether an item can be created for segment. Items
+// selected by an index are only created at the end of the list.
+func canAppend(list []any, segment string) bool {
+	if n, err := strconv.Atoi(segment); err == nil {
+		return n == len(list)
+	}
+	return segment != "*"
+}
+
+// newListItem returns the item that's appended to a list when no items
+// are selected by segment
+func newListItem(segment string, rest []string) (any, error) {
+	if _, err := strconv.Atoi(segment); err == nil {
+		if len(rest) == 0 {
+			return nil, nil
+		}
+		return newFieldContainer(rest[0]), nil
+	}
+	key, value, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]"), "=")
+	if key == "" {
+		return value, nil
+	}
+	return map[string]any{key: value}, nil
+}
+
+// newFieldContainer returns an empty list if segment selects list items,
+// and an empty mapping otherwise
+func newFieldContainer(segment string) any {
+	if _, err := strconv.Atoi(segment); err == nil || segment == "*" || strings.HasPrefix(segment, "[") {
+		return []any{}
+	}
+	return make(map[string]any)
+}
@@ -0,0 +1,312 @@
+package generate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/pkg/errors"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+const kustomizeDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+  selector:
+    matchLabels: {app: app}
+  template:
+    metadata:
+      labels: {app: app}
+    spec:
+      containers:
+      - name: app
+        image: nginx:1.23
+        env:
+        - name: DB_HOST
+          value: localhost
+        - name: PORT
+          value: "80"
+`
+
+const kustomizeService = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector: {app: app}
+  ports:
+  - port: 8080
+`
+
+// buildKustomize builds the kustomization in files, and returns the
+// resources by kind and name
+func buildKustomize(t *testing.T, files map[string]string) (map[string]map[string]any, error) {
+	tree, err := newKustomize().Build(newMemoryPath(t, files))
+	if err != nil {
+		return nil, err
+	}
+	rv := make(map[string]map[string]any)
+	return rv, tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		rv[obj.GetKind()+"/"+obj.GetName()] = obj.Object
+		return nil
+	}))
+}
+
+func TestKustomize_Build(t *testing.T) {
+	cases := map[string]struct {
+		kustomization string
+		files         map[string]string
+		check         func(c *qt.C, objs map[string]map[string]any)
+	}{
+		"labels": {
+			kustomization: `
+resources: [deployment.yaml, service.yaml]
+labels:
+- pairs: {team: web}
+- pairs: {tier: frontend}
+  includeTemplates: true
+commonLabels:
+  env: prod
+`,
+			check: func(c *qt.C, objs map[string]map[string]any) {
+				deploy := objs["Deployment/app"]
+				metadata := deploy["metadata"].(map[string]any)
+				c.Assert(metadata["labels"], qt.DeepEquals, map[string]any{"team": "web", "tier": "frontend", "env": "prod"})
+				spec := deploy["spec"].(map[string]any)
+				c.Assert(spec["selector"], qt.DeepEquals, map[string]any{
+					"matchLabels": map[string]any{"app": "app", "env": "prod"},
+				})
+				template := spec["template"].(map[string]any)["metadata"].(map[string]any)
+				c.Assert(template["labels"], qt.DeepEquals, map[string]any{"app": "app", "tier": "frontend", "env": "prod"})
+				service := objs["Service/app"]["spec"].(map[string]any)
+				c.Assert(service["selector"], qt.DeepEquals, map[string]any{"app": "app", "env": "prod"})
+			},
+		},
+		"replicas and images": {
+			kustomization: `
+resources: [deployment.yaml]
+namePrefix: web-
+replicas:
+- name: app
+  count: 3
+images:
+- name: nginx
+  newName: registry.example.com/nginx
+  newTag: "1.25"
+`,
+			check: func(c *qt.C, objs map[string]map[string]any) {
+				spec := objs["Deployment/web-app"]["spec"].(map[string]any)
+				c.Assert(spec["replicas"], qt.Equals, int64(3))
+				container := spec["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)[0]
+				c.Assert(container.(map[string]any)["image"], qt.Equals, "registry.example.com/nginx:1.25")
+			},
+		},
+		"patchesStrategicMerge": {
+			kustomization: `
+resources: [deployment.yaml, service.yaml]
+namePrefix: web-
+patchesStrategicMerge:
+- patch.yaml
+- |-
+  apiVersion: v1
+  kind: Service
+  metadata:
+    name: app
+  $patch: delete
+`,
+			files: map[string]string{
+				"patch.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        env:
+        - name: DB_HOST
+          value: db
+`,
+			},
+			check: func(c *qt.C, objs map[string]map[string]any) {
+				c.Assert(objs, qt.HasLen, 1)
+				spec := objs["Deployment/web-app"]["spec"].(map[string]any)
+				container := spec["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)[0]
+				c.Assert(container.(map[string]any)["env"], qt.DeepEquals, []any{
+					map[string]any{"name": "DB_HOST", "value": "db"},
+					map[string]any{"name": "PORT", "value": "80"},
+				})
+			},
+		},
+		"patchesJson6902 targets the resources that match": {
+			kustomization: `
+resources: [deployment.yaml, service.yaml]
+namePrefix: web-
+patchesJson6902:
+- target: {kind: Service, name: app}
+  patch: |-
+    - op: replace
+      path: /spec/ports/0/port
+      value: 9090
+`,
+			check: func(c *qt.C, objs map[string]map[string]any) {
+				ports := objs["Service/web-app"]["spec"].(map[string]any)["ports"]
+				c.Assert(ports, qt.DeepEquals, []any{map[string]any{"port": float64(9090)}})
+				c.Assert(objs["Deployment/web-app"]["spec"].(map[string]any)["replicas"], qt.Equals, 1)
+			},
+		},
+		"replacements": {
+			kustomization: `
+resources: [deployment.yaml, service.yaml]
+replacements:
+- source:
+    kind: Service
+    name: app
+  targets:
+  - select:
+      kind: Deployment
+    fieldPaths:
+    - spec.template.spec.containers.[name=app].env.[name=DB_HOST].value
+- path: replacements.yaml
+`,
+			files: map[string]string{
+				"replacements.yaml": `
+source:
+  kind: Service
+  fieldPath: spec.ports.0.port
+targets:
+- select:
+    kind: Deployment
+  fieldPaths:
+  - spec.template.spec.containers.[name=app].env.[name=PORT].value
+  - spec.template.metadata.annotations.port
+  options:
+    create: true
+- select:
+    kind: Deployment
+  fieldPaths:
+  - spec.template.spec.containers.0.image
+  options:
+    delimiter: ":"
+    index: 1
+`,
+			},
+			check: func(c *qt.C, objs map[string]map[string]any) {
+				template := objs["Deployment/app"]["spec"].(map[string]any)["template"].(map[string]any)
+				container := template["spec"].(map[string]any)["containers"].([]any)[0].(map[string]any)
+				c.Assert(container["env"], qt.DeepEquals, []any{
+					map[string]any{"name": "DB_HOST", "value": "app"},
+					map[string]any{"name": "PORT", "value": "8080"},
+				})
+				c.Assert(container["image"], qt.Equals, "nginx:8080")
+				c.Assert(template["metadata"].(map[string]any)["annotations"], qt.DeepEquals, map[string]any{"port": 8080})
+			},
+		},
+		"buildMetadata": {
+			kustomization: `
+resources: [service.yaml]
+configMapGenerator:
+- name: app
+  literals: [port=8080]
+  options:
+    disableNameSuffixHash: true
+buildMetadata: [originAnnotations, managedByLabel]
+`,
+			check: func(c *qt.C, objs map[string]map[string]any) {
+				service := objs["Service/app"]["metadata"].(map[string]any)
+				c.Assert(service["annotations"], qt.DeepEquals, map[string]any{
+					"config.kubernetes.io/origin": "path: service.yaml\n",
+				})
+				c.Assert(service["labels"], qt.DeepEquals, map[string]any{"app.kubernetes.io/managed-by": "dinghy"})
+				cm := objs["ConfigMap/app"]["metadata"].(map[string]any)
+				c.Assert(cm["annotations"], qt.DeepEquals, map[string]any{
+					"config.kubernetes.io/origin": "configuredIn: kustomization.yaml\n" +
+						"configuredBy:\n  apiVersion: builtin\n  kind: ConfigMapGenerator\n",
+				})
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			files := map[string]string{
+				"kustomization.yaml": tc.kustomization,
+				"deployment.yaml":    kustomizeDeployment,
+				"service.yaml":       kustomizeService,
+			}
+			for k, v := range tc.files {
+				files[k] = v
+			}
+			objs, err := buildKustomize(t, files)
+			qt.Assert(t, err, qt.IsNil)
+			tc.check(qt.New(t), objs)
+		})
+	}
+}
+
+func TestKustomize_Build_Errors(t *testing.T) {
+	cases := map[string]struct {
+		kustomization string
+		err           error
+		msg           string
+	}{
+		"vars": {
+			kustomization: "resources: [service.yaml]\nvars:\n- name: SERVICE\n  objref: {kind: Service, name: app, apiVersion: v1}\n",
+			err:           ErrKustomizeUnsupported,
+		},
+		"label fields": {
+			kustomization: "labels:\n- pairs: {a: b}\n  fields:\n  - path: spec/labels\n",
+			err:           ErrKustomizeUnsupported,
+		},
+		"transformerAnnotations": {
+			kustomization: "resources: [service.yaml]\nbuildMetadata: [transformerAnnotations]\n",
+			err:           ErrKustomizeUnsupported,
+		},
+		"unknown field": {
+			kustomization: "resources: [service.yaml]\nnamePrefixes: web-\n",
+			msg:           `(?s).*field namePrefixes not found.*`,
+		},
+		"replicas without a match": {
+			kustomization: "resources: [service.yaml]\nreplicas:\n- name: app\n  count: 2\n",
+			msg:           `replicas: no Deployment, ReplicaSet, StatefulSet or ReplicationController named app`,
+		},
+		"replacement target field is missing": {
+			kustomization: `
+resources: [service.yaml]
+replacements:
+- source: {kind: Service, name: app}
+  targets:
+  - select: {kind: Service}
+    fieldPaths: [spec.clusterIP]
+`,
+			msg: `replacements: .*unable to find field "spec.clusterIP" in replacement target`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := buildKustomize(t, map[string]string{
+				"kustomization.yaml": tc.kustomization,
+				"service.yaml":       kustomizeService,
+			})
+			qt.Assert(t, err, qt.IsNotNil)
+			if tc.err != nil {
+				qt.Assert(t, errors.Is(err, tc.err), qt.IsTrue, qt.Commentf("%v", err))
+			}
+			if tc.msg != "" {
+				qt.Assert(t, err, qt.ErrorMatches, tc.msg)
+			}
+		})
+	}
+}
+
+func TestSplitFieldPath(t *testing.T) {
+	qt.Assert(t, splitFieldPath("spec.containers.[name=app.v1].image"), qt.DeepEquals,
+		[]string{"spec", "containers", "[name=app.v1]", "image"})
+	qt.Assert(t, splitFieldPath("metadata.name"), qt.DeepEquals, []string{"metadata", "name"})
+}
@@ -2,47 +2,42 @@ package generate
 
 import (
 	"github.com/pkg/errors"
-	"reflect"
+
+	"github.com/johnhoman/dinghy/internal/registry"
 )
 
 var (
-	ErrNotFound = errors.New("mutator not found")
+	ErrNotFound = errors.New("generator not found")
 )
 
-func Get(name string) (any, error) {
-	f, ok := r.store[name]
-	if !ok {
-		return nil, ErrNotFound
-	}
-	return f(), nil
-}
+// Registry maps names to generators. Registries are values, so that
+// builds in the same process can use different sets of generators.
+type Registry = registry.Registry[Generator]
 
-func Has(name string) bool {
-	_, ok := r.store[name]
-	return ok
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return registry.New[Generator](ErrNotFound)
 }
 
-// Register registers a new Mutator under the provided name. newConfig should
-// be a function that returns the required data structure for the Mutator. It
-// will be up to the Mutator to convert the config to the correct type. The registry
-// will handle deserializing YAML into the returned config when the Mutator plugin
-// is invoked
-func Register(f Generator) {
-	r.store[f.Name()] = func() any {
-		t := reflect.TypeOf(f).Elem()
-		return reflect.New(t).Interface()
-	}
+// Default returns a copy of the registry of builtin generators, which
+// can be extended without changing the builtins
+func Default() *Registry {
+	return builtins.Clone()
 }
 
-type registry struct {
-	store map[string]func() any
-}
+// builtins are the generators that are always available
+var builtins = NewRegistry()
 
-var r = &registry{store: make(map[string]func() any)}
+// RegisterBuiltin adds a Generator to the builtins, so that every registry
+// returned by Default after it's called has the Generator
+func RegisterBuiltin(g Generator) {
+	builtins.Register(g)
+}
 
 func init() {
-	// only visitors can traverse the Tree, so the mutator registry should reference
-	// visitors, and all the visitors can live in the visitor.
-	Register(&Kustomize{})
-	Register(&Template{})
+	builtins.Register(&Kustomize{})
+	builtins.Register(&Template{})
+	builtins.Register(&Script{})
+	builtins.Register(&ConfigMap{})
+	builtins.Register(&Secret{})
 }
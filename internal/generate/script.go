@@ -0,0 +1,72 @@
+package generate
+
+import (
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/script"
+)
+
+var (
+	_ Generator        = &Script{}
+	_ yaml.Unmarshaler = &Script{}
+	_ script.HostAware = &Script{}
+	_ script.Loader    = &Script{}
+)
+
+// Script generates resources with javascript. The script MUST define a
+// function `generate` with the signature generate(config), which returns
+// an array of the resources to generate.
+type Script struct {
+	script.Plugin
+}
+
+// NewScript returns a Script that runs the provided source, such as
+// a script loaded from a module. The Script is registered under name,
+// and the `with` config is passed to the generate function as is.
+func NewScript(name, source string, opts ...script.Option) *Script {
+	return &Script{Plugin: script.NewPlugin(name, source, opts...)}
+}
+
+func (s *Script) UnmarshalYAML(value *yaml.Node) error {
+	return s.Decode(value, "generate")
+}
+
+func (s *Script) JSONSchema() *jsonschema.Schema {
+	return s.Schema("generate")
+}
+
+func (s *Script) Load() error {
+	return s.Compile("generate")
+}
+
+// Emit calls the generate function and inserts each returned
+// resource into a new tree
+func (s *Script) Emit(ctx *context.Context) (resource.Tree, error) {
+	v, err := s.Call("generate")
+	if err != nil {
+		return nil, err
+	}
+
+	tree := resource.NewTree()
+	if script.IsNullish(v) {
+		return tree, nil
+	}
+	items, ok := v.Export().([]any)
+	if !ok {
+		return nil, errors.Errorf("generate must return an array of resources, got %s", v.ExportType())
+	}
+	for k, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("generate returned a %T at index %d, expected a resource", item, k)
+		}
+		if err := tree.Insert(resource.Unstructured(m)); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
@@ -0,0 +1,63 @@
+package generate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func TestScript_Emit(t *testing.T) {
+	s := &Script{}
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+script: |
+  function generate(config) {
+    return config.names.map(name => ({
+      apiVersion: "v1",
+      kind: "ServiceAccount",
+      metadata: {name: name, namespace: config.namespace},
+    }))
+  }
+config:
+  namespace: foo
+  names:
+  - bar
+  - baz
+`), s), qt.IsNil)
+
+	tree, err := s.Emit(context.NewContext(false))
+	qt.Assert(t, err, qt.IsNil)
+	for _, name := range []string{"bar", "baz"} {
+		obj, err := resource.GetResource(tree, resource.Key{
+			GroupVersion: "v1",
+			Kind:         "ServiceAccount",
+			Name:         name,
+			Namespace:    "foo",
+		})
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, obj.GetName(), qt.Equals, name)
+	}
+}
+
+func TestScript_Emit_InvalidResult(t *testing.T) {
+	s := &Script{}
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+script: |
+  function generate(config) {
+    return ["foo"]
+  }
+`), s), qt.IsNil)
+	_, err := s.Emit(context.NewContext(false))
+	qt.Assert(t, err, qt.ErrorMatches, `generate returned a string at index 0, expected a resource`)
+}
+
+func TestScript_UnmarshalYAML_MissingFunction(t *testing.T) {
+	err := yaml.Unmarshal([]byte(`
+script: |
+  function mutate(obj, config) {}
+`), &Script{})
+	qt.Assert(t, err, qt.ErrorMatches, `generate function not found`)
+}
@@ -9,6 +9,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/johnhoman/dinghy/internal/context"
+	"github.com/johnhoman/dinghy/internal/decode"
 	"github.com/johnhoman/dinghy/internal/errors"
 	"github.com/johnhoman/dinghy/internal/path"
 	"github.com/johnhoman/dinghy/internal/resource"
@@ -23,6 +24,11 @@ var (
 	_ Generator        = &Template{}
 )
 
+type templateConfig struct {
+	Source string         `yaml:"source" json:"source"`
+	Values map[string]any `yaml:"values" json:"values"`
+}
+
 type Template struct {
 	source path.Path
 	values map[string]any
@@ -33,32 +39,14 @@ func (t *Template) Name() string {
 }
 
 func (t *Template) UnmarshalYAML(value *yaml.Node) error {
-	var in struct {
-		Source string         `yaml:"source" json:"source"`
-		Values map[string]any `yaml:"values" json:"values"`
-	}
-
-	var m map[string]any
-	if err := value.Decode(&m); err != nil {
-		return &errors.ErrDecodeGenerator{
-			Name:   t.Name(),
-			Schema: jsonschema.Reflect(in),
-			Err:    err,
-		}
-	}
-
+	var in templateConfig
 	// the value.Decode method doesn't provide a way to only
-	// parse known fields, so I have to decode it with the KnownFields flag
-	// set
-
-	data, _ := yaml.Marshal(m)
-	d := yaml.NewDecoder(bytes.NewReader(data))
-	d.KnownFields(true)
-
-	if err := d.Decode(&in); err != nil {
-		return &errors.ErrDecodeGenerator{
+	// parse known fields, so decode.Node checks them against the node
+	if err := decode.Node(value, &in, ""); err != nil {
+		return &errors.ErrDecodePlugin{
+			Kind:   "generator",
 			Name:   t.Name(),
-			Schema: jsonschema.Reflect(in),
+			Schema: t.JSONSchema(),
 			Err:    err,
 		}
 	}
@@ -76,6 +64,10 @@ func (t *Template) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+func (t *Template) JSONSchema() *jsonschema.Schema {
+	return decode.Schema(&templateConfig{})
+}
+
 func (t *Template) Emit(ctx *context.Context) (resource.Tree, error) {
 	source := t.source
 	if source.Relative() {
@@ -87,7 +79,7 @@ func (t *Template) Emit(ctx *context.Context) (resource.Tree, error) {
 		source = root.Join(source.String())
 	}
 
-	templates, vars, err := templateBuildDir(source)
+	templates, vars, err := templateBuildSource(source)
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +122,23 @@ func templateReadConfig(source path.Path) (TemplateConfig, error) {
 	return c, yaml.NewDecoder(f).Decode(&c)
 }
 
+// templateBuildSource reads the templates from source, which can either
+// be a template directory or a single template file
+func templateBuildSource(source path.Path) ([]string, map[string]any, error) {
+	isDir, err := source.IsDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	if isDir {
+		return templateBuildDir(source)
+	}
+	s, err := source.ReadText()
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{s}, nil, nil
+}
+
 func templateBuildDir(source path.Path) (templates []string, vars map[string]any, err error) {
 	var c TemplateConfig
 	c, err = templateReadConfig(source)
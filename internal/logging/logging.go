@@ -2,6 +2,7 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"sync"
@@ -26,8 +27,13 @@ type Logger struct {
 }
 
 func New() *Logger {
+	return NewWriter(os.Stderr)
+}
+
+// NewWriter returns a Logger that writes to w
+func NewWriter(w io.Writer) *Logger {
 	return &Logger{
-		log: log.New(os.Stderr, "", 0),
+		log: log.New(w, "", 0),
 		mu:  &sync.Mutex{},
 	}
 }
@@ -42,6 +48,14 @@ func (log *Logger) Debug(format string, args ...any) {
 	log.log.Printf(log.pre+Gray+"DEBUG: %s"+Reset, fmt.Sprintf(format, args...))
 }
 
+func (log *Logger) Info(format string, args ...any) {
+	log.log.Printf(log.pre+Blue+"INFO: %s %s", Reset, fmt.Sprintf(format, args...))
+}
+
+func (log *Logger) Warn(format string, args ...any) {
+	log.log.Printf(log.pre+Yellow+"WARN: %s %s", Reset, fmt.Sprintf(format, args...))
+}
+
 func (log *Logger) Ok(format string, args ...any) {
 	log.log.Printf(log.pre+Green+"OK:   %s %s", Reset, fmt.Sprintf(format, args...))
 }
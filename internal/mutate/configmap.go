@@ -1,9 +1,10 @@
 package mutate
 
 import (
-	"bytes"
 	"encoding/json"
 	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/invopop/jsonschema"
+	"github.com/johnhoman/dinghy/internal/decode"
 	"github.com/johnhoman/dinghy/internal/resource"
 	"github.com/johnhoman/dinghy/internal/visitor"
 	"github.com/pkg/errors"
@@ -20,6 +21,11 @@ var (
 	_ resource.Visitor = &ConfigMapJSONPatch{}
 )
 
+type configMapJSONPatchConfig struct {
+	Key   string `yaml:"key"`
+	Patch []any  `yaml:"patch"`
+}
+
 type ConfigMapJSONPatch struct {
 	// Key is the config map key to patch. The value
 	// at the provided key will be decoded into
@@ -32,19 +38,8 @@ func (c *ConfigMapJSONPatch) Name() string {
 }
 
 func (c *ConfigMapJSONPatch) UnmarshalYAML(value *yaml.Node) error {
-	var in struct {
-		Key   string `yaml:"key"`
-		Patch []any  `yaml:"patch"`
-	}
-
-	var m map[string]any
-	if err := value.Decode(&m); err != nil {
-		return err
-	}
-	data, _ := yaml.Marshal(m)
-	d := yaml.NewDecoder(bytes.NewReader(data))
-	d.KnownFields(true)
-	if err := d.Decode(&in); err != nil {
+	var in configMapJSONPatchConfig
+	if err := decode.Node(value, &in, ""); err != nil {
 		return err
 	}
 
@@ -61,6 +56,10 @@ func (c *ConfigMapJSONPatch) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+func (c *ConfigMapJSONPatch) JSONSchema() *jsonschema.Schema {
+	return decode.Schema(&configMapJSONPatchConfig{})
+}
+
 func (c *ConfigMapJSONPatch) Visit(obj *resource.Object) error {
 	raw, err := json.Marshal(c.Patch)
 	if err != nil {
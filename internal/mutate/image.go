@@ -2,87 +2,117 @@ package mutate
 
 import (
 	"context"
-	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/johnhoman/dinghy/internal/oci"
 	"github.com/johnhoman/dinghy/internal/resource"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"net/http"
+	"github.com/johnhoman/dinghy/internal/types"
 )
 
 var (
-	_ Mutator = &ImageResolver{}
+	_ Mutator        = &ImageResolver{}
+	_ types.EnvAware = &ImageResolver{}
 )
 
-// ImageResolver resolves image tags for workload resources
-// to the digest. It will pull your local docker configuration
-// for access to any private registries
-type ImageResolver struct{}
+// ImageResolver pins the images of workload resources to the digest
+// their tag currently points to, e.g. nginx:1.25 becomes
+// nginx@sha256:.... Images that already have a digest aren't changed.
+// Credentials for private registries are read from the docker config.
+type ImageResolver struct {
+	// DockerConfig is the docker config file credentials are read
+	// from. It defaults to $DOCKER_CONFIG/config.json or
+	// ~/.docker/config.json.
+	DockerConfig string `yaml:"dockerConfig"`
+	// Insecure are registries that are accessed with plain HTTP
+	Insecure []string `yaml:"insecure"`
+
+	// client is created on first use, unless it's provided by a test
+	client *oci.Client
+	ctx    context.Context
+	// digests caches the digest of each image, since the same image is
+	// usually used by more than one resource
+	digests map[string]string
+	mu      sync.Mutex
+}
 
 func (i *ImageResolver) Name() string {
 	return "builtin.dinghy.dev/imageTagResolver"
 }
 
+// SetEnv sets the build context, so that registry requests are
+// cancelled when the build deadline passes
+func (i *ImageResolver) SetEnv(env types.Env) {
+	i.ctx = env.Context
+}
+
 func (i *ImageResolver) Visit(obj *resource.Object) error {
-	switch obj.GroupVersionKind().GroupKind() {
-	case schema.GroupKind{Group: "", Kind: "Pod"}:
-		pod := &corev1.Pod{}
-		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pod); err != nil {
-			return err
+	for _, c := range obj.Containers() {
+		image, _ := c["image"].(string)
+		if image == "" {
+			continue
 		}
-		for k := range pod.Spec.Containers {
-			image := pod.Spec.Containers[k].Image
-			if image == "" {
-				continue
-			}
-
+		pinned, err := i.resolve(image)
+		if err != nil {
+			return errors.Wrapf(err, "%s: container %q", resource.ParseKey(obj), c["name"])
 		}
-	case schema.GroupKind{Group: "apps", Kind: "ReplicaSet"}:
-		panic("not implemented")
-	case schema.GroupKind{Group: "apps", Kind: "StatefulSet"}:
-		panic("not implemented")
-	case schema.GroupKind{Group: "apps", Kind: "Deployment"}:
-		panic("not implemented")
-	case schema.GroupKind{Group: "apps", Kind: "DaemonSet"}:
-		panic("not implemented")
-	case schema.GroupKind{Group: "batch", Kind: "Job"}:
-		panic("not implemented")
-	case schema.GroupKind{Group: "batch", Kind: "CronJob"}:
-		panic("not implemented")
+		c["image"] = pinned
 	}
 	return nil
 }
 
-func getImageDigest(imageName, tag string) (digest string, err error) {
-	// Create an HTTP client
-	client := http.DefaultClient
-
-	// Send a HEAD request to get the image manifest
-	url := fmt.Sprintf("https://registry.hub.docker.com/v2/%s/manifests/%s", imageName, tag)
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodHead, url, nil)
+// resolve returns the image with its tag replaced by the digest
+func (i *ImageResolver) resolve(image string) (string, error) {
+	ref, err := oci.ParseReference(image)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	if ref.Digest != "" {
+		return image, nil
+	}
 
-	resp, err := client.Do(req)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if pinned, ok := i.digests[image]; ok {
+		return pinned, nil
+	}
+	client, err := i.getClient()
 	if err != nil {
 		return "", err
 	}
-	defer func() {
-		err = resp.Body.Close()
-	}()
-
-	// Check if the request was successful
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to retrieve image manifest: %s", resp.Status)
+	ctx := i.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	digest, err := client.Digest(ctx, ref)
+	if err != nil {
+		return "", err
 	}
 
-	// Get the Docker-Content-Digest header
-	digest = resp.Header.Get("Docker-Content-Digest")
-	if digest == "" {
-		return "", fmt.Errorf("image digest not found in response headers")
+	// keep the name as written, so that the image is still pulled from
+	// the same place, and replace the tag
+	name, _, _ := splitImage(image)
+	pinned := name + "@" + digest
+	if i.digests == nil {
+		i.digests = make(map[string]string)
 	}
+	i.digests[image] = pinned
+	return pinned, nil
+}
 
-	return digest, nil
+func (i *ImageResolver) getClient() (*oci.Client, error) {
+	if i.client != nil {
+		return i.client, nil
+	}
+	name := i.DockerConfig
+	if name == "" {
+		name = oci.DefaultDockerConfig()
+	}
+	config, err := oci.LoadDockerConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	i.client = &oci.Client{Keychain: config, Insecure: i.Insecure}
+	return i.client, nil
 }
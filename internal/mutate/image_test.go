@@ -0,0 +1,131 @@
+package mutate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/oci"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func TestImageResolver_Visit(t *testing.T) {
+	digests := map[string]string{
+		"/v2/app/manifests/1.0":     "sha256:aaa",
+		"/v2/sidecar/manifests/2.0": "sha256:bbb",
+		"/v2/init/manifests/latest": "sha256:ccc",
+		"/v2/debug/manifests/3.0":   "sha256:ddd",
+	}
+	requests := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		digest, ok := digests[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	podSpec := func() map[string]any {
+		return map[string]any{
+			"initContainers": []any{
+				map[string]any{"name": "init", "image": host + "/init"},
+			},
+			"containers": []any{
+				map[string]any{"name": "app", "image": host + "/app:1.0"},
+				map[string]any{"name": "sidecar", "image": host + "/sidecar:2.0"},
+				map[string]any{"name": "pinned", "image": host + "/pinned:1.0@sha256:eee"},
+			},
+		}
+	}
+	pod := podSpec()
+	pod["ephemeralContainers"] = []any{
+		map[string]any{"name": "debug", "image": host + "/debug:3.0"},
+	}
+	want := []string{
+		host + "/init@sha256:ccc",
+		host + "/app@sha256:aaa",
+		host + "/sidecar@sha256:bbb",
+		host + "/pinned:1.0@sha256:eee",
+	}
+
+	tests := map[string]struct {
+		obj  *resource.Object
+		want []string
+	}{
+		"Pod": {
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]any{"name": "app"},
+				"spec":       pod,
+			}),
+			want: append(append([]string{}, want...), host+"/debug@sha256:ddd"),
+		},
+		"Deployment": {
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]any{"name": "app"},
+				"spec":       map[string]any{"template": map[string]any{"spec": podSpec()}},
+			}),
+			want: want,
+		},
+		"CronJob": {
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "batch/v1",
+				"kind":       "CronJob",
+				"metadata":   map[string]any{"name": "app"},
+				"spec": map[string]any{
+					"jobTemplate": map[string]any{
+						"spec": map[string]any{"template": map[string]any{"spec": podSpec()}},
+					},
+				},
+			}),
+			want: want,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &ImageResolver{client: &oci.Client{HTTP: srv.Client()}}
+			qt.Assert(t, m.Visit(tt.obj), qt.IsNil)
+			got := make([]string, 0)
+			for _, c := range tt.obj.Containers() {
+				got = append(got, c["image"].(string))
+			}
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+
+	// digests are cached, so the same image is only resolved once
+	requests = 0
+	m := &ImageResolver{client: &oci.Client{HTTP: srv.Client()}}
+	for k := 0; k < 2; k++ {
+		qt.Assert(t, m.Visit(resource.Unstructured(map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   map[string]any{"name": "app"},
+			"spec":       podSpec(),
+		})), qt.IsNil)
+	}
+	// one HEAD request for each of init, app and sidecar
+	qt.Assert(t, requests, qt.Equals, 3)
+
+	obj := resource.Unstructured(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]any{"name": "missing"},
+		"spec": map[string]any{
+			"containers": []any{map[string]any{"name": "app", "image": host + "/missing:1.0"}},
+		},
+	})
+	err := m.Visit(obj)
+	qt.Assert(t, err, qt.ErrorIs, oci.ErrNotFound)
+	qt.Assert(t, err, qt.ErrorMatches, `v1.Pod/missing: container "app": .*`)
+}
@@ -0,0 +1,186 @@
+package mutate
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/decode"
+	"github.com/johnhoman/dinghy/internal/oci"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+var (
+	_ Mutator          = &Images{}
+	_ yaml.Unmarshaler = &Images{}
+)
+
+// Image rewrites the images named Name. Only the fields that are set
+// are changed.
+type Image struct {
+	// Name is the image to rewrite, without a tag or digest, e.g. nginx
+	Name string `yaml:"name" dinghy:"required"`
+	// NewName replaces the registry and repository of the image
+	NewName string `yaml:"newName"`
+	// NewTag replaces the tag of the image, and removes its digest
+	NewTag string `yaml:"newTag"`
+	// Digest replaces the digest of the image, and removes its tag
+	// unless NewTag is also set
+	Digest string `yaml:"digest"`
+}
+
+type imagesConfig struct {
+	Images []Image `yaml:"images"`
+	// Paths are the image fields of kinds that aren't in images.yaml,
+	// such as custom resources, e.g. spec/template/spec/containers[]/image
+	Paths map[string][]string `yaml:"paths"`
+}
+
+// Images rewrites the name, tag or digest of images in every workload,
+// and in the custom resources listed in images.yaml
+type Images struct {
+	Images []Image
+	// Paths are added to the image paths of images.yaml
+	Paths map[string][]string
+}
+
+func (i *Images) Name() string {
+	return "builtin.dinghy.dev/images"
+}
+
+// UnmarshalYAML decodes either a list of images, or an object with the
+// images and the paths of additional kinds
+func (i *Images) UnmarshalYAML(value *yaml.Node) error {
+	images, field := value, ""
+	if value.Kind == yaml.SequenceNode {
+		if err := decode.Node(value, &i.Images, ""); err != nil {
+			return err
+		}
+	} else {
+		var in imagesConfig
+		if err := decode.Node(value, &in, ""); err != nil {
+			return err
+		}
+		i.Images, i.Paths = in.Images, in.Paths
+		images, field = decode.MappingValue(value, "images"), "images"
+	}
+	for k, image := range i.Images {
+		if image.Name == "" {
+			item := decode.SequenceItem(images, k)
+			return decode.NodeError(item, fmt.Sprintf("%s[%d].name", field, k), errors.New("is a required field"))
+		}
+	}
+	return nil
+}
+
+func (i *Images) JSONSchema() *jsonschema.Schema {
+	return decode.Schema(&imagesConfig{})
+}
+
+func (i *Images) Visit(obj *resource.Object) error {
+	for _, c := range obj.Containers() {
+		if image, ok := c["image"].(string); ok {
+			c["image"] = i.rewrite(image)
+		}
+	}
+	key := obj.GroupVersionKind().GroupKind().String()
+	paths := append(append([]string{}, imageRefs[key]...), i.Paths[key]...)
+	for _, path := range paths {
+		if err := i.setImage(obj.Object, path); err != nil {
+			return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), path)
+		}
+	}
+	return nil
+}
+
+// setImage rewrites the image at path, which is written in the syntax
+// of visitPath. Missing fields are skipped.
+func (i *Images) setImage(obj map[string]any, path string) error {
+	return visitPath(obj, path, false, func(m map[string]any, field string) error {
+		value, ok := m[field]
+		if !ok || value == nil {
+			return nil
+		}
+		image, ok := value.(string)
+		if !ok {
+			return errors.Errorf("expected the image to be a string, got %T", value)
+		}
+		m[field] = i.rewrite(image)
+		return nil
+	})
+}
+
+// rewrite returns the image with the first matching rule applied
+func (i *Images) rewrite(image string) string {
+	name, tag, digest := splitImage(image)
+	for _, rule := range i.Images {
+		if !sameImage(name, rule.Name) {
+			continue
+		}
+		if rule.NewName != "" {
+			name = rule.NewName
+		}
+		switch {
+		case rule.NewTag != "" && rule.Digest != "":
+			tag, digest = rule.NewTag, rule.Digest
+		case rule.NewTag != "":
+			tag, digest = rule.NewTag, ""
+		case rule.Digest != "":
+			tag, digest = "", rule.Digest
+		}
+		break
+	}
+	rv := name
+	if tag != "" {
+		rv += ":" + tag
+	}
+	if digest != "" {
+		rv += "@" + digest
+	}
+	return rv
+}
+
+// splitImage splits an image into its name, tag and digest
+func splitImage(image string) (name, tag, digest string) {
+	name, digest, _ = strings.Cut(image, "@")
+	// the tag is after the last colon, unless the colon is part of the
+	// registry port, e.g. localhost:5000/app
+	if k := strings.LastIndex(name, ":"); k > strings.LastIndex(name, "/") {
+		name, tag = name[:k], name[k+1:]
+	}
+	return name, tag, digest
+}
+
+// sameImage reports whether two image names refer to the same image, e.g.
+// nginx and docker.io/library/nginx
+func sameImage(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, err := oci.ParseReference(a)
+	if err != nil {
+		return false
+	}
+	rb, err := oci.ParseReference(b)
+	if err != nil {
+		return false
+	}
+	return ra.Registry == rb.Registry && ra.Repository == rb.Repository
+}
+
+var (
+	//go:embed images.yaml
+	imageRefContent []byte
+	imageRefs       map[string][]string
+)
+
+func init() {
+	imageRefs = make(map[string][]string)
+	if err := yaml.Unmarshal(imageRefContent, &imageRefs); err != nil {
+		panic(errors.Wrap(err, "failed to unmarshal image refs"))
+	}
+}
@@ -0,0 +1,155 @@
+package mutate
+
+import (
+	"sort"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func TestImages_Visit(t *testing.T) {
+	images := []Image{
+		{Name: "nginx", NewTag: "1.25"},
+		{Name: "ghcr.io/org/app", NewName: "registry.example.com/app"},
+		{Name: "busybox", Digest: "sha256:abc"},
+		{Name: "localhost:5000/sidecar", NewName: "sidecar", NewTag: "2.0", Digest: "sha256:def"},
+	}
+	tests := map[string]struct {
+		paths map[string][]string
+		obj   *resource.Object
+		want  []string
+	}{
+		"Deployment": {
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]any{"name": "web"},
+				"spec": map[string]any{
+					"template": map[string]any{
+						"spec": map[string]any{
+							"initContainers": []any{
+								map[string]any{"name": "init", "image": "busybox:1.36"},
+							},
+							"containers": []any{
+								map[string]any{"name": "web", "image": "docker.io/library/nginx:1.24@sha256:old"},
+								map[string]any{"name": "app", "image": "ghcr.io/org/app:v1"},
+								map[string]any{"name": "sidecar", "image": "localhost:5000/sidecar"},
+								map[string]any{"name": "other", "image": "redis:7"},
+							},
+						},
+					},
+				},
+			}),
+			want: []string{
+				"docker.io/library/nginx:1.25",
+				"registry.example.com/app:v1",
+				"sidecar:2.0@sha256:def",
+				"redis:7",
+				"busybox@sha256:abc",
+			},
+		},
+		"Rollout": {
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata":   map[string]any{"name": "web"},
+				"spec": map[string]any{
+					"template": map[string]any{
+						"spec": map[string]any{
+							"containers": []any{map[string]any{"name": "web", "image": "nginx"}},
+						},
+					},
+				},
+			}),
+			want: []string{"nginx:1.25"},
+		},
+		"CustomPaths": {
+			paths: map[string][]string{
+				"Pipeline.example.com": {"spec/steps[]/image"},
+			},
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "example.com/v1",
+				"kind":       "Pipeline",
+				"metadata":   map[string]any{"name": "build"},
+				"spec": map[string]any{
+					"steps": []any{
+						map[string]any{"image": "busybox"},
+						map[string]any{"name": "no-image"},
+						map[string]any{"image": "ghcr.io/org/app:v2"},
+					},
+				},
+			}),
+			want: []string{"busybox@sha256:abc", "registry.example.com/app:v2"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &Images{Images: images, Paths: tt.paths}
+			qt.Assert(t, m.Visit(tt.obj), qt.IsNil)
+			got := collectImages(tt.obj.Object)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestImages_UnmarshalYAML(t *testing.T) {
+	var m Images
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+- name: nginx
+  newTag: "1.25"
+`), &m), qt.IsNil)
+	qt.Assert(t, m.Images, qt.DeepEquals, []Image{{Name: "nginx", NewTag: "1.25"}})
+
+	m = Images{}
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+images:
+- name: nginx
+  digest: sha256:abc
+paths:
+  Pipeline.example.com:
+  - spec/steps[]/image
+`), &m), qt.IsNil)
+	qt.Assert(t, m.Images, qt.DeepEquals, []Image{{Name: "nginx", Digest: "sha256:abc"}})
+	qt.Assert(t, m.Paths, qt.DeepEquals, map[string][]string{"Pipeline.example.com": {"spec/steps[]/image"}})
+
+	err := yaml.Unmarshal([]byte(`
+images:
+- newTag: "1.25"
+`), &Images{})
+	qt.Assert(t, err, qt.ErrorMatches, `.*images\[0\]\.name.*is a required field`)
+
+	err = yaml.Unmarshal([]byte(`
+- name: nginx
+  tag: "1.25"
+`), &Images{})
+	qt.Assert(t, err, qt.ErrorMatches, `.*unknown field "tag"`)
+}
+
+// collectImages returns the value of every image field in the object,
+// ordered by key so that the result is stable
+func collectImages(v any) []string {
+	rv := make([]string, 0)
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if image, ok := v[key].(string); ok && key == "image" {
+				rv = append(rv, image)
+				continue
+			}
+			rv = append(rv, collectImages(v[key])...)
+		}
+	case []any:
+		for _, item := range v {
+			rv = append(rv, collectImages(item)...)
+		}
+	}
+	return rv
+}
@@ -3,6 +3,7 @@ package mutate
 import (
 	"encoding/json"
 	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/invopop/jsonschema"
 	"github.com/johnhoman/dinghy/internal/resource"
 	"gopkg.in/yaml.v3"
 )
@@ -36,6 +37,14 @@ func (j *JSONPatch) UnmarshalYAML(value *yaml.Node) error {
 	return json.Unmarshal(raw, &j.patch)
 }
 
+func (j *JSONPatch) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		Type:        "array",
+		Description: "a list of RFC 6902 JSON patch operations",
+		Items:       &jsonschema.Schema{Type: "object"},
+	}
+}
+
 func (j *JSONPatch) Visit(obj *resource.Object) error {
 	return obj.JSONPatch(j.patch)
 }
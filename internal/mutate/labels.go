@@ -2,17 +2,23 @@ package mutate
 
 import (
 	_ "embed"
+
+	"github.com/invopop/jsonschema"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
-	"strings"
 
+	"github.com/johnhoman/dinghy/internal/decode"
+	"github.com/johnhoman/dinghy/internal/logging"
 	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
 )
 
 var (
 	_ Mutator          = &Labels{}
 	_ Mutator          = &MatchLabels{}
 	_ yaml.Unmarshaler = &MatchLabels{}
+	_ types.EnvAware   = &MatchLabels{}
+	_ yaml.Unmarshaler = &labelPath{}
 )
 
 // Labels mutates the labels on a resource and any selectors that may
@@ -32,103 +38,170 @@ func (l *Labels) Visit(obj *resource.Object) error {
 
 // MatchLabels get applied to all resources, but in some cases also
 // make changes to the resource spec, such as matchLabels in a deployment,
-// or service labels in a selector.
+// or service labels in a selector. The label paths of each kind are
+// listed in labels.yaml.
 type MatchLabels struct {
 	m map[string]string
+	// metadataOnly only sets the labels of the resource and its templates,
+	// and leaves selectors unchanged
+	metadataOnly bool
+	logger       *logging.Logger
+}
+
+type matchLabelsConfig struct {
+	Labels map[string]string `yaml:"labels"`
+	// MetadataOnly only sets the labels of the resource and its templates,
+	// such as the pod template of a Deployment, and leaves selectors
+	// unchanged. Use it to add labels to resources that already exist,
+	// since the selectors of most workloads can't be changed.
+	MetadataOnly bool `yaml:"metadataOnly"`
+}
+
+// NewMatchLabels returns a MatchLabels that adds labels. If metadataOnly
+// is true, selectors are left unchanged.
+func NewMatchLabels(labels map[string]string, metadataOnly bool) *MatchLabels {
+	return &MatchLabels{m: labels, metadataOnly: metadataOnly}
 }
 
 func (l *MatchLabels) Name() string {
 	return "builtin.dinghy.dev/matchLabels"
 }
 
+// UnmarshalYAML decodes either the labels, or an object with the labels
+// and options
 func (l *MatchLabels) UnmarshalYAML(value *yaml.Node) error {
-	return value.Decode(&l.m)
+	if labels := decode.MappingValue(value, "labels"); labels == nil || labels.Kind != yaml.MappingNode {
+		return value.Decode(&l.m)
+	}
+	var in matchLabelsConfig
+	if err := decode.Node(value, &in, ""); err != nil {
+		return err
+	}
+	l.m, l.metadataOnly = in.Labels, in.MetadataOnly
+	return nil
+}
+
+func (l *MatchLabels) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		OneOf: []*jsonschema.Schema{
+			{
+				Type:                 "object",
+				Description:          "labels to add to the resource and its selectors",
+				AdditionalProperties: &jsonschema.Schema{Type: "string"},
+			},
+			decode.Schema(&matchLabelsConfig{}),
+		},
+	}
+}
+
+// SetEnv sets the logger that selector warnings are written to
+func (l *MatchLabels) SetEnv(env types.Env) {
+	l.logger = env.Logger
 }
 
 func (l *MatchLabels) Visit(obj *resource.Object) error {
 	obj.AddLabels(l.m)
 	key := obj.GroupVersionKind().GroupKind().String()
-	paths, ok := labelRefs[key]
-	if !ok {
+	refs := labelRefs[key]
+	for _, path := range refs.Metadata {
+		if _, err := l.setLabels(obj.Object, path, true); err != nil {
+			return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), path)
+		}
+	}
+	if l.metadataOnly {
 		return nil
 	}
-	for lk, lv := range l.m {
-		for _, path := range paths {
-			current := obj.Object
-			parts := strings.Split(path, "/")
-			for k, part := range parts {
-				next, ok := current[part]
-				if !ok {
-					current[part] = make(map[string]any)
-					next = current[part]
-				}
-				current, ok = next.(map[string]any)
-				if !ok {
-					return errors.Errorf("expected field to be a mapping, but got %T: %s",
-						next, strings.Join(parts[:k+1], "."))
-				}
+	for _, selector := range refs.Selectors {
+		changed, err := l.setLabels(obj.Object, selector.Path, selector.Create)
+		if err != nil {
+			return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), selector.Path)
+		}
+		if changed && selector.Immutable && l.logger != nil {
+			l.logger.Warn("%s: changing the selector %s, which is immutable, so an existing %s can't be "+
+				"updated and must be replaced. Set metadataOnly to leave selectors unchanged",
+				resource.ParseKey(obj), selector.Path, obj.GetKind())
+		}
+	}
+	if spec, ok := obj.PodSpec(); ok {
+		for _, selector := range labelRefs[podSpecRefs].Selectors {
+			if _, err := l.setLabels(spec, selector.Path, selector.Create); err != nil {
+				return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), selector.Path)
 			}
-			current[lk] = lv
 		}
 	}
 	return nil
 }
 
-type deepSetNameRef struct {
-	to      string
-	from    string
-	refSpec map[string][]string
-}
-
-func (ds *deepSetNameRef) setValue(obj map[string]any, path ...string) {
-	if len(path) == 0 {
-		panic("BUG: this should never get here")
-	}
-	zero := path[0]
-	if len(path) == 1 {
-		if obj[zero].(string) == ds.from {
-			obj[zero] = ds.to
+// setLabels sets the labels at path, which is written in the syntax of
+// visitPath. Missing fields are created if create is true, and are
+// skipped otherwise. It reports whether labels that already existed were
+// changed.
+func (l *MatchLabels) setLabels(m map[string]any, path string, create bool) (bool, error) {
+	changed := false
+	err := visitPath(m, path, create, func(m map[string]any, field string) error {
+		value, existed := m[field]
+		existed = existed && value != nil
+		if !existed {
+			if !create {
+				return nil
+			}
+			value = make(map[string]any)
+			m[field] = value
 		}
-		return
-	}
-	switch o := obj[zero].(type) {
-	case map[string]any:
-		ds.setValue(o, path[1:]...)
-	case []any:
-		for k := 0; k < len(o); k++ {
-			ds.setValue(o[k].(map[string]any), path[1:]...)
+		labels, ok := value.(map[string]any)
+		if !ok {
+			return errors.Errorf("expected %s to be an object, got %T", field, value)
 		}
-	}
+		for lk, lv := range l.m {
+			if current, ok := labels[lk]; existed && (!ok || current != lv) {
+				changed = true
+			}
+			labels[lk] = lv
+		}
+		return nil
+	})
+	return changed, err
 }
 
-func (ds *deepSetNameRef) Visit(obj *resource.Object) error {
-	gk := obj.GroupVersionKind().GroupKind().String()
-	paths, ok := ds.refSpec[gk]
-	if !ok {
+// labelPath is the location of a label selector
+type labelPath struct {
+	Path string `yaml:"path"`
+	// Create creates the selector if it doesn't exist
+	Create bool `yaml:"create"`
+	// Immutable selectors can't be changed once the resource exists
+	Immutable bool `yaml:"immutable"`
+}
+
+// UnmarshalYAML decodes either a path, or a labelPath. Create defaults
+// to true.
+func (p *labelPath) UnmarshalYAML(value *yaml.Node) error {
+	p.Create = true
+	if value.Kind == yaml.ScalarNode {
+		p.Path = value.Value
 		return nil
 	}
-	o := obj.Object
-	for _, path := range paths {
-		parts := strings.Split(path, "/")
-		ds.setValue(o, parts...)
-	}
-	return nil
+	type path labelPath
+	return value.Decode((*path)(p))
 }
 
-func newDeepSet(to, from string, refSpec map[string][]string) *deepSetNameRef {
-	return &deepSetNameRef{from: from, to: to, refSpec: refSpec}
+// labelRef are the label paths of a kind
+type labelRef struct {
+	// Metadata are the labels of templates
+	Metadata []string `yaml:"metadata"`
+	// Selectors are label selectors
+	Selectors []labelPath `yaml:"selectors"`
 }
 
 var (
 	//go:embed labels.yaml
 	labelRefContent []byte
-	labelRefs       map[string][]string
+	labelRefs       map[string]labelRef
 )
 
 func init() {
-	labelRefs = make(map[string][]string)
+	labelRefs = make(map[string]labelRef)
 	err := yaml.Unmarshal(labelRefContent, &labelRefs)
 	if err != nil {
-		panic("failed to decode label refs")
+		panic(errors.Wrap(err, "failed to unmarshal label refs"))
 	}
 }
@@ -1,9 +1,15 @@
 package mutate
 
 import (
+	"bytes"
+	"testing"
+
 	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/logging"
 	"github.com/johnhoman/dinghy/internal/resource"
-	"testing"
+	"github.com/johnhoman/dinghy/internal/types"
 )
 
 func TestCommonLabels_Visit(t *testing.T) {
@@ -62,3 +68,259 @@ func TestCommonLabels_Visit(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchLabels_Visit_Selectors(t *testing.T) {
+	labels := map[string]string{"app.kubernetes.io/part-of": "feast"}
+	tests := map[string]struct {
+		metadataOnly bool
+		obj          string
+		want         string
+		wantWarning  bool
+	}{
+		"DeploymentSelectorChanged": {
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  selector: {matchLabels: {app: web}}
+  template:
+    metadata: {labels: {app: web}}
+    spec:
+      topologySpreadConstraints:
+      - {maxSkew: 1, topologyKey: zone, labelSelector: {matchLabels: {app: web}}}
+      - {maxSkew: 1, topologyKey: node, labelSelector: {matchExpressions: []}}
+`,
+			want: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  selector: {matchLabels: {app: web, app.kubernetes.io/part-of: feast}}
+  template:
+    metadata: {labels: {app: web, app.kubernetes.io/part-of: feast}}
+    spec:
+      topologySpreadConstraints:
+      - {maxSkew: 1, topologyKey: zone, labelSelector: {matchLabels: {app: web, app.kubernetes.io/part-of: feast}}}
+      - {maxSkew: 1, topologyKey: node, labelSelector: {matchExpressions: []}}
+`,
+			wantWarning: true,
+		},
+		"DeploymentMetadataOnly": {
+			metadataOnly: true,
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  selector: {matchLabels: {app: web}}
+  template:
+    metadata: {labels: {app: web}}
+`,
+			want: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  selector: {matchLabels: {app: web}}
+  template:
+    metadata: {labels: {app: web, app.kubernetes.io/part-of: feast}}
+`,
+		},
+		"DeploymentSelectorUnchanged": {
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+`,
+			want: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+  template:
+    metadata: {labels: {app.kubernetes.io/part-of: feast}}
+`,
+		},
+		"CronJob": {
+			obj: `
+apiVersion: batch/v1
+kind: CronJob
+metadata: {name: backup}
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec: {}
+`,
+			want: `
+apiVersion: batch/v1
+kind: CronJob
+metadata: {name: backup, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  jobTemplate:
+    metadata: {labels: {app.kubernetes.io/part-of: feast}}
+    spec:
+      template:
+        metadata: {labels: {app.kubernetes.io/part-of: feast}}
+        spec: {}
+`,
+		},
+		"NetworkPolicy": {
+			obj: `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata: {name: deny}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web}}
+    - namespaceSelector: {matchLabels: {team: web}}
+`,
+			want: `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata: {name: deny, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web, app.kubernetes.io/part-of: feast}}
+    - namespaceSelector: {matchLabels: {team: web}}
+`,
+		},
+		"StatefulSetWithoutClaims": {
+			obj: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata: {name: db}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+  template:
+    metadata: {labels: {app: db}}
+`,
+			want: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata: {name: db, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+  template:
+    metadata: {labels: {app: db, app.kubernetes.io/part-of: feast}}
+`,
+		},
+		"StatefulSetClaims": {
+			obj: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata: {name: db}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+  template:
+    metadata: {labels: {app: db}}
+  volumeClaimTemplates:
+  - metadata: {name: data}
+  - metadata: {name: wal, labels: {tier: fast}}
+`,
+			want: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata: {name: db, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+  template:
+    metadata: {labels: {app: db, app.kubernetes.io/part-of: feast}}
+  volumeClaimTemplates:
+  - metadata: {name: data, labels: {app.kubernetes.io/part-of: feast}}
+  - metadata: {name: wal, labels: {tier: fast, app.kubernetes.io/part-of: feast}}
+`,
+		},
+		"PodAffinityWithoutTerms": {
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+  template:
+    spec:
+      affinity: {podAntiAffinity: {}}
+`,
+			want: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  selector: {matchLabels: {app.kubernetes.io/part-of: feast}}
+  template:
+    metadata: {labels: {app.kubernetes.io/part-of: feast}}
+    spec:
+      affinity: {podAntiAffinity: {}}
+`,
+		},
+		"PodDisruptionBudget": {
+			obj: `
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata: {name: web}
+spec:
+  minAvailable: 1
+  selector: {matchLabels: {app: web}}
+`,
+			want: `
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata: {name: web, labels: {app.kubernetes.io/part-of: feast}}
+spec:
+  minAvailable: 1
+  selector: {matchLabels: {app: web, app.kubernetes.io/part-of: feast}}
+`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			l := &MatchLabels{m: labels, metadataOnly: tt.metadataOnly}
+			l.SetEnv(types.Env{Logger: logging.NewWriter(buf)})
+
+			obj := unmarshalObject(t, tt.obj)
+			qt.Assert(t, l.Visit(obj), qt.IsNil)
+			qt.Assert(t, obj.Object, qt.DeepEquals, unmarshalObject(t, tt.want).Object)
+			if tt.wantWarning {
+				qt.Assert(t, buf.String(), qt.Contains, "apps.v1.Deployment/web: changing the selector spec/selector/matchLabels")
+			} else {
+				qt.Assert(t, buf.String(), qt.Equals, "")
+			}
+		})
+	}
+}
+
+func TestMatchLabels_UnmarshalYAML(t *testing.T) {
+	tests := map[string]struct {
+		in               string
+		want             map[string]string
+		wantMetadataOnly bool
+	}{
+		"Labels": {
+			in:   `{app: web, labels: web}`,
+			want: map[string]string{"app": "web", "labels": "web"},
+		},
+		"Config": {
+			in:               `{labels: {app: web}, metadataOnly: true}`,
+			want:             map[string]string{"app": "web"},
+			wantMetadataOnly: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var l MatchLabels
+			qt.Assert(t, yaml.Unmarshal([]byte(tt.in), &l), qt.IsNil)
+			qt.Assert(t, l.m, qt.DeepEquals, tt.want)
+			qt.Assert(t, l.metadataOnly, qt.Equals, tt.wantMetadataOnly)
+		})
+	}
+}
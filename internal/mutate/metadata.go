@@ -1,6 +1,7 @@
 package mutate
 
 import (
+	"github.com/invopop/jsonschema"
 	"github.com/johnhoman/dinghy/internal/resource"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -8,10 +9,8 @@ import (
 
 var (
 	_ Mutator = &Annotations{}
-	_ Mutator = &Namespace{}
 	_ Mutator = &Metadata{}
 
-	_ yaml.Unmarshaler = &Namespace{}
 	_ yaml.Unmarshaler = &Metadata{}
 )
 
@@ -29,33 +28,6 @@ func (m *Annotations) Visit(obj *resource.Object) error {
 	return nil
 }
 
-type Namespace struct {
-	Namespace string `yaml:"name"`
-}
-
-func (n *Namespace) UnmarshalYAML(value *yaml.Node) error {
-	var in struct {
-		Name string `yaml:"name"`
-	}
-	if err := value.Decode(&in); err != nil {
-		return err
-	}
-	n.Namespace = in.Name
-	return nil
-}
-
-func (n *Namespace) Name() string {
-	return "builtin.dinghy.dev/metadata/namespace"
-}
-
-func (n *Namespace) Visit(obj *resource.Object) error {
-	if obj == nil {
-		return errors.Errorf("resource cannot be nil")
-	}
-	obj.SetNamespace(n.Namespace)
-	return nil
-}
-
 type Metadata struct {
 	patch map[string]any
 }
@@ -69,6 +41,10 @@ func (m *Metadata) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+func (m *Metadata) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "object", Description: "a merge patch for the resource metadata"}
+}
+
 func (m *Metadata) Name() string {
 	return "builtin.dinghy.dev/metadata"
 }
@@ -2,20 +2,61 @@ package mutate
 
 import (
 	_ "embed"
-	"github.com/johnhoman/dinghy/internal/resource"
+
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/resource"
 )
 
 var (
-	_ Mutator = &Name{}
+	_ Mutator           = &Name{}
+	_ SideEffectVisitor = &Name{}
+	_ yaml.Unmarshaler  = &NameRef{}
 )
 
+// podSpecRefs are the references relative to the pod spec of every
+// workload kind
+const podSpecRefs = "PodSpec"
+
+// NameRefs are name references, keyed by the referenced kind and then by
+// the kind that holds the reference, e.g. ConfigMap and then Deployment.apps
+type NameRefs map[string]map[string][]NameRef
+
+// NameRef is the location of a reference to a resource by name
+type NameRef struct {
+	// Path is the slash separated path to the name. List fields are
+	// written with a [] suffix, e.g. spec/tls[]/secretName, and every
+	// item of a list along the path is visited.
+	Path string `yaml:"path"`
+	// Kind is a field next to the name with the kind of the reference,
+	// such as the kind of a RoleBinding subject. The reference is only
+	// changed if the field matches the kind of the renamed resource.
+	Kind string `yaml:"kind"`
+	// Namespace is a field next to the name with the namespace of the
+	// reference. If it's not set, the reference is in the namespace of
+	// the resource that holds it.
+	Namespace string `yaml:"namespace"`
+}
+
+// UnmarshalYAML decodes either a path, or a NameRef
+func (n *NameRef) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		n.Path = value.Value
+		return nil
+	}
+	type nameRef NameRef
+	return value.Decode((*nameRef)(n))
+}
+
 // Name mutates the name on a resource and any resources that may
 // reference that name
 type Name struct {
 	Prefix string `yaml:"prefix"`
 	Suffix string `yaml:"suffix"`
+	// References are added to the references in name.yaml, such as
+	// the references held by custom resources
+	References NameRefs `yaml:"references"`
 }
 
 func (n *Name) Name() string {
@@ -42,24 +83,98 @@ func (n *Name) Visit(obj *resource.Object) error {
 // name is changed, any Deployments, StatefulSets, pods, DaemonSets, ..., etc that
 // reference it will also need to change the reference name
 func (n *Name) SideEffect(old *resource.Object, tree resource.Tree) error {
-	key := old.GroupVersionKind().GroupKind().String()
-	return tree.Visit(newDeepSet(n.newName(old), old.GetName(), nameRefs[key]))
+	return RenameReferences(tree, old, n.newName(old), n.References)
 }
 
 func (n *Name) newName(obj *resource.Object) string {
 	return n.Prefix + obj.GetName() + n.Suffix
 }
 
+// RenameReferences changes every reference in the tree to the renamed
+// resource. References are read from name.yaml and refs.
+func RenameReferences(tree resource.Tree, old *resource.Object, name string, refs NameRefs) error {
+	key := old.GroupVersionKind().GroupKind().String()
+	r := &renameRefs{
+		kind:      old.GetKind(),
+		namespace: old.GetNamespace(),
+		from:      old.GetName(),
+		to:        name,
+		refs:      make(map[string][]NameRef),
+	}
+	if r.from == r.to {
+		return nil
+	}
+	for _, catalog := range []NameRefs{nameRefs, refs} {
+		for kind, paths := range catalog[key] {
+			r.refs[kind] = append(r.refs[kind], paths...)
+		}
+	}
+	return tree.Visit(r)
+}
+
+// renameRefs changes references to a resource that was renamed
+type renameRefs struct {
+	kind      string
+	namespace string
+	from, to  string
+	// refs are keyed by the kind that holds the reference
+	refs map[string][]NameRef
+}
+
+func (r *renameRefs) Visit(obj *resource.Object) error {
+	gk := obj.GroupVersionKind().GroupKind().String()
+	for _, ref := range r.refs[gk] {
+		if err := r.rename(obj.Object, obj.GetNamespace(), ref); err != nil {
+			return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), ref.Path)
+		}
+	}
+	if spec, ok := obj.PodSpec(); ok {
+		for _, ref := range r.refs[podSpecRefs] {
+			if err := r.rename(spec, obj.GetNamespace(), ref); err != nil {
+				return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), ref.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// rename changes the name at path if it references the renamed resource
+func (r *renameRefs) rename(m map[string]any, namespace string, ref NameRef) error {
+	return visitPath(m, ref.Path, false, func(m map[string]any, field string) error {
+		if name, ok := m[field].(string); !ok || name != r.from {
+			return nil
+		}
+		if ref.Kind != "" {
+			if kind, _ := m[ref.Kind].(string); kind != r.kind {
+				return nil
+			}
+		}
+		namespace := namespace
+		if ref.Namespace != "" {
+			if ns, ok := m[ref.Namespace].(string); ok {
+				namespace = ns
+			}
+		}
+		// resources without a namespace, including cluster scoped resources,
+		// match references from every namespace
+		if r.namespace != "" && namespace != r.namespace {
+			return nil
+		}
+		m[field] = r.to
+		return nil
+	})
+}
+
 var (
 	//go:embed name.yaml
 	nameRefContent []byte
-	nameRefs       map[string]map[string][]string
+	nameRefs       NameRefs
 )
 
 func init() {
-	nameRefs = make(map[string]map[string][]string)
+	nameRefs = make(NameRefs)
 	err := yaml.Unmarshal(nameRefContent, &nameRefs)
 	if err != nil {
-		panic(errors.Wrap(err, "failed to unmarshal configmap refs"))
+		panic(errors.Wrap(err, "failed to unmarshal name refs"))
 	}
 }
@@ -4,6 +4,7 @@ import (
 	qt "github.com/frankban/quicktest"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/johnhoman/dinghy/internal/resource"
+	"gopkg.in/yaml.v3"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"testing"
@@ -108,3 +109,238 @@ func TestName_SideEffect_SkipsIfNoReferencingResources(t *testing.T) {
 	err := name.SideEffect(oldObj, tree)
 	c.Assert(err, qt.IsNil)
 }
+
+func TestName_SideEffect_References(t *testing.T) {
+	tests := map[string]struct {
+		// old is the renamed resource
+		old        string
+		references NameRefs
+		// referrer holds the references, and want is the referrer after the rename
+		referrer string
+		want     string
+	}{
+		"SecretInCronJob": {
+			old: `{apiVersion: v1, kind: Secret, metadata: {name: creds, namespace: app}}`,
+			referrer: `
+apiVersion: batch/v1
+kind: CronJob
+metadata: {name: backup, namespace: app}
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          imagePullSecrets: [{name: creds}]
+          volumes: [{name: creds, secret: {secretName: creds}}]
+          containers:
+          - name: backup
+            envFrom: [{secretRef: {name: creds}}]
+            env: [{name: TOKEN, valueFrom: {secretKeyRef: {name: creds, key: token}}}]
+`,
+			want: `
+apiVersion: batch/v1
+kind: CronJob
+metadata: {name: backup, namespace: app}
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          imagePullSecrets: [{name: pre-creds}]
+          volumes: [{name: creds, secret: {secretName: pre-creds}}]
+          containers:
+          - name: backup
+            envFrom: [{secretRef: {name: pre-creds}}]
+            env: [{name: TOKEN, valueFrom: {secretKeyRef: {name: pre-creds, key: token}}}]
+`,
+		},
+		"ServiceAccountSubjects": {
+			old: `{apiVersion: v1, kind: ServiceAccount, metadata: {name: app, namespace: app}}`,
+			referrer: `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata: {name: app}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: ClusterRole, name: app}
+subjects:
+- {kind: ServiceAccount, name: app, namespace: app}
+- {kind: ServiceAccount, name: app, namespace: other}
+- {kind: User, name: app}
+`,
+			want: `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata: {name: app}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: ClusterRole, name: app}
+subjects:
+- {kind: ServiceAccount, name: pre-app, namespace: app}
+- {kind: ServiceAccount, name: app, namespace: other}
+- {kind: User, name: app}
+`,
+		},
+		"RoleRef": {
+			old: `{apiVersion: rbac.authorization.k8s.io/v1, kind: Role, metadata: {name: app, namespace: app}}`,
+			referrer: `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata: {name: app, namespace: app}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: Role, name: app}
+`,
+			want: `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata: {name: app, namespace: app}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: Role, name: pre-app}
+`,
+		},
+		"HorizontalPodAutoscaler": {
+			old: `{apiVersion: apps/v1, kind: Deployment, metadata: {name: web}}`,
+			referrer: `
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata: {name: web}
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: Deployment, name: web}
+`,
+			want: `
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata: {name: web}
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: Deployment, name: pre-web}
+`,
+		},
+		"HorizontalPodAutoscalerOtherKind": {
+			old: `{apiVersion: apps/v1, kind: Deployment, metadata: {name: web}}`,
+			referrer: `
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata: {name: web}
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: StatefulSet, name: web}
+`,
+			want: `
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata: {name: web}
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: StatefulSet, name: web}
+`,
+		},
+		"Ingress": {
+			old: `{apiVersion: v1, kind: Service, metadata: {name: web}}`,
+			referrer: `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata: {name: web}
+spec:
+  rules:
+  - http:
+      paths:
+      - {path: /, backend: {service: {name: web, port: {number: 80}}}}
+      - {path: /api, backend: {service: {name: api, port: {number: 80}}}}
+`,
+			want: `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata: {name: web}
+spec:
+  rules:
+  - http:
+      paths:
+      - {path: /, backend: {service: {name: pre-web, port: {number: 80}}}}
+      - {path: /api, backend: {service: {name: api, port: {number: 80}}}}
+`,
+		},
+		"APIService": {
+			old: `{apiVersion: v1, kind: Service, metadata: {name: metrics, namespace: kube-system}}`,
+			referrer: `
+apiVersion: apiregistration.k8s.io/v1
+kind: APIService
+metadata: {name: v1beta1.metrics.k8s.io}
+spec:
+  service: {name: metrics, namespace: kube-system}
+`,
+			want: `
+apiVersion: apiregistration.k8s.io/v1
+kind: APIService
+metadata: {name: v1beta1.metrics.k8s.io}
+spec:
+  service: {name: pre-metrics, namespace: kube-system}
+`,
+		},
+		"NamespaceMismatch": {
+			old: `{apiVersion: v1, kind: ConfigMap, metadata: {name: config, namespace: app}}`,
+			referrer: `
+apiVersion: v1
+kind: Pod
+metadata: {name: web, namespace: other}
+spec:
+  volumes: [{name: config, configMap: {name: config}}]
+`,
+			want: `
+apiVersion: v1
+kind: Pod
+metadata: {name: web, namespace: other}
+spec:
+  volumes: [{name: config, configMap: {name: config}}]
+`,
+		},
+		"CustomReferences": {
+			old: `{apiVersion: v1, kind: Service, metadata: {name: web}}`,
+			references: NameRefs{
+				"Service": {"Rollout.argoproj.io": {
+					{Path: "spec/strategy/canary/stableService"},
+					{Path: "spec/strategy/canary/canaryService"},
+				}},
+			},
+			referrer: `
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata: {name: web}
+spec:
+  strategy:
+    canary: {stableService: web, canaryService: web-canary}
+`,
+			want: `
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata: {name: web}
+spec:
+  strategy:
+    canary: {stableService: pre-web, canaryService: web-canary}
+`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			old := unmarshalObject(t, tt.old)
+			referrer := unmarshalObject(t, tt.referrer)
+			tree := resource.NewTree()
+			qt.Assert(t, tree.Insert(referrer), qt.IsNil)
+
+			m := &Name{Prefix: "pre-", References: tt.references}
+			qt.Assert(t, m.SideEffect(old, tree), qt.IsNil)
+			qt.Assert(t, referrer.Object, qt.DeepEquals, unmarshalObject(t, tt.want).Object)
+		})
+	}
+}
+
+func TestNameRef_UnmarshalYAML(t *testing.T) {
+	var refs []NameRef
+	err := yaml.Unmarshal([]byte(`
+- spec/serviceName
+- {path: "subjects[]/name", kind: kind, namespace: namespace}
+`), &refs)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, refs, qt.DeepEquals, []NameRef{
+		{Path: "spec/serviceName"},
+		{Path: "subjects[]/name", Kind: "kind", Namespace: "namespace"},
+	})
+}
+
+func unmarshalObject(t *testing.T, in string) *resource.Object {
+	t.Helper()
+	var m map[string]any
+	qt.Assert(t, yaml.Unmarshal([]byte(in), &m), qt.IsNil)
+	return resource.Unstructured(m)
+}
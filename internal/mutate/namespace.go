@@ -0,0 +1,158 @@
+package mutate
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/johnhoman/dinghy/internal/decode"
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
+)
+
+var (
+	_ Mutator           = &Namespace{}
+	_ SideEffectVisitor = &Namespace{}
+	_ types.EnvAware    = &Namespace{}
+	_ yaml.Unmarshaler  = &Namespace{}
+)
+
+// Namespace sets the namespace of namespaced resources, and of the
+// references to them, such as the ServiceAccount subjects of a
+// RoleBinding or the service of a webhook. Cluster scoped kinds, listed
+// in resource/scope.yaml or defined by a CustomResourceDefinition in the
+// tree, aren't changed.
+type Namespace struct {
+	Namespace string `yaml:"name" json:"name"`
+	// From only moves resources, and references, in this namespace.
+	// References to it are changed even if the resource they reference
+	// isn't in the tree.
+	From string `yaml:"from" json:"from"`
+
+	tree resource.Tree
+	// clusterScoped are the cluster scoped kinds, including custom
+	// resources. They're read from the tree on first use.
+	clusterScoped sets.Set[string]
+}
+
+func (n *Namespace) UnmarshalYAML(value *yaml.Node) error {
+	var in struct {
+		Name string `yaml:"name"`
+		From string `yaml:"from"`
+	}
+	if err := decode.Node(value, &in, ""); err != nil {
+		return err
+	}
+	n.Namespace, n.From = in.Name, in.From
+	return nil
+}
+
+func (n *Namespace) Name() string {
+	return "builtin.dinghy.dev/metadata/namespace"
+}
+
+// SetEnv sets the tree that CustomResourceDefinitions are read from
+func (n *Namespace) SetEnv(env types.Env) {
+	n.tree = env.Tree
+}
+
+func (n *Namespace) Visit(obj *resource.Object) error {
+	if obj == nil {
+		return errors.Errorf("resource cannot be nil")
+	}
+	if n.From != "" {
+		if err := moveRefs(obj, func(ns string) bool { return ns == n.From }, n.Namespace); err != nil {
+			return err
+		}
+	}
+	isClusterScoped, err := n.isClusterScoped(obj)
+	if err != nil {
+		return err
+	}
+	if isClusterScoped || (n.From != "" && obj.GetNamespace() != n.From) {
+		return nil
+	}
+	obj.SetNamespace(n.Namespace)
+	return nil
+}
+
+// SideEffect changes the namespace of references to the moved resource
+// that name a namespace, such as the ServiceAccount subjects of a
+// ClusterRoleBinding. References without a namespace are in the namespace
+// of the resource that holds them, so they're moved with it.
+func (n *Namespace) SideEffect(old *resource.Object, tree resource.Tree) error {
+	if old.GetNamespace() == n.Namespace || (n.From != "" && old.GetNamespace() != n.From) {
+		return nil
+	}
+	isClusterScoped, err := n.isClusterScoped(old)
+	if err != nil || isClusterScoped {
+		return err
+	}
+	key := old.GroupVersionKind().GroupKind().String()
+	return tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		gk := obj.GroupVersionKind().GroupKind().String()
+		for _, ref := range nameRefs[key][gk] {
+			if ref.Namespace == "" {
+				continue
+			}
+			err := visitPath(obj.Object, ref.Path, false, func(m map[string]any, field string) error {
+				if name, _ := m[field].(string); name != old.GetName() {
+					return nil
+				}
+				if ref.Kind != "" {
+					if kind, _ := m[ref.Kind].(string); kind != old.GetKind() {
+						return nil
+					}
+				}
+				// a resource without a namespace is in the default namespace,
+				// so references to it might name the default namespace
+				ns, _ := m[ref.Namespace].(string)
+				if ns == old.GetNamespace() || (ns == "default" && old.GetNamespace() == "") {
+					m[ref.Namespace] = n.Namespace
+				}
+				return nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), ref.Path)
+			}
+		}
+		return nil
+	}))
+}
+
+func (n *Namespace) isClusterScoped(obj *resource.Object) (bool, error) {
+	if n.clusterScoped == nil {
+		kinds, err := resource.ClusterScopedKinds(n.tree)
+		if err != nil {
+			return false, err
+		}
+		n.clusterScoped = kinds
+	}
+	return n.clusterScoped.Has(obj.GroupVersionKind().GroupKind().String()), nil
+}
+
+// moveRefs sets the namespace of every reference held by obj that names a
+// namespace matched by match
+func moveRefs(obj *resource.Object, match func(ns string) bool, namespace string) error {
+	gk := obj.GroupVersionKind().GroupKind().String()
+	for _, refs := range nameRefs {
+		for _, ref := range refs[gk] {
+			if ref.Namespace == "" {
+				continue
+			}
+			err := visitPath(obj.Object, ref.Path, false, func(m map[string]any, field string) error {
+				if _, ok := m[field]; !ok {
+					return nil
+				}
+				if ns, ok := m[ref.Namespace].(string); ok && match(ns) {
+					m[ref.Namespace] = namespace
+				}
+				return nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "%s: %s", resource.ParseKey(obj), ref.Path)
+			}
+		}
+	}
+	return nil
+}
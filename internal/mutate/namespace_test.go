@@ -0,0 +1,161 @@
+package mutate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
+)
+
+func TestNamespace_Visit(t *testing.T) {
+	tests := map[string]struct {
+		from    string
+		objects []string
+		// want is the namespace of each resource after the mutation, keyed
+		// by kind and name
+		want map[string]string
+		// wantRefs is the namespace of the reference fields, keyed by kind
+		// and name
+		wantRefs map[string][]string
+	}{
+		"ClusterScoped": {
+			objects: []string{
+				`{apiVersion: v1, kind: Namespace, metadata: {name: app}}`,
+				`{apiVersion: rbac.authorization.k8s.io/v1, kind: ClusterRole, metadata: {name: app}}`,
+				`{apiVersion: apiextensions.k8s.io/v1, kind: CustomResourceDefinition, metadata: {name: widgets.example.com}, spec: {group: example.com, scope: Cluster, names: {kind: Widget}}}`,
+				`{apiVersion: apiextensions.k8s.io/v1, kind: CustomResourceDefinition, metadata: {name: gadgets.example.com}, spec: {group: example.com, scope: Namespaced, names: {kind: Gadget}}}`,
+				`{apiVersion: example.com/v1, kind: Widget, metadata: {name: web}}`,
+				`{apiVersion: example.com/v1, kind: Gadget, metadata: {name: web}}`,
+				`{apiVersion: apps/v1, kind: Deployment, metadata: {name: web, namespace: app}}`,
+			},
+			want: map[string]string{
+				"Namespace/app":   "",
+				"ClusterRole/app": "",
+				"CustomResourceDefinition/widgets.example.com": "",
+				"CustomResourceDefinition/gadgets.example.com": "",
+				"Widget/web":     "",
+				"Gadget/web":     "prod",
+				"Deployment/web": "prod",
+			},
+		},
+		"References": {
+			objects: []string{
+				`{apiVersion: v1, kind: ServiceAccount, metadata: {name: app, namespace: app}}`,
+				`{apiVersion: v1, kind: Service, metadata: {name: webhook}}`,
+				`
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata: {name: app}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: ClusterRole, name: app}
+subjects:
+- {kind: ServiceAccount, name: app, namespace: app}
+- {kind: ServiceAccount, name: app, namespace: other}
+- {kind: ServiceAccount, name: default, namespace: app}
+`,
+				`
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata: {name: webhook}
+webhooks:
+- name: validate.example.com
+  clientConfig:
+    service: {name: webhook, namespace: ""}
+`,
+			},
+			want: map[string]string{
+				"ServiceAccount/app":                     "prod",
+				"Service/webhook":                        "prod",
+				"ClusterRoleBinding/app":                 "",
+				"ValidatingWebhookConfiguration/webhook": "",
+			},
+			wantRefs: map[string][]string{
+				"ClusterRoleBinding/app":                 {"prod", "other", "app"},
+				"ValidatingWebhookConfiguration/webhook": {"prod"},
+			},
+		},
+		"DefaultNamespace": {
+			objects: []string{
+				`{apiVersion: v1, kind: ServiceAccount, metadata: {name: app}}`,
+				`
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata: {name: app}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: ClusterRole, name: app}
+subjects:
+- {kind: ServiceAccount, name: app, namespace: default}
+- {kind: ServiceAccount, name: app, namespace: other}
+`,
+			},
+			want: map[string]string{
+				"ServiceAccount/app":     "prod",
+				"ClusterRoleBinding/app": "",
+			},
+			wantRefs: map[string][]string{
+				"ClusterRoleBinding/app": {"prod", "other"},
+			},
+		},
+		"From": {
+			from: "app",
+			objects: []string{
+				`{apiVersion: v1, kind: ServiceAccount, metadata: {name: app, namespace: app}}`,
+				`{apiVersion: v1, kind: ServiceAccount, metadata: {name: worker, namespace: other}}`,
+				`{apiVersion: v1, kind: ConfigMap, metadata: {name: config}}`,
+				`
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata: {name: app}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: ClusterRole, name: app}
+subjects:
+- {kind: ServiceAccount, name: app, namespace: other}
+- {kind: ServiceAccount, name: default, namespace: app}
+`,
+			},
+			want: map[string]string{
+				"ServiceAccount/app":     "prod",
+				"ServiceAccount/worker":  "other",
+				"ConfigMap/config":       "",
+				"ClusterRoleBinding/app": "",
+			},
+			wantRefs: map[string][]string{
+				"ClusterRoleBinding/app": {"other", "prod"},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tree := resource.NewTree()
+			for _, obj := range tt.objects {
+				qt.Assert(t, tree.Insert(unmarshalObject(t, obj)), qt.IsNil)
+			}
+			ns := &Namespace{Namespace: "prod", From: tt.from}
+			ns.SetEnv(types.Env{Tree: tree})
+			qt.Assert(t, tree.Visit(SideEffect(ns, tree)), qt.IsNil)
+
+			got := make(map[string]string)
+			gotRefs := make(map[string][]string)
+			err := tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+				key := obj.GetKind() + "/" + obj.GetName()
+				got[key] = obj.GetNamespace()
+				for _, path := range []string{"subjects[]/namespace", "webhooks[]/clientConfig/service/namespace"} {
+					err := visitPath(obj.Object, path, false, func(m map[string]any, field string) error {
+						gotRefs[key] = append(gotRefs[key], m[field].(string))
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+			qt.Assert(t, err, qt.IsNil)
+			for key, want := range tt.want {
+				qt.Assert(t, got[key], qt.Equals, want, qt.Commentf(key))
+			}
+			for key, want := range tt.wantRefs {
+				qt.Assert(t, gotRefs[key], qt.DeepEquals, want, qt.Commentf(key))
+			}
+		})
+	}
+}
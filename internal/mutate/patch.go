@@ -1,6 +1,8 @@
 package mutate
 
 import (
+	"github.com/invopop/jsonschema"
+	"github.com/johnhoman/dinghy/internal/decode"
 	"github.com/johnhoman/dinghy/internal/fieldpath"
 	"github.com/johnhoman/dinghy/internal/resource"
 	"gopkg.in/yaml.v3"
@@ -11,6 +13,11 @@ var (
 	_ yaml.Unmarshaler = &Patch{}
 )
 
+type patchConfig struct {
+	FieldPaths []string `yaml:"fieldPaths"`
+	Value      any      `yaml:"value"`
+}
+
 type Patch struct {
 	FieldPaths []*fieldpath.FieldPath
 	Value      any
@@ -21,11 +28,8 @@ func (p *Patch) Name() string {
 }
 
 func (p *Patch) UnmarshalYAML(value *yaml.Node) error {
-	var in struct {
-		FieldPaths []string `yaml:"fieldPaths"`
-		Value      any      `yaml:"value"`
-	}
-	if err := value.Decode(&in); err != nil {
+	var in patchConfig
+	if err := decode.Node(value, &in, ""); err != nil {
 		return err
 	}
 	p.Value = in.Value
@@ -40,6 +44,10 @@ func (p *Patch) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+func (p *Patch) JSONSchema() *jsonschema.Schema {
+	return decode.Schema(&patchConfig{})
+}
+
 func (p *Patch) Visit(obj *resource.Object) error {
 	for _, fp := range p.FieldPaths {
 		if err := obj.FieldPatch(fp, p.Value); err != nil {
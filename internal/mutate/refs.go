@@ -0,0 +1,70 @@
+package mutate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// visitPath calls fn with every object that holds the last field of path,
+// and the name of that field. It's how the field references of labels.yaml,
+// name.yaml and images.yaml are found.
+//
+// Fields are separated by slashes, and list fields are written with a []
+// suffix, e.g. spec/containers[]/image, in which case every item of the
+// list is visited. Missing fields are skipped, unless create is true, in
+// which case the missing objects along the path are created. Fields are
+// never created through a list, so only the items that exist are visited.
+// An error is returned if a field along the path has the wrong type.
+func visitPath(m map[string]any, path string, create bool, fn func(m map[string]any, field string) error) error {
+	return visitFields(m, strings.Split(path, "/"), create, fn)
+}
+
+func visitFields(m map[string]any, path []string, create bool, fn func(m map[string]any, field string) error) error {
+	field, isList := strings.CutSuffix(path[0], "[]")
+	if len(path) == 1 {
+		if isList {
+			return errors.Errorf("%s is a list, but the last field of a path must not be", field)
+		}
+		return fn(m, field)
+	}
+	value, ok := m[field]
+	if !ok || value == nil {
+		if !create || isList || throughList(path[1:]) {
+			return nil
+		}
+		value = make(map[string]any)
+		m[field] = value
+	}
+	if !isList {
+		next, ok := value.(map[string]any)
+		if !ok {
+			return errors.Errorf("expected %s to be an object, got %T", field, value)
+		}
+		return visitFields(next, path[1:], create, fn)
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return errors.Errorf("expected %s to be a list, got %T", field, value)
+	}
+	for _, item := range list {
+		next, ok := item.(map[string]any)
+		if !ok {
+			return errors.Errorf("expected the items of %s to be objects, got %T", field, item)
+		}
+		if err := visitFields(next, path[1:], create, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// throughList reports whether any of the fields of path are lists
+func throughList(path []string) bool {
+	for _, field := range path {
+		if strings.HasSuffix(field, "[]") {
+			return true
+		}
+	}
+	return false
+}
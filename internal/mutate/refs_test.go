@@ -0,0 +1,81 @@
+package mutate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestVisitPath(t *testing.T) {
+	set := func(m map[string]any, field string) error {
+		m[field] = "set"
+		return nil
+	}
+	tests := map[string]struct {
+		in     map[string]any
+		path   string
+		create bool
+		want   map[string]any
+		err    string
+	}{
+		"List": {
+			in: map[string]any{"containers": []any{
+				map[string]any{"image": "a"},
+				map[string]any{"image": "b"},
+			}},
+			path: "containers[]/image",
+			want: map[string]any{"containers": []any{
+				map[string]any{"image": "set"},
+				map[string]any{"image": "set"},
+			}},
+		},
+		"Missing": {
+			in:   map[string]any{},
+			path: "spec/template/metadata",
+			want: map[string]any{},
+		},
+		"Create": {
+			in:     map[string]any{},
+			path:   "spec/template/metadata",
+			create: true,
+			want:   map[string]any{"spec": map[string]any{"template": map[string]any{"metadata": "set"}}},
+		},
+		"CreateThroughList": {
+			// lists aren't created, but the fields of the items that
+			// exist are
+			in:     map[string]any{"spec": map[string]any{"templates": []any{map[string]any{}}}},
+			path:   "spec/templates[]/metadata/labels",
+			create: true,
+			want: map[string]any{"spec": map[string]any{"templates": []any{
+				map[string]any{"metadata": map[string]any{"labels": "set"}},
+			}}},
+		},
+		"CreateMissingList": {
+			in:     map[string]any{"spec": map[string]any{}},
+			path:   "spec/templates[]/metadata/labels",
+			create: true,
+			want:   map[string]any{"spec": map[string]any{}},
+		},
+		"NotAList": {
+			in:   map[string]any{"containers": map[string]any{}},
+			path: "containers[]/image",
+			err:  "expected containers to be a list, got map.*",
+		},
+		"NotAnObject": {
+			in:   map[string]any{"containers": []any{}},
+			path: "containers/image",
+			err:  `expected containers to be an object, got \[\]interface {}`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := visitPath(tt.in, tt.path, tt.create, set)
+			if tt.err != "" {
+				qt.Assert(t, err, qt.ErrorMatches, tt.err)
+				return
+			}
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, tt.in, qt.DeepEquals, tt.want)
+		})
+	}
+}
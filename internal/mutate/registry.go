@@ -1,9 +1,10 @@
 package mutate
 
 import (
-	"github.com/johnhoman/dinghy/internal/resource"
 	"github.com/pkg/errors"
-	"reflect"
+
+	"github.com/johnhoman/dinghy/internal/registry"
+	"github.com/johnhoman/dinghy/internal/resource"
 )
 
 var (
@@ -15,48 +16,43 @@ type Mutator interface {
 	Name() string
 }
 
-func Get(name string) (any, error) {
-	f, ok := r.store[name]
-	if !ok {
-		return nil, ErrNotFound
-	}
-	return f(), nil
-}
+// Registry maps names to mutators. Registries are values, so that
+// builds in the same process can use different sets of mutators.
+type Registry = registry.Registry[Mutator]
 
-func Has(name string) bool {
-	_, ok := r.store[name]
-	return ok
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return registry.New[Mutator](ErrNotFound)
 }
 
-// MustRegister registers a new Mutator under the provided name. newConfig should
-// be a function that returns the required data structure for the Mutator. It
-// will be up to the Mutator to convert the config to the correct type. The registry
-// will handle deserializing YAML into the returned config when the Mutator plugin
-// is invoked
-func MustRegister(vis Mutator) {
-	r.store[vis.Name()] = func() any {
-		t := reflect.TypeOf(vis).Elem()
-		return reflect.New(t).Interface()
-	}
+// Default returns a copy of the registry of builtin mutators, which
+// can be extended without changing the builtins
+func Default() *Registry {
+	return builtins.Clone()
 }
 
-type registry struct {
-	store map[string]func() any
-}
+// builtins are the mutators that are always available
+var builtins = NewRegistry()
 
-var r = &registry{store: make(map[string]func() any)}
+// RegisterBuiltin adds a Mutator to the builtins, so that every registry
+// returned by Default after it's called has the Mutator
+func RegisterBuiltin(m Mutator) {
+	builtins.Register(m)
+}
 
 func init() {
-	MustRegister(&StrategicMergePatch{})
-	MustRegister(&MergePatch{})
-	MustRegister(&JSONPatch{})
-	MustRegister(&ConfigMapJSONPatch{})
-	MustRegister(&Patch{})
-	MustRegister(&Metadata{})
-	MustRegister(&Name{})
-	MustRegister(&Namespace{})
-	MustRegister(&Annotations{})
-	MustRegister(&Labels{})
-	MustRegister(&MatchLabels{})
-	MustRegister(&Script{})
+	builtins.Register(&StrategicMergePatch{})
+	builtins.Register(&ImageResolver{})
+	builtins.Register(&Images{})
+	builtins.Register(&MergePatch{})
+	builtins.Register(&JSONPatch{})
+	builtins.Register(&ConfigMapJSONPatch{})
+	builtins.Register(&Patch{})
+	builtins.Register(&Metadata{})
+	builtins.Register(&Name{})
+	builtins.Register(&Namespace{})
+	builtins.Register(&Annotations{})
+	builtins.Register(&Labels{})
+	builtins.Register(&MatchLabels{})
+	builtins.Register(&Script{})
 }
@@ -1,53 +1,48 @@
 package mutate
 
 import (
-	"github.com/dop251/goja"
-	"github.com/johnhoman/dinghy/internal/resource"
-	"github.com/pkg/errors"
+	"github.com/invopop/jsonschema"
 	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/script"
 )
 
 var (
 	_ Mutator          = &Script{}
 	_ yaml.Unmarshaler = &Script{}
+	_ script.HostAware = &Script{}
+	_ script.Loader    = &Script{}
 )
 
+// Script runs a javascript snippet on each visited resource. The script
+// MUST define a function `mutate` with the signature mutate(obj, config),
+// which is called with the resource being visited, as well as the config
+// provided to the mutator, and changes the resource in place.
 type Script struct {
-	vm     *goja.Runtime
-	mutate resource.Visitor
+	script.Plugin
 }
 
-func (s *Script) Name() string {
-	return "builtin.dinghy.dev/script/js"
+// NewScript returns a Script that runs the provided source, such as
+// a script loaded from a module. The Script is registered under name,
+// and the `with` config is passed to the mutate function as is.
+func NewScript(name, source string, opts ...script.Option) *Script {
+	return &Script{Plugin: script.NewPlugin(name, source, opts...)}
 }
 
 func (s *Script) UnmarshalYAML(value *yaml.Node) error {
-	var in struct {
-		Script string         `yaml:"script"`
-		Config map[string]any `yaml:"config"`
-	}
-	if err := value.Decode(&in); err != nil {
-		return err
-	}
-
-	vm := goja.New()
-	if _, err := vm.RunString(in.Script); err != nil {
-		return err
-	}
-
-	mutate, ok := goja.AssertFunction(vm.Get("mutate"))
-	if !ok {
-		return errors.New("mutate function not found")
-	}
-	s.mutate = resource.VisitorFunc(func(obj *resource.Object) error {
-		_, err := mutate(goja.Undefined(), vm.ToValue(obj.Object), vm.ToValue(in.Config))
-		return err
-	})
-	return nil
+	return s.Decode(value, "mutate")
+}
+
+func (s *Script) JSONSchema() *jsonschema.Schema {
+	return s.Schema("mutate")
+}
+
+func (s *Script) Load() error {
+	return s.Compile("mutate")
 }
 
-// Visit runs a javascript snippet, passing is the current resource
-// for mutation. The script MUST define a single function `mutate`
-// with the signature mutate(obj, config), which wil be called with the
-// resource being visited as well as the config provided to the mutator
-func (s *Script) Visit(obj *resource.Object) error { return s.mutate.Visit(obj) }
+func (s *Script) Visit(obj *resource.Object) error {
+	_, err := s.Call("mutate", obj.Object)
+	return err
+}
@@ -28,7 +28,7 @@ func (se *sideEffectVisitor) Visit(obj *resource.Object) error {
 		return err
 	}
 	if err := se.visitor.Visit(obj); err != nil {
-		return nil
+		return err
 	}
 	objBefore := resource.Unstructured(m)
 	return se.visitor.SideEffect(objBefore, se.tree)
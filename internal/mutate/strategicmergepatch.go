@@ -2,14 +2,21 @@ package mutate
 
 import (
 	"github.com/imdario/mergo"
-	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/openapi"
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
 )
 
 var (
 	_ yaml.Unmarshaler = &StrategicMergePatch{}
 	_ Mutator          = &StrategicMergePatch{}
 	_ resource.Visitor = &StrategicMergePatch{}
+	_ types.EnvAware   = &StrategicMergePatch{}
 	_ yaml.Unmarshaler = &MergePatch{}
 	_ Mutator          = &MergePatch{}
 	_ resource.Visitor = &MergePatch{}
@@ -28,12 +35,49 @@ func (m *MergePatch) UnmarshalYAML(value *yaml.Node) error {
 	return value.Decode(&m.patch)
 }
 
+func (m *MergePatch) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "object", Description: "a merge patch for the resource"}
+}
+
 func (m *MergePatch) Visit(obj *resource.Object) error {
 	return mergo.Merge(obj.Object, m.patch, mergo.WithOverride)
 }
 
 type StrategicMergePatch struct {
-	patch map[string]any
+	patch   map[string]any
+	env     types.Env
+	schemas *openapi.Schemas
+}
+
+func (s *StrategicMergePatch) SetEnv(env types.Env) {
+	s.env = env
+}
+
+// load loads the schemas used to patch kinds that aren't registered with
+// the scheme, such as custom resources. They're the schemas of the
+// Kubernetes version, every CustomResourceDefinition in the tree and the
+// schema files of the config.
+func (s *StrategicMergePatch) load() error {
+	schemas, err := openapi.Load(s.env.KubeVersion)
+	if err != nil {
+		return err
+	}
+	if s.env.Tree != nil {
+		if err := schemas.AddCRDs(s.env.Tree); err != nil {
+			return err
+		}
+	}
+	for _, file := range s.env.Schemas {
+		data, err := path.ReadSource(file, s.env.Path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read schemas from %s", file)
+		}
+		if err := schemas.AddFile(data); err != nil {
+			return errors.Wrapf(err, "failed to read schemas from %s", file)
+		}
+	}
+	s.schemas = schemas
+	return nil
 }
 
 func (s *StrategicMergePatch) Name() string {
@@ -49,6 +93,15 @@ func (s *StrategicMergePatch) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+func (s *StrategicMergePatch) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "object", Description: "a strategic merge patch for the resource"}
+}
+
 func (s *StrategicMergePatch) Visit(obj *resource.Object) error {
-	return obj.StrategicMergePatch(s.patch)
+	if s.schemas == nil {
+		if err := s.load(); err != nil {
+			return errors.Wrapf(err, "failed to load schemas for %s", s.Name())
+		}
+	}
+	return obj.StrategicMergePatch(s.patch, s.schemas)
 }
@@ -0,0 +1,281 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when the registry doesn't have the image
+var ErrNotFound = errors.New("image not found")
+
+// manifestTypes are the manifest media types the client accepts. Indexes
+// are preferred, so that multi-platform images resolve to the digest of
+// the index instead of a single platform.
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Client talks to registries with the OCI distribution API
+type Client struct {
+	// HTTP is the client used for every request. It defaults to
+	// http.DefaultClient.
+	HTTP *http.Client
+	// Keychain has the credentials of each registry. Requests are
+	// anonymous if it's nil.
+	Keychain Keychain
+	// Insecure are the registries that are accessed with plain HTTP
+	Insecure []string
+
+	mu sync.Mutex
+	// tokens caches the authorization header of each repository
+	tokens map[string]string
+}
+
+// Digest returns the digest of the manifest the reference points to. If
+// the reference already has a digest, it's returned without a request.
+func (c *Client) Digest(ctx context.Context, ref Reference) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", c.scheme(ref.Registry), ref.apiHost(), ref.Repository, ref.Tag)
+
+	// HEAD requests don't count towards the Docker Hub rate limit, but
+	// not every registry returns the digest header, so GET is the fallback
+	resp, err := c.do(ctx, http.MethodHead, u, ref)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	resp, err = c.do(ctx, http.MethodGet, u, ref)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", errors.Wrapf(err, "failed to read manifest of %s", ref)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *Client) scheme(registry string) string {
+	for _, r := range c.Insecure {
+		if r == registry {
+			return "http"
+		}
+	}
+	return "https"
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+// do sends a manifest request, authenticating if the registry responds
+// with a challenge
+func (c *Client) do(ctx context.Context, method, u string, ref Reference) (*http.Response, error) {
+	key := ref.Registry + "/" + ref.Repository
+	c.mu.Lock()
+	auth := c.tokens[key]
+	c.mu.Unlock()
+
+	resp, err := c.send(ctx, method, u, auth)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		auth, err = c.authorize(ctx, ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.tokens == nil {
+			c.tokens = make(map[string]string)
+		}
+		c.tokens[key] = auth
+		c.mu.Unlock()
+		if resp, err = c.send(ctx, method, u, auth); err != nil {
+			return nil, err
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errors.Wrapf(ErrNotFound, "%s", ref)
+	default:
+		resp.Body.Close()
+		return nil, errors.Errorf("failed to resolve %s: %s %s: %s", ref, method, u, resp.Status)
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, u, auth string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return c.httpClient().Do(req)
+}
+
+// authorize answers an authentication challenge, returning the value of
+// the Authorization header
+func (c *Client) authorize(ctx context.Context, ref Reference, challenge string) (string, error) {
+	keychain := c.Keychain
+	if keychain == nil {
+		keychain = Anonymous
+	}
+	cred, err := keychain.Credential(ref.Registry)
+	if err != nil {
+		return "", err
+	}
+
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if cred.Username == "" {
+			return "", errors.Errorf("failed to resolve %s: registry requires credentials", ref)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(cred.Username, cred.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		token, err := c.token(ctx, ref, params, cred)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", errors.Errorf("failed to resolve %s: unsupported authentication challenge %q", ref, challenge)
+}
+
+// token gets a bearer token from the token server in the challenge
+func (c *Client) token(ctx context.Context, ref Reference, params map[string]string, cred Credential) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.Errorf("failed to resolve %s: bearer challenge without a realm", ref)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.Repository + ":pull"
+	}
+
+	var req *http.Request
+	var err error
+	if cred.IdentityToken != "" {
+		// identity tokens are exchanged with the OAuth2 refresh token flow
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {cred.IdentityToken},
+			"service":       {params["service"]},
+			"scope":         {scope},
+			"client_id":     {"dinghy"},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		u, err := url.Parse(realm)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid token realm %q", realm)
+		}
+		q := u.Query()
+		if service := params["service"]; service != "" {
+			q.Set("service", service)
+		}
+		q.Set("scope", scope)
+		u.RawQuery = q.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if cred.Username != "" {
+			req.SetBasicAuth(cred.Username, cred.Password)
+		}
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("failed to authenticate with %s: %s", ref.Registry, resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", errors.Wrapf(err, "failed to authenticate with %s", ref.Registry)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", errors.Errorf("failed to authenticate with %s: no token in response", ref.Registry)
+}
+
+// parseChallenge parses a WWW-Authenticate header, e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key] = value[1 : end+1]
+			rest = strings.TrimPrefix(strings.TrimSpace(value[end+2:]), ",")
+		} else {
+			v, next, _ := strings.Cut(value, ",")
+			params[key] = strings.TrimSpace(v)
+			rest = next
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	return scheme, params
+}
@@ -0,0 +1,185 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// registry is an in-process registry that requires bearer tokens from
+// its own token server
+type registry struct {
+	*httptest.Server
+	// manifests are keyed by repository:tag
+	manifests map[string]string
+	// username and password are required by the token server if set
+	username, password string
+	// noDigestHeader drops the Docker-Content-Digest header, like some
+	// registries do
+	noDigestHeader bool
+	tokenRequests  int
+}
+
+func newRegistry(t *testing.T) *registry {
+	r := &registry{manifests: make(map[string]string)}
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *registry) host() string {
+	return strings.TrimPrefix(r.URL, "https://")
+}
+
+func (r *registry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.tokenRequests++
+		if r.username != "" {
+			user, pass, ok := req.BasicAuth()
+			if !ok || user != r.username || pass != r.password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		fmt.Fprintf(w, `{"token": "token-for-%s"}`, req.URL.Query().Get("scope"))
+		return
+	}
+
+	rest, ok := strings.CutPrefix(req.URL.Path, "/v2/")
+	repo, tag, found := strings.Cut(rest, "/manifests/")
+	if !ok || !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	scope := "repository:" + repo + ":pull"
+	if req.Header.Get("Authorization") != "Bearer token-for-"+scope {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="%s"`, r.URL, scope))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	manifest, ok := r.manifests[repo+":"+tag]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !r.noDigestHeader {
+		w.Header().Set("Docker-Content-Digest", digestOf(manifest))
+	}
+	if req.Method == http.MethodGet {
+		_, _ = w.Write([]byte(manifest))
+	}
+}
+
+func digestOf(manifest string) string {
+	sum := sha256.Sum256([]byte(manifest))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestClient_Digest(t *testing.T) {
+	r := newRegistry(t)
+	r.manifests["team/app:1.0"] = `{"schemaVersion": 2}`
+	want := digestOf(`{"schemaVersion": 2}`)
+
+	c := &Client{HTTP: r.Client()}
+	ref, err := ParseReference(r.host() + "/team/app:1.0")
+	qt.Assert(t, err, qt.IsNil)
+
+	got, err := c.Digest(context.Background(), ref)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.Equals, want)
+
+	// the token is reused for the same repository
+	_, err = c.Digest(context.Background(), ref)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, r.tokenRequests, qt.Equals, 1)
+
+	// the digest is computed from the manifest if the registry doesn't
+	// return it
+	r.noDigestHeader = true
+	got, err = c.Digest(context.Background(), ref)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.Equals, want)
+
+	ref.Tag = "2.0"
+	_, err = c.Digest(context.Background(), ref)
+	qt.Assert(t, err, qt.ErrorIs, ErrNotFound)
+}
+
+func TestClient_Digest_DockerConfig(t *testing.T) {
+	r := newRegistry(t)
+	r.username, r.password = "user", "secret"
+	r.manifests["team/app:1.0"] = `{"schemaVersion": 2}`
+	ref, err := ParseReference(r.host() + "/team/app:1.0")
+	qt.Assert(t, err, qt.IsNil)
+
+	// anonymous requests can't get a token
+	c := &Client{HTTP: r.Client()}
+	_, err = c.Digest(context.Background(), ref)
+	qt.Assert(t, err, qt.ErrorMatches, `failed to authenticate with .*: 401 Unauthorized`)
+
+	name := filepath.Join(t.TempDir(), "config.json")
+	auth := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	qt.Assert(t, os.WriteFile(name, []byte(fmt.Sprintf(`{"auths": {"https://%s/v1/": {"auth": %q}}}`, r.host(), auth)), 0o600), qt.IsNil)
+	config, err := LoadDockerConfig(name)
+	qt.Assert(t, err, qt.IsNil)
+
+	c = &Client{HTTP: r.Client(), Keychain: config}
+	got, err := c.Digest(context.Background(), ref)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.Equals, digestOf(`{"schemaVersion": 2}`))
+}
+
+func TestDockerConfig_Credential(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	qt.Assert(t, os.WriteFile(name, []byte(`{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "aHViOnB3"},
+    "ghcr.io": {"username": "octo", "password": "pat"},
+    "registry.example.com": {"identitytoken": "refresh"}
+  }
+}`), 0o600), qt.IsNil)
+	config, err := LoadDockerConfig(name)
+	qt.Assert(t, err, qt.IsNil)
+
+	tests := map[string]Credential{
+		"docker.io":            {Username: "hub", Password: "pw"},
+		"ghcr.io":              {Username: "octo", Password: "pat"},
+		"registry.example.com": {IdentityToken: "refresh"},
+		"quay.io":              {},
+	}
+	for registry, want := range tests {
+		t.Run(registry, func(t *testing.T) {
+			got, err := config.Credential(registry)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, want)
+		})
+	}
+
+	config, err = LoadDockerConfig(filepath.Join(t.TempDir(), "missing.json"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, config.Auths, qt.HasLen, 0)
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`)
+	qt.Assert(t, scheme, qt.Equals, "Bearer")
+	qt.Assert(t, params, qt.DeepEquals, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/nginx:pull,push",
+	})
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	qt.Assert(t, scheme, qt.Equals, "Basic")
+	qt.Assert(t, params, qt.DeepEquals, map[string]string{"realm": "registry"})
+}
@@ -0,0 +1,160 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// dockerHubServer is the key docker uses for Docker Hub credentials
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// Credential authenticates with a registry. An empty Credential is
+// anonymous.
+type Credential struct {
+	Username string
+	Password string
+	// IdentityToken is a refresh token, which is exchanged for an access
+	// token instead of the username and password
+	IdentityToken string
+}
+
+// Keychain returns the credential for a registry
+type Keychain interface {
+	Credential(registry string) (Credential, error)
+}
+
+// Anonymous is a Keychain without any credentials
+var Anonymous Keychain = anonymous{}
+
+type anonymous struct{}
+
+func (anonymous) Credential(string) (Credential, error) { return Credential{}, nil }
+
+// DockerConfig is the docker CLI config file, which has the credentials
+// from docker login
+type DockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	// CredsStore is the credential helper used for every registry
+	CredsStore string `json:"credsStore"`
+	// CredHelpers are the credential helpers of specific registries
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+var _ Keychain = &DockerConfig{}
+
+// DefaultDockerConfig returns the path of the docker config file, which
+// is in $DOCKER_CONFIG or ~/.docker
+func DefaultDockerConfig() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// LoadDockerConfig reads a docker config file. A config without any
+// credentials is returned if the file doesn't exist.
+func LoadDockerConfig(name string) (*DockerConfig, error) {
+	c := &DockerConfig{}
+	if name == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrapf(err, "invalid docker config %s", name)
+	}
+	return c, nil
+}
+
+// Credential returns the credential for a registry from the credential
+// helper of the registry, or from the auths in the config
+func (d *DockerConfig) Credential(registry string) (Credential, error) {
+	server := registry
+	if registry == DockerHub {
+		server = dockerHubServer
+	}
+	helper := d.CredsStore
+	if h, ok := d.CredHelpers[registry]; ok {
+		helper = h
+	}
+	if helper != "" {
+		return credentialHelper(helper, server)
+	}
+
+	for key, auth := range d.Auths {
+		if normalizeServer(key) != registry {
+			continue
+		}
+		c := Credential{Username: auth.Username, Password: auth.Password, IdentityToken: auth.IdentityToken}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credential{}, errors.Wrapf(err, "invalid auth for %s in docker config", key)
+			}
+			c.Username, c.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		return c, nil
+	}
+	return Credential{}, nil
+}
+
+// normalizeServer converts the server keys used in the docker config,
+// e.g. https://index.docker.io/v1/, into a registry host
+func normalizeServer(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	server, _, _ = strings.Cut(server, "/")
+	switch server {
+	case "index.docker.io", dockerHubAPI:
+		return DockerHub
+	}
+	return server
+}
+
+// credentialHelper runs docker-credential-<helper> to get the credential
+// of a server
+func credentialHelper(helper, server string) (Credential, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		// helpers report missing credentials on stdout
+		if strings.Contains(stdout.String(), "credentials not found") {
+			return Credential{}, nil
+		}
+		return Credential{}, errors.Wrapf(err, "credential helper %s: %s", helper, strings.TrimSpace(stderr.String()))
+	}
+	var out struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return Credential{}, errors.Wrapf(err, "credential helper %s returned invalid output", helper)
+	}
+	// helpers return identity tokens with this username
+	if out.Username == "<token>" {
+		return Credential{IdentityToken: out.Secret}, nil
+	}
+	return Credential{Username: out.Username, Password: out.Secret}, nil
+}
@@ -0,0 +1,94 @@
+// Package oci resolves image references with the OCI distribution API,
+// which is implemented by Docker Hub and every other container registry.
+package oci
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DockerHub is the registry of images that don't name a registry
+	DockerHub = "docker.io"
+	// dockerHubAPI is the host that serves the distribution API of Docker Hub
+	dockerHubAPI = "registry-1.docker.io"
+	// DefaultTag is the tag of images that don't have a tag or a digest
+	DefaultTag = "latest"
+)
+
+// Reference is a parsed image reference, such as nginx:1.25 or
+// ghcr.io/org/app@sha256:...
+type Reference struct {
+	// Registry is the host of the registry, e.g. docker.io or ghcr.io
+	Registry string
+	// Repository is the path of the image in the registry, e.g.
+	// library/nginx
+	Repository string
+	// Tag is empty if the reference only has a digest
+	Tag string
+	// Digest is empty if the reference doesn't have a digest
+	Digest string
+}
+
+// ParseReference parses an image reference using the same defaults as
+// docker: images without a registry are on Docker Hub, and single name
+// Docker Hub images are in the library namespace.
+func ParseReference(image string) (Reference, error) {
+	if image == "" || strings.ContainsAny(image, " \t\n") {
+		return Reference{}, errors.Errorf("invalid image reference %q", image)
+	}
+	ref := Reference{}
+	name := image
+	if before, digest, ok := strings.Cut(name, "@"); ok {
+		if !strings.Contains(digest, ":") {
+			return Reference{}, errors.Errorf("invalid image reference %q: invalid digest", image)
+		}
+		name, ref.Digest = before, digest
+	}
+	// the tag is after the last colon, unless the colon is part of the
+	// registry port, e.g. localhost:5000/app
+	if k := strings.LastIndex(name, ":"); k > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:k], name[k+1:]
+	}
+
+	domain, rest, ok := strings.Cut(name, "/")
+	if ok && (strings.ContainsAny(domain, ".:") || domain == "localhost") {
+		ref.Registry, ref.Repository = domain, rest
+	} else {
+		ref.Registry, ref.Repository = DockerHub, name
+	}
+	if ref.Registry == "index.docker.io" {
+		ref.Registry = DockerHub
+	}
+	if ref.Registry == DockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Repository == "" || ref.Repository != strings.ToLower(ref.Repository) {
+		return Reference{}, errors.Errorf("invalid image reference %q: repository must be lowercase", image)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+	return ref, nil
+}
+
+// String returns the fully qualified reference
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// apiHost returns the host that serves the distribution API of the registry
+func (r Reference) apiHost() string {
+	if r.Registry == DockerHub {
+		return dockerHubAPI
+	}
+	return r.Registry
+}
@@ -0,0 +1,63 @@
+package oci
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := map[string]struct {
+		image string
+		want  Reference
+		err   string
+	}{
+		"DockerHubLibrary": {
+			image: "nginx",
+			want:  Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"},
+		},
+		"DockerHubUser": {
+			image: "bitnami/redis:7.0",
+			want:  Reference{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.0"},
+		},
+		"IndexDockerIO": {
+			image: "index.docker.io/nginx:1.25",
+			want:  Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"},
+		},
+		"Registry": {
+			image: "ghcr.io/org/team/app:v1",
+			want:  Reference{Registry: "ghcr.io", Repository: "org/team/app", Tag: "v1"},
+		},
+		"RegistryPort": {
+			image: "localhost:5000/app",
+			want:  Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"},
+		},
+		"Digest": {
+			image: "nginx@sha256:abc",
+			want:  Reference{Registry: "docker.io", Repository: "library/nginx", Digest: "sha256:abc"},
+		},
+		"TagAndDigest": {
+			image: "quay.io/app:1.0@sha256:abc",
+			want:  Reference{Registry: "quay.io", Repository: "app", Tag: "1.0", Digest: "sha256:abc"},
+		},
+		"Uppercase": {
+			image: "Nginx:1.25",
+			err:   `invalid image reference "Nginx:1.25": repository must be lowercase`,
+		},
+		"InvalidDigest": {
+			image: "nginx@abc",
+			err:   `invalid image reference "nginx@abc": invalid digest`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseReference(tt.image)
+			if tt.err != "" {
+				qt.Assert(t, err, qt.ErrorMatches, tt.err)
+				return
+			}
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
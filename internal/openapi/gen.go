@@ -0,0 +1,433 @@
+//go:build ignore
+
+// gen writes the embedded schemas for each supported Kubernetes version.
+// Schemas come from one of three sources:
+//
+//	-fetch v1.28.0  the OpenAPI v3 spec published in the kubernetes repo,
+//	                which requires network access
+//	-kyaml          the OpenAPI v2 spec bundled with kustomize (v1.21)
+//	-types          the Go types of the vendored k8s.io/api module, with
+//	                the markers openapi-gen reads from their comments
+//
+// Only the fields used for validation are kept, and every document is
+// written as schemas/v<major>.<minor>.json.gz.
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	openapiv2 "github.com/google/gnostic/openapiv2"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/kustomize/kyaml/openapi/kubernetesapi"
+
+	"github.com/johnhoman/dinghy/internal/openapi"
+)
+
+func main() {
+	out := flag.String("out", "schemas", "directory to write the schemas to")
+	fetch := flag.String("fetch", "", "kubernetes release to fetch the OpenAPI v3 spec of, e.g. v1.28.0")
+	kyaml := flag.Bool("kyaml", false, "convert the OpenAPI v2 spec bundled with kustomize")
+	types := flag.String("types", "", "kubernetes minor version of the vendored k8s.io/api module, e.g. 1.27")
+	flag.Parse()
+
+	switch {
+	case *fetch != "":
+		defs, err := fromRelease(*fetch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(*out, *fetch, defs)
+	case *kyaml:
+		defs, err := fromKyaml()
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(*out, kubernetesapi.DefaultOpenAPI, defs)
+	case *types != "":
+		write(*out, *types, fromTypes())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func write(dir, version string, defs map[string]*openapi.Schema) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	name := filepath.Join(dir, fmt.Sprintf("v%s.%s.json.gz", parts[0], parts[1]))
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	w, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err := json.NewEncoder(w).Encode(map[string]any{"definitions": defs}); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d schemas to %s", len(defs), name)
+}
+
+// convert decodes the schemas of an OpenAPI document, dropping every
+// field that isn't used for validation
+func convert(data []byte) (map[string]*openapi.Schema, error) {
+	var doc struct {
+		Definitions map[string]*openapi.Schema `json:"definitions"`
+		Components  struct {
+			Schemas map[string]*openapi.Schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Definitions != nil {
+		return doc.Definitions, nil
+	}
+	return doc.Components.Schemas, nil
+}
+
+func fromRelease(release string) (map[string]*openapi.Schema, error) {
+	api := "https://api.github.com/repos/kubernetes/kubernetes/contents/api/openapi-spec/v3?ref=" + release
+	var files []struct {
+		Name        string `json:"name"`
+		DownloadURL string `json:"download_url"`
+	}
+	data, err := get(api)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+	rv := make(map[string]*openapi.Schema)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name, ".json") {
+			continue
+		}
+		data, err := get(file.DownloadURL)
+		if err != nil {
+			return nil, err
+		}
+		defs, err := convert(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		for name, def := range defs {
+			rv[name] = def
+		}
+	}
+	return rv, nil
+}
+
+func get(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func fromKyaml() (map[string]*openapi.Schema, error) {
+	version := kubernetesapi.DefaultOpenAPI
+	asset := filepath.Join("kubernetesapi", strings.ReplaceAll(version, ".", "_"), "swagger.pb")
+	doc := &openapiv2.Document{}
+	if err := proto.Unmarshal(kubernetesapi.OpenAPIMustAsset[version](asset), doc); err != nil {
+		return nil, err
+	}
+	var swagger spec.Swagger
+	if _, err := swagger.FromGnostic(doc); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(swagger)
+	if err != nil {
+		return nil, err
+	}
+	return convert(data)
+}
+
+// fromTypes builds the schemas from the Go types of every kind registered
+// with the client-go scheme. It follows the rules openapi-gen uses for
+// the published spec: fields are required unless they're marked +optional
+// or omitempty, types marked +enum list the values of their constants,
+// and the list, map and patch markers become extensions.
+func fromTypes() map[string]*openapi.Schema {
+	g := &generator{
+		defs:     make(map[string]*openapi.Schema),
+		packages: make(map[string]*markers),
+	}
+	for gvk, t := range scheme.Scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		s := g.define(t)
+		def := g.defs[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		def.GroupVersionKinds = append(def.GroupVersionKinds, openapi.GVK{
+			Group:   gvk.Group,
+			Version: gvk.Version,
+			Kind:    gvk.Kind,
+		})
+	}
+	return g.defs
+}
+
+type generator struct {
+	defs map[string]*openapi.Schema
+	// packages are the markers of each parsed package
+	packages map[string]*markers
+}
+
+// markers are the comment tags of a package that openapi-gen reads, e.g.
+// +optional or +listType=map
+type markers struct {
+	// fields are the tags of each struct field, keyed by Type.Field
+	fields map[string]map[string][]string
+	// enums are the values of each type marked +enum
+	enums map[string][]any
+}
+
+// markers parses the source of a package for its comment tags
+func (g *generator) markers(pkg string) *markers {
+	if m, ok := g.packages[pkg]; ok {
+		return m
+	}
+	m := &markers{fields: make(map[string]map[string][]string), enums: make(map[string][]any)}
+	g.packages[pkg] = m
+
+	bp, err := build.Import(pkg, ".", build.FindOnly)
+	if err != nil {
+		log.Fatal(err)
+	}
+	files, err := parser.ParseDir(token.NewFileSet(), bp.Dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+	values := make(map[string][]any)
+	for _, p := range files {
+		for _, file := range p.Files {
+			for _, decl := range file.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						doc := spec.Doc
+						if doc == nil && len(gd.Specs) == 1 {
+							doc = gd.Doc
+						}
+						if _, ok := commentTags(doc)["enum"]; ok {
+							m.enums[spec.Name.Name] = make([]any, 0)
+						}
+						st, ok := spec.Type.(*ast.StructType)
+						if !ok {
+							continue
+						}
+						for _, field := range st.Fields.List {
+							for _, name := range field.Names {
+								m.fields[spec.Name.Name+"."+name.Name] = commentTags(field.Doc)
+							}
+						}
+					case *ast.ValueSpec:
+						typ, ok := spec.Type.(*ast.Ident)
+						if gd.Tok != token.CONST || !ok {
+							continue
+						}
+						for _, value := range spec.Values {
+							lit, ok := value.(*ast.BasicLit)
+							if !ok || lit.Kind != token.STRING {
+								continue
+							}
+							v, _ := strconv.Unquote(lit.Value)
+							values[typ.Name] = append(values[typ.Name], v)
+						}
+					}
+				}
+			}
+		}
+	}
+	for name := range m.enums {
+		vs := values[name]
+		sort.Slice(vs, func(i, j int) bool { return vs[i].(string) < vs[j].(string) })
+		m.enums[name] = vs
+	}
+	return m
+}
+
+// commentTags returns the +key=value tags of a comment. Tags without
+// a value, such as +optional, have an empty value.
+func commentTags(doc *ast.CommentGroup) map[string][]string {
+	rv := make(map[string][]string)
+	if doc == nil {
+		return rv
+	}
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "+") {
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(line, "+"), "=")
+		rv[key] = append(rv[key], value)
+	}
+	return rv
+}
+
+// special are types with custom JSON encoding
+var special = map[string]func() *openapi.Schema{
+	"k8s.io/apimachinery/pkg/apis/meta/v1.Time":      func() *openapi.Schema { return &openapi.Schema{Type: "string", Format: "date-time"} },
+	"k8s.io/apimachinery/pkg/apis/meta/v1.MicroTime": func() *openapi.Schema { return &openapi.Schema{Type: "string", Format: "date-time"} },
+	"k8s.io/apimachinery/pkg/apis/meta/v1.Duration":  func() *openapi.Schema { return &openapi.Schema{Type: "string"} },
+	"k8s.io/apimachinery/pkg/api/resource.Quantity":  func() *openapi.Schema { return &openapi.Schema{Type: "string", IntOrString: true} },
+	"k8s.io/apimachinery/pkg/util/intstr.IntOrString": func() *openapi.Schema {
+		return &openapi.Schema{Type: "string", Format: "int-or-string", IntOrString: true}
+	},
+	"k8s.io/apimachinery/pkg/runtime.RawExtension": func() *openapi.Schema {
+		return &openapi.Schema{Type: "object", PreserveUnknownFields: true}
+	},
+	"k8s.io/apimachinery/pkg/apis/meta/v1.FieldsV1": func() *openapi.Schema {
+		return &openapi.Schema{Type: "object", PreserveUnknownFields: true}
+	},
+}
+
+// definitionName converts a Go type to the name Kubernetes uses for
+// its definition, e.g. io.k8s.api.apps.v1.Deployment
+func definitionName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	host, rest, _ := strings.Cut(pkg, "/")
+	labels := strings.Split(host, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".") + "." + strings.ReplaceAll(rest, "/", ".") + "." + t.Name()
+}
+
+func (g *generator) define(t reflect.Type) *openapi.Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Name() != "" && t.PkgPath() != "" {
+		if f, ok := special[t.PkgPath()+"."+t.Name()]; ok {
+			name := definitionName(t)
+			g.defs[name] = f()
+			return &openapi.Schema{Ref: "#/definitions/" + name}
+		}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		if t.Name() != "" && t.PkgPath() != "" {
+			if values, ok := g.markers(t.PkgPath()).enums[t.Name()]; ok && len(values) > 0 {
+				return &openapi.Schema{Type: "string", Enum: values}
+			}
+		}
+		return &openapi.Schema{Type: "string"}
+	case reflect.Bool:
+		return &openapi.Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openapi.Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openapi.Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openapi.Schema{Type: "string", Format: "byte"}
+		}
+		return &openapi.Schema{Type: "array", Items: g.define(t.Elem())}
+	case reflect.Map:
+		return &openapi.Schema{
+			Type:                 "object",
+			AdditionalProperties: &openapi.Additional{Allowed: true, Schema: g.define(t.Elem())},
+		}
+	case reflect.Interface:
+		return &openapi.Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := definitionName(t)
+		if _, ok := g.defs[name]; !ok {
+			// register the name before generating the properties, so that
+			// recursive types reference the definition
+			g.defs[name] = &openapi.Schema{}
+			*g.defs[name] = *g.object(t)
+		}
+		return &openapi.Schema{Ref: "#/definitions/" + name}
+	}
+	return &openapi.Schema{}
+}
+
+func (g *generator) object(t reflect.Type) *openapi.Schema {
+	s := &openapi.Schema{Type: "object", Properties: make(map[string]*openapi.Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" && (f.Anonymous || strings.Contains(opts, "inline")) {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			inline := g.object(ft)
+			for k, v := range inline.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, inline.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		tags := make(map[string][]string)
+		if t.Name() != "" {
+			tags = g.markers(t.PkgPath()).fields[t.Name()+"."+f.Name]
+		}
+		prop := g.define(f.Type)
+		if v, ok := tags["listType"]; ok {
+			prop.ListType = v[0]
+		}
+		prop.ListMapKeys = tags["listMapKey"]
+		if v, ok := tags["mapType"]; ok {
+			prop.MapType = v[0]
+		}
+		prop.PatchStrategy = f.Tag.Get("patchStrategy")
+		prop.PatchMergeKey = f.Tag.Get("patchMergeKey")
+		s.Properties[name] = prop
+
+		_, optional := tags["optional"]
+		if !optional && !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
@@ -0,0 +1,583 @@
+// Package openapi validates Kubernetes resources against the OpenAPI
+// schemas of a Kubernetes version, and the schemas of CustomResourceDefinitions.
+package openapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+//go:generate go run gen.go -kyaml
+//go:generate go run gen.go -types 1.27
+
+// DefaultVersion is the Kubernetes version used when a version
+// isn't provided
+const DefaultVersion = "1.27"
+
+// objectMeta is the definition of the metadata of every resource
+const objectMeta = "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+
+var (
+	// ErrUnknownVersion is returned when there aren't any schemas for
+	// a Kubernetes version
+	ErrUnknownVersion = errors.New("no schemas for kubernetes version")
+	// ErrUnknownKind is returned when there isn't a schema for the kind
+	// of a resource
+	ErrUnknownKind = errors.New("no schema for kind")
+)
+
+// schemas holds a gzipped JSON document per Kubernetes minor version, e.g.
+// schemas/v1.27.json.gz. Each document has the schema of every type in
+// either `definitions` (OpenAPI v2) or `components.schemas` (OpenAPI v3).
+//
+//go:embed schemas
+var schemas embed.FS
+
+// document is an OpenAPI v2 or v3 document. Only the schemas are decoded.
+type document struct {
+	Definitions map[string]*Schema `json:"definitions"`
+	Components  struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// Schemas are the schemas of every kind known to a Kubernetes version,
+// as well as any CRDs that have been added.
+type Schemas struct {
+	version     string
+	definitions map[string]*Schema
+	kinds       map[schema.GroupVersionKind]*Schema
+}
+
+var (
+	cache   = make(map[string]*Schemas)
+	cacheMu sync.Mutex
+)
+
+// Versions returns the Kubernetes minor versions that have embedded
+// schemas, e.g. 1.27
+func Versions() []string {
+	rv := make([]string, 0)
+	entries, _ := fs.ReadDir(schemas, "schemas")
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".json.gz") {
+			continue
+		}
+		rv = append(rv, strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".json.gz"))
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return minor(rv[i]) < minor(rv[j])
+	})
+	return rv
+}
+
+// Load returns the schemas of a Kubernetes version. The version can
+// be a minor version, such as 1.27, or a full version, such as v1.27.3,
+// in which case the patch version is ignored. An error is returned if
+// the version doesn't have embedded schemas.
+func Load(version string) (*Schemas, error) {
+	v, err := minorVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if s, ok := cache[v]; ok {
+		return s.Clone(), nil
+	}
+
+	f, err := schemas.Open("schemas/v" + v + ".json.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var doc document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode the schemas for kubernetes %s", v)
+	}
+	s := newSchemas(v, doc)
+	cache[v] = s
+	return s.Clone(), nil
+}
+
+// minorVersion returns the minor version of a Kubernetes version that
+// has embedded schemas, e.g. 1.27 for v1.27.3
+func minorVersion(version string) (string, error) {
+	if version == "" {
+		version = DefaultVersion
+	}
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return "", errors.Wrapf(ErrUnknownVersion, "%s, expected a version like 1.27", version)
+	}
+	if _, err := strconv.Atoi(parts[1]); err != nil {
+		return "", errors.Wrapf(ErrUnknownVersion, "%s, expected a version like 1.27", version)
+	}
+	supported := Versions()
+	for _, v := range supported {
+		if v == parts[0]+"."+parts[1] {
+			return v, nil
+		}
+	}
+	return "", errors.Wrapf(ErrUnknownVersion, "%s, the supported versions are %s", version, strings.Join(supported, ", "))
+}
+
+func newSchemas(version string, doc document) *Schemas {
+	s := &Schemas{
+		version:     version,
+		definitions: doc.Definitions,
+		kinds:       make(map[schema.GroupVersionKind]*Schema),
+	}
+	if s.definitions == nil {
+		s.definitions = doc.Components.Schemas
+	}
+	for name, def := range s.definitions {
+		if strings.HasSuffix(name, ".api.resource.Quantity") {
+			// quantities are strings, but numbers are accepted too
+			def.IntOrString = true
+		}
+		for _, gvk := range def.GroupVersionKinds {
+			s.kinds[schema.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}] = def
+		}
+	}
+	return s
+}
+
+// Version returns the Kubernetes minor version of the schemas
+func (s *Schemas) Version() string {
+	return s.version
+}
+
+// Clone returns a copy of the schemas. CRDs added to the copy aren't
+// added to the original.
+func (s *Schemas) Clone() *Schemas {
+	c := &Schemas{
+		version:     s.version,
+		definitions: s.definitions,
+		kinds:       make(map[schema.GroupVersionKind]*Schema, len(s.kinds)),
+	}
+	for gvk, def := range s.kinds {
+		c.kinds[gvk] = def
+	}
+	return c
+}
+
+// Has reports whether there's a schema for the kind
+func (s *Schemas) Has(gvk schema.GroupVersionKind) bool {
+	_, ok := s.kinds[gvk]
+	return ok
+}
+
+// IsCRD reports whether the resource is a CustomResourceDefinition
+func IsCRD(obj *resource.Object) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == "apiextensions.k8s.io" && gvk.Kind == "CustomResourceDefinition"
+}
+
+// AddCRD adds the schema of every version served by a CustomResourceDefinition.
+// Versions without a schema accept any fields.
+func (s *Schemas) AddCRD(obj *resource.Object) error {
+	if !IsCRD(obj) {
+		return errors.Errorf("%s is not a CustomResourceDefinition", resource.ParseKey(obj))
+	}
+	var crd struct {
+		Spec struct {
+			Group string `json:"group"`
+			Names struct {
+				Kind string `json:"kind"`
+			} `json:"names"`
+			// Version and Validation are only used by v1beta1
+			Version    string         `json:"version"`
+			Validation *crdValidation `json:"validation"`
+			Versions   []struct {
+				Name   string         `json:"name"`
+				Schema *crdValidation `json:"schema"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &crd); err != nil {
+		return errors.Wrapf(err, "invalid CustomResourceDefinition %s", obj.GetName())
+	}
+	if crd.Spec.Group == "" || crd.Spec.Names.Kind == "" {
+		return errors.Errorf("invalid CustomResourceDefinition %s: spec.group and spec.names.kind are required", obj.GetName())
+	}
+
+	add := func(version string, v *crdValidation) {
+		def := &Schema{Type: "object", PreserveUnknownFields: true}
+		if v != nil && v.OpenAPIV3Schema != nil {
+			def = v.OpenAPIV3Schema
+		}
+		s.kinds[schema.GroupVersionKind{Group: crd.Spec.Group, Version: version, Kind: crd.Spec.Names.Kind}] = def
+	}
+	if crd.Spec.Version != "" {
+		add(crd.Spec.Version, crd.Spec.Validation)
+	}
+	for _, v := range crd.Spec.Versions {
+		if v.Schema == nil {
+			v.Schema = crd.Spec.Validation
+		}
+		add(v.Name, v.Schema)
+	}
+	return nil
+}
+
+type crdValidation struct {
+	OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+}
+
+// AddCRDs adds every CustomResourceDefinition in the tree
+func (s *Schemas) AddCRDs(tree resource.Tree) error {
+	return tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+		if !IsCRD(obj) {
+			return nil
+		}
+		return s.AddCRD(obj)
+	}))
+}
+
+// AddFile adds the schemas in a file, which is either a stream of
+// CustomResourceDefinitions or an OpenAPI document
+func (s *Schemas) AddFile(data []byte) error {
+	var raw map[string]any
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if _, ok := raw["kind"]; !ok {
+		return s.AddDocument(data)
+	}
+	crds := resource.NewList()
+	if err := resource.InsertFromReader(crds, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	return s.AddCRDs(crds)
+}
+
+// AddDocument adds the schemas of an OpenAPI v2 or v3 document in either
+// JSON or YAML. Definitions with the x-kubernetes-group-version-kind
+// extension are added as the schema of those kinds.
+func (s *Schemas) AddDocument(data []byte) error {
+	// YAML is a superset of JSON, so both can be decoded as YAML, but the
+	// schemas are decoded from JSON
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return errors.Wrap(err, "invalid OpenAPI document")
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return errors.Wrap(err, "invalid OpenAPI document")
+	}
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return errors.Wrap(err, "invalid OpenAPI document")
+	}
+	added := newSchemas(s.version, doc)
+	if len(added.definitions) == 0 {
+		return errors.New("invalid OpenAPI document: expected definitions or components.schemas")
+	}
+
+	// the definitions are shared with the cache and every clone, so
+	// they're copied before adding to them
+	definitions := make(map[string]*Schema, len(s.definitions)+len(added.definitions))
+	for name, def := range s.definitions {
+		definitions[name] = def
+	}
+	for name, def := range added.definitions {
+		definitions[name] = def
+	}
+	s.definitions = definitions
+	for gvk, def := range added.kinds {
+		s.kinds[gvk] = def
+	}
+	return nil
+}
+
+// Violation is a field of a resource that doesn't match the schema
+type Violation struct {
+	// Path is the field path to the invalid field, e.g.
+	// spec.template.spec.containers[0].image
+	Path string
+	// Reason describes why the field is invalid
+	Reason string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Reason
+	}
+	return v.Path + ": " + v.Reason
+}
+
+// Validate checks a resource against the schema of its kind. ErrUnknownKind
+// is returned if there isn't a schema for the kind.
+func (s *Schemas) Validate(obj *resource.Object) ([]Violation, error) {
+	gvk := obj.GroupVersionKind()
+	def, ok := s.kinds[gvk]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKind, "%s", gvk)
+	}
+	v := &validator{definitions: s.definitions}
+	v.validateRoot(obj.Object, def)
+	return v.violations, nil
+}
+
+type validator struct {
+	definitions map[string]*Schema
+	violations  []Violation
+}
+
+func (v *validator) report(path string, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+// resolve follows $ref until it finds a schema that isn't a reference
+func (v *validator) resolve(s *Schema) *Schema {
+	for i := 0; s != nil && s.Ref != "" && i < 32; i++ {
+		s = v.definitions[refName(s.Ref)]
+	}
+	return s
+}
+
+// validateRoot validates a resource. Every resource has apiVersion, kind
+// and metadata, even when a CRD schema doesn't declare them.
+func (v *validator) validateRoot(obj map[string]any, s *Schema) {
+	s = v.resolve(s)
+	root := *s
+	root.Properties = make(map[string]*Schema, len(s.Properties)+3)
+	for name, prop := range s.Properties {
+		root.Properties[name] = prop
+	}
+	for _, name := range []string{"apiVersion", "kind"} {
+		if _, ok := root.Properties[name]; !ok {
+			root.Properties[name] = &Schema{Type: "string"}
+		}
+	}
+	if meta, ok := root.Properties["metadata"]; !ok || len(v.resolve(meta).Properties) == 0 {
+		root.Properties["metadata"] = &Schema{Type: "object", PreserveUnknownFields: true}
+		if _, ok := v.definitions[objectMeta]; ok {
+			root.Properties["metadata"] = &Schema{Ref: "#/definitions/" + objectMeta}
+		}
+	}
+	v.validate("", obj, &root)
+}
+
+func (v *validator) validate(path string, value any, s *Schema) {
+	s = v.resolve(s)
+	if s == nil || value == nil {
+		// null is the same as an unset field
+		return
+	}
+	for _, sub := range s.AllOf {
+		v.validate(path, value, sub)
+	}
+	if s.isIntOrString() {
+		if !isInteger(value) && !isString(value) {
+			v.report(path, "expected an integer or a string, got %s", typeName(value))
+		}
+		return
+	}
+	if alternatives := append(append([]*Schema{}, s.AnyOf...), s.OneOf...); len(alternatives) > 0 {
+		if !v.matchesAny(path, value, alternatives) {
+			v.report(path, "doesn't match any of the allowed schemas")
+			return
+		}
+	}
+
+	typ := s.Type
+	if typ == "" && len(s.Properties) > 0 {
+		typ = "object"
+	}
+	switch typ {
+	case "object":
+		m, ok := value.(map[string]any)
+		if !ok {
+			v.report(path, "expected an object, got %s", typeName(value))
+			return
+		}
+		v.validateObject(path, m, s)
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			v.report(path, "expected an array, got %s", typeName(value))
+			return
+		}
+		if s.Items != nil {
+			for k, item := range items {
+				v.validate(path+"["+strconv.Itoa(k)+"]", item, s.Items)
+			}
+		}
+	case "string":
+		if !isString(value) {
+			v.report(path, "expected a string, got %s", typeName(value))
+			return
+		}
+	case "integer":
+		if !isInteger(value) {
+			v.report(path, "expected an integer, got %s", typeName(value))
+			return
+		}
+	case "number":
+		if !isNumber(value) {
+			v.report(path, "expected a number, got %s", typeName(value))
+			return
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.report(path, "expected a boolean, got %s", typeName(value))
+			return
+		}
+	}
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		v.report(path, "unsupported value %v, expected one of %s", value, formatEnum(s.Enum))
+	}
+}
+
+func (v *validator) validateObject(path string, m map[string]any, s *Schema) {
+	for _, name := range s.Required {
+		if _, ok := m[name]; !ok {
+			v.report(join(path, name), "required field is missing")
+		}
+	}
+	// an object without any properties accepts any fields, such as a
+	// RawExtension
+	open := s.PreserveUnknownFields || len(s.Properties) == 0 ||
+		(s.AdditionalProperties != nil && s.AdditionalProperties.Allowed)
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if prop, ok := s.Properties[key]; ok {
+			v.validate(join(path, key), m[key], prop)
+			continue
+		}
+		if s.EmbeddedResource && (key == "apiVersion" || key == "kind" || key == "metadata") {
+			continue
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			v.validate(path+"["+key+"]", m[key], s.AdditionalProperties.Schema)
+			continue
+		}
+		if !open {
+			v.report(join(path, key), "unknown field %q", key)
+		}
+	}
+}
+
+// matchesAny reports whether the value matches at least one of the schemas
+func (v *validator) matchesAny(path string, value any, alternatives []*Schema) bool {
+	for _, alt := range alternatives {
+		sub := &validator{definitions: v.definitions}
+		sub.validate(path, value, alt)
+		if len(sub.violations) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func isString(value any) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+func isInteger(value any) bool {
+	switch n := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	case float64:
+		return n == float64(int64(n))
+	case float32:
+		return n == float32(int64(n))
+	}
+	return false
+}
+
+func isNumber(value any) bool {
+	switch value.(type) {
+	case float32, float64:
+		return true
+	}
+	return isInteger(value)
+}
+
+func typeName(value any) string {
+	switch {
+	case isString(value):
+		return "a string"
+	case isInteger(value):
+		return "an integer"
+	case isNumber(value):
+		return "a number"
+	}
+	switch value.(type) {
+	case bool:
+		return "a boolean"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	parts := make([]string, 0, len(enum))
+	for _, e := range enum {
+		parts = append(parts, fmt.Sprintf("%q", fmt.Sprint(e)))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// minor returns the minor version of a Kubernetes version, e.g. 27
+// for 1.27, so that versions can be sorted
+func minor(version string) int {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return 0
+	}
+	n, _ := strconv.Atoi(parts[1])
+	return n
+}
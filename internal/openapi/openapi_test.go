@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func object(t *testing.T, s string) *resource.Object {
+	t.Helper()
+	m := make(map[string]any)
+	qt.Assert(t, yaml.Unmarshal([]byte(s), &m), qt.IsNil)
+	return resource.Unstructured(m)
+}
+
+const crd = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [size]
+            properties:
+              size:
+                type: string
+                enum: [small, large]
+              labels:
+                type: object
+                additionalProperties:
+                  type: string
+  - name: v1alpha1
+    served: true
+    storage: false
+`
+
+func TestSchemas_Validate(t *testing.T) {
+	tests := map[string]struct {
+		obj  string
+		want []Violation
+	}{
+		"Valid": {
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels: {app: web}
+spec:
+  replicas: 2
+  selector:
+    matchLabels: {app: web}
+  template:
+    metadata:
+      labels: {app: web}
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        ports:
+        - containerPort: 80
+        resources:
+          limits: {cpu: 1, memory: 1Gi}
+`,
+			want: nil,
+		},
+		"UnknownField": {
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  replica: 2
+  selector: {matchLabels: {app: web}}
+  template:
+    spec:
+      containers: [{name: web, image: nginx}]
+`,
+			want: []Violation{{Path: "spec.replica", Reason: `unknown field "replica"`}},
+		},
+		"TypeMismatch": {
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  replicas: two
+  selector: {matchLabels: {app: web}}
+  template:
+    spec:
+      containers: [{name: web, image: nginx}]
+`,
+			want: []Violation{{Path: "spec.replicas", Reason: "expected an integer, got a string"}},
+		},
+		"MissingRequiredField": {
+			obj: `
+apiVersion: v1
+kind: Pod
+metadata: {name: web}
+spec:
+  containers:
+  - image: nginx
+`,
+			want: []Violation{{Path: "spec.containers[0].name", Reason: "required field is missing"}},
+		},
+		"IntOrString": {
+			obj: `
+apiVersion: v1
+kind: Service
+metadata: {name: web}
+spec:
+  ports:
+  - port: 80
+    targetPort: http
+  - port: 443
+    targetPort: true
+`,
+			want: []Violation{{Path: "spec.ports[1].targetPort", Reason: "expected an integer or a string, got a boolean"}},
+		},
+		"MapValues": {
+			obj: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+  labels:
+    app: [web]
+`,
+			want: []Violation{{Path: "metadata.labels[app]", Reason: "expected a string, got an array"}},
+		},
+	}
+	s, err := Load("1.27")
+	qt.Assert(t, err, qt.IsNil)
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := s.Validate(object(t, tt.obj))
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestSchemas_AddCRD(t *testing.T) {
+	s, err := Load("")
+	qt.Assert(t, err, qt.IsNil)
+
+	widget := object(t, `
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: foo}
+spec:
+  size: medium
+  color: red
+  labels: {team: 1}
+`)
+	_, err = s.Validate(widget)
+	qt.Assert(t, err, qt.ErrorIs, ErrUnknownKind)
+
+	qt.Assert(t, s.AddCRD(object(t, crd)), qt.IsNil)
+	got, err := s.Validate(widget)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.DeepEquals, []Violation{
+		{Path: "spec.color", Reason: `unknown field "color"`},
+		{Path: "spec.labels[team]", Reason: "expected a string, got an integer"},
+		{Path: "spec.size", Reason: `unsupported value medium, expected one of ["small", "large"]`},
+	})
+
+	// versions without a schema accept anything
+	widget.SetAPIVersion("example.com/v1alpha1")
+	got, err = s.Validate(widget)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.HasLen, 0)
+
+	// CRDs are only added to the schemas they were added to
+	other, err := Load("1.27")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, other.Has(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}), qt.IsFalse)
+}
+
+func TestLoad(t *testing.T) {
+	hpa := schema.GroupVersionKind{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"}
+
+	s, err := Load("v1.27.3")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, s.Version(), qt.Equals, "1.27")
+	qt.Assert(t, s.Has(hpa), qt.IsTrue)
+
+	s, err = Load("1.21")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, s.Has(hpa), qt.IsFalse)
+	qt.Assert(t, s.Has(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}), qt.IsTrue)
+
+	// versions without schemas aren't validated against another version
+	_, err = Load("1.26")
+	qt.Assert(t, err, qt.ErrorIs, ErrUnknownVersion)
+	qt.Assert(t, err, qt.ErrorMatches, `.*1.26, the supported versions are 1.21, 1.27.*`)
+
+	_, err = Load("latest")
+	qt.Assert(t, err, qt.ErrorIs, ErrUnknownVersion)
+	_, err = Load("2.1")
+	qt.Assert(t, err, qt.ErrorIs, ErrUnknownVersion)
+	qt.Assert(t, Versions(), qt.DeepEquals, []string{"1.21", "1.27"})
+}
@@ -0,0 +1,135 @@
+package openapi
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+const (
+	// strategies supported by a strategic merge patch
+	mergeStrategy   = "merge"
+	replaceStrategy = "replace"
+)
+
+var _ strategicpatch.LookupPatchMeta = patchMeta{}
+
+// LookupPatchMeta returns the strategic merge patch metadata for a kind,
+// which is read from the x-kubernetes-patch-strategy and
+// x-kubernetes-patch-merge-key extensions, or from the structural schema
+// extensions used by CRDs:
+//
+//   - x-kubernetes-list-type: map merges list items by the first of the
+//     x-kubernetes-list-map-keys
+//   - x-kubernetes-list-type: set merges list items by value
+//   - x-kubernetes-map-type: atomic replaces the whole object
+//
+// Lists without any of the extensions are replaced, and objects are
+// merged. The second return value is false if there's no schema for the kind.
+func (s *Schemas) LookupPatchMeta(gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, bool) {
+	def, ok := s.kinds[gvk]
+	if !ok {
+		return nil, false
+	}
+	v := &validator{definitions: s.definitions}
+	def = v.resolve(def)
+	root := *def
+	if meta, ok := def.Properties["metadata"]; !ok || len(v.resolve(meta).Properties) == 0 {
+		root.Properties = make(map[string]*Schema, len(def.Properties)+1)
+		for name, prop := range def.Properties {
+			root.Properties[name] = prop
+		}
+		root.Properties["metadata"] = &Schema{Ref: "#/definitions/" + objectMeta}
+	}
+	return patchMeta{definitions: s.definitions, schema: &root, name: gvk.Kind}, true
+}
+
+// patchMeta implements strategicpatch.LookupPatchMeta for a schema. A nil
+// schema is a field without a schema, which is merged with the defaults.
+type patchMeta struct {
+	definitions map[string]*Schema
+	schema      *Schema
+	name        string
+}
+
+func (p patchMeta) LookupPatchMetadataForStruct(key string) (strategicpatch.LookupPatchMeta, strategicpatch.PatchMeta, error) {
+	field := p.field(key)
+	return p.sub(field, key), meta(field, p.resolve(field)), nil
+}
+
+func (p patchMeta) LookupPatchMetadataForSlice(key string) (strategicpatch.LookupPatchMeta, strategicpatch.PatchMeta, error) {
+	field := p.field(key)
+	resolved := p.resolve(field)
+	var items *Schema
+	if resolved != nil {
+		items = resolved.Items
+	}
+	// the subschema of a slice is the schema of its items
+	return p.sub(items, key), meta(field, resolved), nil
+}
+
+func (p patchMeta) Name() string {
+	return p.name
+}
+
+func (p patchMeta) sub(s *Schema, key string) patchMeta {
+	return patchMeta{definitions: p.definitions, schema: s, name: key}
+}
+
+func (p patchMeta) resolve(s *Schema) *Schema {
+	return (&validator{definitions: p.definitions}).resolve(s)
+}
+
+// field returns the schema of a field of the object, or nil if the
+// object doesn't have a schema for the field
+func (p patchMeta) field(key string) *Schema {
+	s := p.resolve(p.schema)
+	if s == nil {
+		return nil
+	}
+	if prop, ok := s.Properties[key]; ok {
+		return prop
+	}
+	for _, sub := range s.AllOf {
+		if prop := (patchMeta{definitions: p.definitions, schema: sub}).field(key); prop != nil {
+			return prop
+		}
+	}
+	if s.AdditionalProperties != nil {
+		return s.AdditionalProperties.Schema
+	}
+	return nil
+}
+
+// meta returns the patch metadata of a field. Extensions on the field
+// take precedence over extensions on the definition it references.
+func meta(field, resolved *Schema) strategicpatch.PatchMeta {
+	rv := strategicpatch.PatchMeta{}
+	for _, s := range []*Schema{resolved, field} {
+		if s == nil {
+			continue
+		}
+		switch s.ListType {
+		case "map":
+			rv.SetPatchStrategies([]string{mergeStrategy})
+			if len(s.ListMapKeys) > 0 {
+				rv.SetPatchMergeKey(s.ListMapKeys[0])
+			}
+		case "set":
+			rv.SetPatchStrategies([]string{mergeStrategy})
+		case "atomic":
+			rv.SetPatchStrategies(nil)
+		}
+		if s.MapType == "atomic" {
+			rv.SetPatchStrategies([]string{replaceStrategy})
+		}
+		if s.PatchStrategy != "" {
+			rv.SetPatchStrategies(strings.Split(s.PatchStrategy, ","))
+		}
+		if s.PatchMergeKey != "" {
+			rv.SetPatchMergeKey(s.PatchMergeKey)
+		}
+	}
+	return rv
+}
@@ -0,0 +1,213 @@
+package openapi
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
+)
+
+const rolloutCRD = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: rollouts.example.com
+spec:
+  group: example.com
+  names:
+    kind: Rollout
+    plural: rollouts
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              steps:
+                type: array
+                x-kubernetes-list-type: map
+                x-kubernetes-list-map-keys: [name]
+                items:
+                  type: object
+                  properties:
+                    name: {type: string}
+                    weight: {type: integer}
+                    args:
+                      type: array
+                      x-kubernetes-list-type: set
+                      items: {type: string}
+              hosts:
+                type: array
+                items: {type: string}
+              ports:
+                type: array
+                x-kubernetes-patch-strategy: merge
+                x-kubernetes-patch-merge-key: port
+                items:
+                  type: object
+                  properties:
+                    port: {type: integer}
+                    protocol: {type: string}
+              selector:
+                type: object
+                x-kubernetes-map-type: atomic
+                additionalProperties: {type: string}
+              extra:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`
+
+func TestSchemas_LookupPatchMeta(t *testing.T) {
+	s, err := Load("")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, s.AddCRD(object(t, rolloutCRD)), qt.IsNil)
+
+	obj := object(t, `
+apiVersion: example.com/v1
+kind: Rollout
+metadata:
+  name: web
+  labels: {app: web}
+spec:
+  steps:
+  - name: canary
+    weight: 10
+    args: [a, b]
+  - name: stable
+    weight: 100
+  hosts: [a.example.com]
+  ports:
+  - port: 80
+    protocol: TCP
+  selector: {app: web, tier: frontend}
+  extra:
+    nested: {a: 1}
+    list: [1]
+`)
+	patch := object(t, `
+metadata:
+  labels: {team: platform}
+spec:
+  steps:
+  - name: canary
+    weight: 20
+    args: [b, c]
+  hosts: [b.example.com]
+  ports:
+  - port: 443
+    protocol: TCP
+  selector: {app: api}
+  extra:
+    nested: {b: 2}
+    list: [2]
+`)
+	qt.Assert(t, obj.StrategicMergePatch(patch.Object, s), qt.IsNil)
+
+	want := object(t, `
+apiVersion: example.com/v1
+kind: Rollout
+metadata:
+  name: web
+  labels: {app: web, team: platform}
+spec:
+  steps:
+  - name: canary
+    weight: 20
+    args: [a, b, c]
+  - name: stable
+    weight: 100
+  hosts: [b.example.com]
+  ports:
+  - port: 443
+    protocol: TCP
+  - port: 80
+    protocol: TCP
+  selector: {app: api}
+  extra:
+    nested: {a: 1, b: 2}
+    list: [2]
+`)
+	qt.Assert(t, obj.Object, qt.DeepEquals, want.Object)
+}
+
+func TestSchemas_LookupPatchMeta_UnknownKind(t *testing.T) {
+	s, err := Load("")
+	qt.Assert(t, err, qt.IsNil)
+	_, ok := s.LookupPatchMeta(object(t, rolloutCRD).GroupVersionKind())
+	qt.Assert(t, ok, qt.IsFalse)
+
+	obj := object(t, `
+apiVersion: example.com/v1
+kind: Rollout
+metadata: {name: web}
+`)
+	err = obj.StrategicMergePatch(map[string]any{"spec": map[string]any{}}, s)
+	var unregistered *dinghyerrors.ErrPatchStrategicMergeUnregisteredSchema
+	qt.Assert(t, err, qt.ErrorAs, &unregistered)
+}
+
+func TestSchemas_AddDocument(t *testing.T) {
+	s, err := Load("")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, s.AddFile([]byte(`
+openapi: 3.0.0
+components:
+  schemas:
+    com.example.v1.Gateway:
+      type: object
+      x-kubernetes-group-version-kind:
+      - group: example.com
+        version: v1
+        kind: Gateway
+      properties:
+        apiVersion: {type: string}
+        kind: {type: string}
+        metadata:
+          $ref: '#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta'
+        spec:
+          type: object
+          properties:
+            servers:
+              type: array
+              x-kubernetes-patch-strategy: merge
+              x-kubernetes-patch-merge-key: name
+              items:
+                $ref: '#/components/schemas/com.example.v1.Server'
+    com.example.v1.Server:
+      type: object
+      properties:
+        name: {type: string}
+        port: {type: integer}
+`)), qt.IsNil)
+
+	obj := object(t, `
+apiVersion: example.com/v1
+kind: Gateway
+metadata: {name: web}
+spec:
+  servers:
+  - {name: http, port: 80}
+`)
+	qt.Assert(t, obj.StrategicMergePatch(map[string]any{
+		"spec": map[string]any{
+			"servers": []any{map[string]any{"name": "https", "port": 443}},
+		},
+	}, s), qt.IsNil)
+	qt.Assert(t, obj.Object["spec"], qt.DeepEquals, map[string]any{
+		"servers": []any{
+			map[string]any{"name": "https", "port": 443},
+			map[string]any{"name": "http", "port": 80},
+		},
+	})
+
+	violations, err := s.Validate(obj)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, violations, qt.HasLen, 0)
+}
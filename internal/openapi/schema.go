@@ -0,0 +1,79 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Schema is the subset of an OpenAPI schema used to validate Kubernetes
+// resources. It can be decoded from OpenAPI v2 definitions, OpenAPI v3
+// component schemas and the openAPIV3Schema of a CRD.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+
+	IntOrString           bool  `json:"x-kubernetes-int-or-string,omitempty"`
+	PreserveUnknownFields bool  `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	EmbeddedResource      bool  `json:"x-kubernetes-embedded-resource,omitempty"`
+	GroupVersionKinds     []GVK `json:"x-kubernetes-group-version-kind,omitempty"`
+
+	// the extensions used by strategic merge patches
+	PatchStrategy string   `json:"x-kubernetes-patch-strategy,omitempty"`
+	PatchMergeKey string   `json:"x-kubernetes-patch-merge-key,omitempty"`
+	ListType      string   `json:"x-kubernetes-list-type,omitempty"`
+	ListMapKeys   []string `json:"x-kubernetes-list-map-keys,omitempty"`
+	MapType       string   `json:"x-kubernetes-map-type,omitempty"`
+}
+
+// GVK is the group, version and kind of a resource in the
+// x-kubernetes-group-version-kind extension
+type GVK struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// Additional is the additionalProperties of an object schema, which is
+// either a boolean or a schema for every additional property
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+func (a Additional) MarshalJSON() ([]byte, error) {
+	if a.Schema != nil {
+		return json.Marshal(a.Schema)
+	}
+	return json.Marshal(a.Allowed)
+}
+
+// isIntOrString reports whether the schema accepts either an integer
+// or a string, such as an IntOrString or a Quantity
+func (s *Schema) isIntOrString() bool {
+	return s.IntOrString || s.Format == "int-or-string"
+}
+
+// refName returns the name of the definition a $ref points to. Refs in
+// OpenAPI v2 are #/definitions/<name> and refs in OpenAPI v3 are
+// #/components/schemas/<name>.
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
@@ -0,0 +1,204 @@
+// Package output writes the resources of a build in the formats that
+// dinghy build supports.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// Formats are the supported output formats
+var Formats = []string{"yaml", "json", "ndjson", "dir=<path>", "kustomize=<path>"}
+
+// Format writes resources, either to stdout or to files
+type Format interface {
+	Write(objs []*resource.Object, stdout io.Writer) error
+}
+
+// Parse parses an output format, which is one of Formats
+func Parse(format string) (Format, error) {
+	name, dir, hasDir := strings.Cut(format, "=")
+	switch {
+	case name == "yaml" && !hasDir:
+		return YAML{}, nil
+	case name == "json" && !hasDir:
+		return JSON{}, nil
+	case name == "ndjson" && !hasDir:
+		return NDJSON{}, nil
+	case name == "dir" && dir != "":
+		return &Dir{Path: dir}, nil
+	case name == "kustomize" && dir != "":
+		return &Dir{Path: dir, Kustomization: true}, nil
+	}
+	return nil, errors.Errorf("unknown output format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// YAML writes a stream of YAML documents
+type YAML struct{}
+
+func (YAML) Write(objs []*resource.Object, stdout io.Writer) error {
+	e := yaml.NewEncoder(stdout)
+	for _, obj := range objs {
+		if err := e.Encode(obj.Object); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+// JSON writes a v1 List with the resources as its items
+type JSON struct{}
+
+func (JSON) Write(objs []*resource.Object, stdout io.Writer) error {
+	items := make([]any, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, obj.Object)
+	}
+	e := json.NewEncoder(stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	})
+}
+
+// NDJSON writes one JSON document per line
+type NDJSON struct{}
+
+func (NDJSON) Write(objs []*resource.Object, stdout io.Writer) error {
+	e := json.NewEncoder(stdout)
+	for _, obj := range objs {
+		if err := e.Encode(obj.Object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	// dinghyFile means a directory is a dinghyfile package, and not the
+	// output of a build, so nothing is written to it
+	dinghyFile = "dinghyfile.yaml"
+	// outputFile lists the files Dir wrote to a directory, one per line
+	outputFile = ".dinghy-output"
+)
+
+// Dir writes each resource to its own file in Path, named
+// <kind>_<namespace>_<name>.yaml, or <kind>_<name>.yaml for cluster
+// scoped resources. The files of the previous write, which are listed in
+// Path/.dinghy-output, are removed first, so resources that were removed
+// from the build don't leave stale files behind. Other files in Path are
+// kept, and they're never overwritten.
+type Dir struct {
+	Path string
+	// Kustomization also writes a kustomization.yaml that lists the files
+	// as its resources, in the order they're written
+	Kustomization bool
+}
+
+func (d *Dir) Write(objs []*resource.Object, _ io.Writer) error {
+	// check every file name before anything is written or removed, so a
+	// conflict doesn't leave a partial output
+	files := make([]string, 0, len(objs))
+	written := make(map[string]resource.Key, len(objs))
+	for _, obj := range objs {
+		name := FileName(obj)
+		if other, ok := written[name]; ok {
+			return errors.Errorf("%s and %s are both written to %s", other, resource.ParseKey(obj), name)
+		}
+		written[name] = resource.ParseKey(obj)
+		files = append(files, name)
+	}
+
+	if d.Kustomization {
+		files = append(files, "kustomization.yaml")
+	}
+
+	if err := os.MkdirAll(d.Path, 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(d.Path, dinghyFile)); err == nil {
+		return errors.Errorf("%s has a %s, so it isn't an output directory", d.Path, dinghyFile)
+	}
+	previous, err := d.previous()
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		if previous[name] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(d.Path, name)); err == nil {
+			return errors.Errorf("%s already has a %s that wasn't written by dinghy", d.Path, name)
+		}
+	}
+	for name := range previous {
+		if err := os.Remove(filepath.Join(d.Path, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for k, obj := range objs {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return errors.Wrapf(err, "%s", resource.ParseKey(obj))
+		}
+		if err := os.WriteFile(filepath.Join(d.Path, files[k]), data, 0o644); err != nil {
+			return err
+		}
+	}
+	if d.Kustomization {
+		data, err := yaml.Marshal(map[string]any{
+			"apiVersion": "kustomize.config.k8s.io/v1beta1",
+			"kind":       "Kustomization",
+			"resources":  files[:len(objs)],
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(d.Path, "kustomization.yaml"), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(d.Path, outputFile), []byte(strings.Join(files, "\n")+"\n"), 0o644)
+}
+
+// previous returns the files the previous write listed in outputFile.
+// Names that aren't a file in Path are ignored.
+func (d *Dir) previous() (map[string]bool, error) {
+	data, err := os.ReadFile(filepath.Join(d.Path, outputFile))
+	if os.IsNotExist(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rv := make(map[string]bool)
+	for _, name := range strings.Split(string(data), "\n") {
+		if name == "" || name != filepath.Base(name) || name == ".." || name == outputFile {
+			continue
+		}
+		rv[name] = true
+	}
+	return rv, nil
+}
+
+// FileName returns the name of the file a resource is written to by Dir
+func FileName(obj *resource.Object) string {
+	parts := []string{strings.ToLower(obj.GetKind())}
+	if ns := obj.GetNamespace(); ns != "" {
+		parts = append(parts, ns)
+	}
+	parts = append(parts, obj.GetName())
+	return fmt.Sprintf("%s.yaml", strings.Join(parts, "_"))
+}
@@ -0,0 +1,217 @@
+package output
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func testObjects() []*resource.Object {
+	return []*resource.Object{
+		resource.Unstructured(map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]any{"name": "app"},
+		}),
+		resource.Unstructured(map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web", "namespace": "app"},
+			"spec":       map[string]any{"replicas": 2},
+		}),
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		want   Format
+		err    string
+	}{
+		"yaml":           {format: "yaml", want: YAML{}},
+		"json":           {format: "json", want: JSON{}},
+		"ndjson":         {format: "ndjson", want: NDJSON{}},
+		"dir":            {format: "dir=out", want: &Dir{Path: "out"}},
+		"kustomize":      {format: "kustomize=out/base", want: &Dir{Path: "out/base", Kustomization: true}},
+		"dir without":    {format: "dir", err: `unknown output format "dir", expected one of yaml, json, ndjson, dir=<path>, kustomize=<path>`},
+		"dir empty path": {format: "dir=", err: `unknown output format "dir=".*`},
+		"yaml with path": {format: "yaml=out", err: `unknown output format "yaml=out".*`},
+		"unknown":        {format: "toml", err: `unknown output format "toml".*`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Parse(tt.format)
+			if tt.err != "" {
+				qt.Assert(t, err, qt.ErrorMatches, tt.err)
+				return
+			}
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestFormat_Write(t *testing.T) {
+	tests := map[string]struct {
+		format Format
+		want   string
+	}{
+		"yaml": {
+			format: YAML{},
+			want: `apiVersion: v1
+kind: Namespace
+metadata:
+    name: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: web
+    namespace: app
+spec:
+    replicas: 2
+`,
+		},
+		"json": {
+			format: JSON{},
+			want: `{
+  "apiVersion": "v1",
+  "items": [
+    {
+      "apiVersion": "v1",
+      "kind": "Namespace",
+      "metadata": {
+        "name": "app"
+      }
+    },
+    {
+      "apiVersion": "apps/v1",
+      "kind": "Deployment",
+      "metadata": {
+        "name": "web",
+        "namespace": "app"
+      },
+      "spec": {
+        "replicas": 2
+      }
+    }
+  ],
+  "kind": "List"
+}
+`,
+		},
+		"ndjson": {
+			format: NDJSON{},
+			want: `{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"app"}}
+{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"app"},"spec":{"replicas":2}}
+`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			qt.Assert(t, tt.format.Write(testObjects(), buf), qt.IsNil)
+			qt.Assert(t, buf.String(), qt.Equals, tt.want)
+		})
+	}
+}
+
+func TestDir_Write(t *testing.T) {
+	readFile := func(t *testing.T, name string) string {
+		data, err := os.ReadFile(name)
+		qt.Assert(t, err, qt.IsNil)
+		return string(data)
+	}
+
+	t.Run("dir", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "out")
+		buf := new(bytes.Buffer)
+		qt.Assert(t, (&Dir{Path: dir}).Write(testObjects(), buf), qt.IsNil)
+		qt.Assert(t, buf.Len(), qt.Equals, 0)
+
+		entries, err := os.ReadDir(dir)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, entries, qt.HasLen, 3)
+		qt.Assert(t, readFile(t, filepath.Join(dir, ".dinghy-output")), qt.Equals,
+			"namespace_app.yaml\ndeployment_app_web.yaml\n")
+		qt.Assert(t, readFile(t, filepath.Join(dir, "namespace_app.yaml")), qt.Equals,
+			"apiVersion: v1\nkind: Namespace\nmetadata:\n    name: app\n")
+		qt.Assert(t, readFile(t, filepath.Join(dir, "deployment_app_web.yaml")), qt.Contains, "replicas: 2")
+	})
+
+	t.Run("kustomize", func(t *testing.T) {
+		dir := t.TempDir()
+		qt.Assert(t, (&Dir{Path: dir, Kustomization: true}).Write(testObjects(), nil), qt.IsNil)
+		qt.Assert(t, readFile(t, filepath.Join(dir, "kustomization.yaml")), qt.Equals, `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+    - namespace_app.yaml
+    - deployment_app_web.yaml
+`)
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		dir := t.TempDir()
+		// files that dinghy didn't write are kept
+		for _, name := range []string{"configmap_app_web.yaml", "README.md"} {
+			qt.Assert(t, os.WriteFile(filepath.Join(dir, name), []byte("old"), 0o644), qt.IsNil)
+		}
+		service := resource.Unstructured(map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]any{"name": "web", "namespace": "app"},
+		})
+		qt.Assert(t, (&Dir{Path: dir, Kustomization: true}).Write(append(testObjects(), service), nil), qt.IsNil)
+		qt.Assert(t, (&Dir{Path: dir}).Write(testObjects(), nil), qt.IsNil)
+
+		entries, err := os.ReadDir(dir)
+		qt.Assert(t, err, qt.IsNil)
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		qt.Assert(t, names, qt.DeepEquals, []string{".dinghy-output", "README.md", "configmap_app_web.yaml", "deployment_app_web.yaml", "namespace_app.yaml"})
+		qt.Assert(t, readFile(t, filepath.Join(dir, "configmap_app_web.yaml")), qt.Equals, "old")
+	})
+
+	t.Run("existing", func(t *testing.T) {
+		dir := t.TempDir()
+		qt.Assert(t, os.WriteFile(filepath.Join(dir, "namespace_app.yaml"), []byte("old"), 0o644), qt.IsNil)
+		err := (&Dir{Path: dir}).Write(testObjects(), nil)
+		qt.Assert(t, err, qt.ErrorMatches, `.* already has a namespace_app.yaml that wasn't written by dinghy`)
+		qt.Assert(t, readFile(t, filepath.Join(dir, "namespace_app.yaml")), qt.Equals, "old")
+	})
+
+	t.Run("dinghyfile", func(t *testing.T) {
+		dir := t.TempDir()
+		qt.Assert(t, os.WriteFile(filepath.Join(dir, "dinghyfile.yaml"), []byte("kind: Config"), 0o644), qt.IsNil)
+		err := (&Dir{Path: dir}).Write(testObjects(), nil)
+		qt.Assert(t, err, qt.ErrorMatches, `.* has a dinghyfile.yaml, so it isn't an output directory`)
+		_, err = os.Stat(filepath.Join(dir, "dinghyfile.yaml"))
+		qt.Assert(t, err, qt.IsNil)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		objs := append(testObjects(), resource.Unstructured(map[string]any{
+			"apiVersion": "extensions/v1beta1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web", "namespace": "app"},
+		}))
+		dir := t.TempDir()
+		qt.Assert(t, os.WriteFile(filepath.Join(dir, "service_app_web.yaml"), []byte("old"), 0o644), qt.IsNil)
+		err := (&Dir{Path: dir}).Write(objs, nil)
+		qt.Assert(t, err, qt.ErrorMatches,
+			`apps.v1.Deployment/app/web and extensions.v1beta1.Deployment/app/web are both written to deployment_app_web.yaml`)
+
+		// nothing is written or removed
+		entries, err := os.ReadDir(dir)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, entries, qt.HasLen, 1)
+		qt.Assert(t, entries[0].Name(), qt.Equals, "service_app_web.yaml")
+	})
+}
@@ -51,6 +51,21 @@ func (bp Path) String(path ...string) string {
 	return bp.path.toString(bp.root, path...)
 }
 
+// IsZero reports whether the path is the zero value
+func (bp Path) IsZero() bool {
+	return bp.path == nil
+}
+
 func (bp Path) Relative() bool {
 	return IsRelative(bp.root)
 }
+
+// Origin returns the repository URL and ref of a GitHub path, and the
+// path of the file in the repository. Other paths aren't in a repository,
+// so file is the same as String.
+func (bp Path) Origin(path ...string) (repo, ref, file string) {
+	if g, ok := bp.path.(*GitHub); ok {
+		return "https://github.com/" + g.Owner + "/" + g.Repo, g.Ref, g.join(bp.root, path...)
+	}
+	return "", "", bp.String(path...)
+}
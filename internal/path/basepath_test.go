@@ -115,3 +115,17 @@ func TestPath_Join(t *testing.T) {
 	joinedPath := path.Join(segments...)
 	c.Assert(joinedPath.root, qt.Equals, expectedJoinedPath)
 }
+
+func TestPath_Origin(t *testing.T) {
+	p, err := Parse("https://github.com/johnhoman/dinghy/examples/mutate-namespace?ref=v0.1.0")
+	qt.Assert(t, err, qt.IsNil)
+	repo, ref, file := p.Origin("deployment.yaml")
+	qt.Assert(t, repo, qt.Equals, "https://github.com/johnhoman/dinghy")
+	qt.Assert(t, ref, qt.Equals, "v0.1.0")
+	qt.Assert(t, file, qt.Equals, "examples/mutate-namespace/deployment.yaml")
+
+	repo, ref, file = MustParse("examples/mutate-namespace").Origin("deployment.yaml")
+	qt.Assert(t, repo, qt.Equals, "")
+	qt.Assert(t, ref, qt.Equals, "")
+	qt.Assert(t, file, qt.Equals, "examples/mutate-namespace/deployment.yaml")
+}
@@ -64,6 +64,20 @@ func IsRelative(path string) bool {
 	return false
 }
 
+// ReadSource reads a file that's either relative to root, or an absolute
+// or remote path. Relative files are read from the working directory
+// if root is zero.
+func ReadSource(source string, root Path) ([]byte, error) {
+	if IsRelative(source) && !root.IsZero() {
+		return root.ReadFile(source)
+	}
+	p, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return p.ReadFile()
+}
+
 func MustParse(in string) Path {
 	parsed, err := Parse(in)
 	if err != nil {
@@ -0,0 +1,30 @@
+package path
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestReadSource(t *testing.T) {
+	mem := NewMemory()
+	qt.Assert(t, mem.WriteFile("app/crds.yaml", []byte("relative")), qt.IsNil)
+	root := NewPath(mem, "app")
+
+	abs := filepath.Join(t.TempDir(), "crds.yaml")
+	qt.Assert(t, os.WriteFile(abs, []byte("absolute"), 0o644), qt.IsNil)
+
+	data, err := ReadSource("crds.yaml", root)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, string(data), qt.Equals, "relative")
+
+	// absolute paths aren't read from the root
+	data, err = ReadSource(abs, root)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, string(data), qt.Equals, "absolute")
+
+	_, err = ReadSource("s3://bucket/crds.yaml", root)
+	qt.Assert(t, err, qt.IsNotNil)
+}
@@ -0,0 +1,90 @@
+// Package registry maps the names that configs use plugins by to the
+// plugins. Generators, mutators and validators each have a Registry.
+package registry
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Plugin is a generator, mutator or validator
+type Plugin interface {
+	Name() string
+}
+
+// Registry maps names to plugins of type T. Registries are values, so
+// that builds in the same process can use different sets of plugins.
+// A Registry is safe to use from multiple goroutines.
+type Registry[T Plugin] struct {
+	mu    sync.RWMutex
+	store map[string]func() any
+	// notFound is returned by Get for names that aren't registered
+	notFound error
+}
+
+// New returns an empty Registry. Get returns notFound for names that
+// aren't registered.
+func New[T Plugin](notFound error) *Registry[T] {
+	return &Registry[T]{store: make(map[string]func() any), notFound: notFound}
+}
+
+// Get returns a new instance of the plugin registered under name
+func (r *Registry[T]) Get(name string) (any, error) {
+	r.mu.RLock()
+	f, ok := r.store[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, r.notFound
+	}
+	return f(), nil
+}
+
+func (r *Registry[T]) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.store[name]
+	return ok
+}
+
+// Names returns the sorted names of every registered plugin
+func (r *Registry[T]) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rv := make([]string, 0, len(r.store))
+	for name := range r.store {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// Register registers a plugin under its name. A new instance of the
+// plugin is created every time it's used, and the registry will handle
+// deserializing YAML into the new instance when the plugin is invoked
+func (r *Registry[T]) Register(p T) {
+	r.RegisterFunc(p.Name(), func() any {
+		t := reflect.TypeOf(p).Elem()
+		return reflect.New(t).Interface()
+	})
+}
+
+// RegisterFunc registers a function that creates the plugin used
+// for name
+func (r *Registry[T]) RegisterFunc(name string, f func() any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store[name] = f
+}
+
+// Clone returns a copy of the registry. Registering plugins on the
+// copy doesn't change the original.
+func (r *Registry[T]) Clone() *Registry[T] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := New[T](r.notFound)
+	for name, f := range r.store {
+		c.store[name] = f
+	}
+	return c
+}
@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+var errNotFound = errors.New("plugin not found")
+
+type plugin struct {
+	Value string `yaml:"value"`
+}
+
+func (p *plugin) Name() string { return "example.com/plugin" }
+
+func TestRegistry(t *testing.T) {
+	r := New[*plugin](errNotFound)
+	r.Register(&plugin{Value: "registered"})
+	qt.Assert(t, r.Has("example.com/plugin"), qt.IsTrue)
+	qt.Assert(t, r.Names(), qt.DeepEquals, []string{"example.com/plugin"})
+
+	// every Get returns a new, empty instance
+	got, err := r.Get("example.com/plugin")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.DeepEquals, &plugin{})
+
+	_, err = r.Get("example.com/other")
+	qt.Assert(t, err, qt.ErrorIs, errNotFound)
+
+	c := r.Clone()
+	c.RegisterFunc("example.com/other", func() any { return &plugin{} })
+	qt.Assert(t, c.Has("example.com/other"), qt.IsTrue)
+	qt.Assert(t, r.Has("example.com/other"), qt.IsFalse)
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	r := New[*plugin](errNotFound)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			r.RegisterFunc(fmt.Sprintf("example.com/plugin-%d", i), func() any { return &plugin{} })
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = r.Clone().Names()
+		}()
+	}
+	wg.Wait()
+	qt.Assert(t, r.Names(), qt.HasLen, 10)
+}
@@ -0,0 +1,209 @@
+package resource
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EventType is the kind of change an Event records
+type EventType string
+
+const (
+	// EventCreated is recorded when a resource is read from a file or
+	// emitted by a generator
+	EventCreated EventType = "created"
+	// EventIncluded is recorded when a resource that was built by a
+	// nested dinghyfile is added to the tree of the dinghyfile that
+	// includes it
+	EventIncluded EventType = "included"
+	// EventChanged is recorded when a step of a build changes the fields
+	// of a resource
+	EventChanged EventType = "changed"
+)
+
+// Event is a change made to a resource by a step of a build, such as a
+// mutation. The events of a resource explain how it got its final form.
+type Event struct {
+	// File is the dinghyfile of the step. It's empty if the config wasn't
+	// read from a file.
+	File string
+	// Field is the entry of the dinghyfile that made the change, e.g.
+	// resources[0] or mutate[2]
+	Field string
+	// Name is the name of the entry, if it has one
+	Name string
+	// Uses is the plugin of a generate or mutate entry, or the path of a
+	// resources or overlays entry
+	Uses string
+	Type EventType
+	// Paths are the field paths that changed, such as
+	// spec.template.spec.containers[name=web].image. They're empty for
+	// created and included resources.
+	Paths []string
+}
+
+// String describes the event, e.g.
+// `mutate[0] (builtin.dinghy.dev/metadata/namespace) in dinghyfile.yaml: changed metadata.namespace`
+func (e Event) String() string {
+	b := new(strings.Builder)
+	b.WriteString(e.Field)
+	if e.Name != "" {
+		fmt.Fprintf(b, " %q", e.Name)
+	}
+	if e.Uses != "" {
+		fmt.Fprintf(b, " (%s)", e.Uses)
+	}
+	if e.File != "" {
+		fmt.Fprintf(b, " in %s", e.File)
+	}
+	fmt.Fprintf(b, ": %s", e.Type)
+	if len(e.Paths) > 0 {
+		fmt.Fprintf(b, " %s", strings.Join(e.Paths, ", "))
+	}
+	return b.String()
+}
+
+// ChangedFields returns the field paths of every value that's different
+// in before and after, sorted. Paths are written in the syntax of
+// fieldpath.Parse, and list items that have a name are indexed by it,
+// e.g. spec.containers[name=web].image. Numbers are compared by value, so
+// an int and a float64 of the same value aren't a change.
+func ChangedFields(before, after map[string]any) []string {
+	fields := make([]string, 0)
+	changedFields("", before, after, &fields)
+	sort.Strings(fields)
+	return fields
+}
+
+func changedFields(path string, a, b any, fields *[]string) {
+	am, aIsMap := a.(map[string]any)
+	bm, bIsMap := b.(map[string]any)
+	al, aIsList := a.([]any)
+	bl, bIsList := b.([]any)
+	switch {
+	case (aIsMap || a == nil) && (bIsMap || b == nil):
+		keys := make(map[string]bool)
+		for key := range am {
+			keys[key] = true
+		}
+		for key := range bm {
+			keys[key] = true
+		}
+		for key := range keys {
+			changedFields(joinField(path, key), am[key], bm[key], fields)
+		}
+		if len(keys) > 0 {
+			return
+		}
+	case (aIsList || a == nil) && (bIsList || b == nil):
+		if names, ok := itemNames(al, bl); ok {
+			for name := range names {
+				changedFields(fmt.Sprintf("%s[name=%s]", path, quoteField(name)),
+					itemNamed(al, name), itemNamed(bl, name), fields)
+			}
+			return
+		}
+		for k := 0; k < len(al) || k < len(bl); k++ {
+			var x, y any
+			if k < len(al) {
+				x = al[k]
+			}
+			if k < len(bl) {
+				y = bl[k]
+			}
+			changedFields(fmt.Sprintf("%s[%d]", path, k), x, y, fields)
+		}
+		if len(al) > 0 || len(bl) > 0 {
+			return
+		}
+	}
+	// values that aren't maps or lists, and empty maps and lists, are
+	// compared as a whole
+	if !equalValue(a, b) {
+		*fields = append(*fields, path)
+	}
+}
+
+// itemNames returns the names of the items of a and b, if every item is
+// a map with a unique name
+func itemNames(a, b []any) (map[string]bool, bool) {
+	names := make(map[string]bool)
+	for _, items := range [][]any{a, b} {
+		seen := make(map[string]bool)
+		for _, item := range items {
+			m, ok := item.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			name, ok := m["name"].(string)
+			if !ok || seen[name] {
+				return nil, false
+			}
+			seen[name] = true
+			names[name] = true
+		}
+	}
+	return names, len(names) > 0
+}
+
+func itemNamed(items []any, name string) any {
+	for _, item := range items {
+		if item.(map[string]any)["name"] == name {
+			return item
+		}
+	}
+	return nil
+}
+
+var fieldIdentifier = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+func joinField(path, key string) string {
+	if !fieldIdentifier.MatchString(key) {
+		return path + "[" + quoteField(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// quoteField quotes field names and values that aren't identifiers, such
+// as app.kubernetes.io/name
+func quoteField(s string) string {
+	switch {
+	case fieldIdentifier.MatchString(s):
+		return s
+	case strings.Contains(s, "'"):
+		return `"` + s + `"`
+	default:
+		return "'" + s + "'"
+	}
+}
+
+func equalValue(a, b any) bool {
+	x, xIsNumber := number(a)
+	y, yIsNumber := number(b)
+	if xIsNumber && yIsNumber {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
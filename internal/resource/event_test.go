@@ -0,0 +1,65 @@
+package resource
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestChangedFields(t *testing.T) {
+	tests := map[string]struct {
+		before map[string]any
+		after  map[string]any
+		want   []string
+	}{
+		"Equal": {
+			before: map[string]any{"spec": map[string]any{"replicas": 1}},
+			after:  map[string]any{"spec": map[string]any{"replicas": 1}},
+			want:   []string{},
+		},
+		"Numbers": {
+			before: map[string]any{"spec": map[string]any{"replicas": 1, "ports": []any{map[string]any{"port": 80}}}},
+			after:  map[string]any{"spec": map[string]any{"replicas": float64(1), "ports": []any{map[string]any{"port": int64(80)}}}},
+			want:   []string{},
+		},
+		"Added": {
+			before: map[string]any{"metadata": map[string]any{"name": "web"}},
+			after: map[string]any{"metadata": map[string]any{
+				"name":   "web",
+				"labels": map[string]any{"app.kubernetes.io/name": "web", "team": "platform"},
+			}},
+			want: []string{"metadata.labels.team", "metadata.labels['app.kubernetes.io/name']"},
+		},
+		"Removed": {
+			before: map[string]any{"metadata": map[string]any{"name": "web", "annotations": map[string]any{}}},
+			after:  map[string]any{"metadata": map[string]any{"name": "web"}},
+			want:   []string{"metadata.annotations"},
+		},
+		"ListByName": {
+			before: map[string]any{"containers": []any{
+				map[string]any{"name": "web", "image": "nginx:1.25"},
+				map[string]any{"name": "log-shipper", "image": "fluent-bit:2"},
+			}},
+			after: map[string]any{"containers": []any{
+				map[string]any{"name": "log-shipper", "image": "fluent-bit:2"},
+				map[string]any{"name": "web", "image": "nginx:1.26"},
+			}},
+			want: []string{"containers[name=web].image"},
+		},
+		"ListByIndex": {
+			before: map[string]any{"args": []any{"--port", "80"}},
+			after:  map[string]any{"args": []any{"--port", "8080", "--debug"}},
+			want:   []string{"args[1]", "args[2]"},
+		},
+		"Type": {
+			before: map[string]any{"data": map[string]any{"port": "80"}},
+			after:  map[string]any{"data": "port=80"},
+			want:   []string{"data"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			qt.Assert(t, ChangedFields(tt.before, tt.after), qt.DeepEquals, tt.want)
+		})
+	}
+}
@@ -20,10 +20,17 @@ type List struct {
 }
 
 func (l *List) Visit(visitor Visitor, opts ...MatchOption) error {
+	s := NewSelector(opts...)
+	// the scopes of custom resources are read from the list, so they're
+	// read before the list is locked
+	clusterScoped, err := s.scopes(l)
+	if err != nil {
+		return err
+	}
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	for _, obj := range l.objs {
-		if obj.Matches(opts...) {
+		if s.Matches(obj, clusterScoped) {
 			if err := visitor.Visit(obj); err != nil {
 				// visitor will return a specific error here related
 				// to the error associated with the resource kind, so just
@@ -38,12 +45,12 @@ func (l *List) Visit(visitor Visitor, opts ...MatchOption) error {
 func (l *List) Insert(obj *Object) error {
 	key := newResourceKey(obj)
 	l.mu.Lock()
-	if exists, ok := l.objs[key]; ok && obj.Equals(exists) {
-		// return meaningful error
-		return ErrResourceConflict
+	defer l.mu.Unlock()
+	setSequence(obj)
+	if exists, ok := l.objs[key]; ok && !obj.Equals(exists) {
+		return conflictError(exists, obj)
 	}
 	l.objs[key] = obj
-	l.mu.Unlock()
 	return nil
 }
 
@@ -59,9 +66,22 @@ func (l *List) Pop(key Key) (*Object, error) {
 	return nil, ErrNotFound
 }
 
+// InsertFromReader inserts every resource in a stream of YAML documents
+// into the tree
 func InsertFromReader(tree Tree, r io.Reader) error {
+	return insertFromReader(tree, r, nil)
+}
+
+// InsertFromFile inserts every resource in a stream of YAML documents
+// read from a file into the tree. The origin of each resource is origin,
+// with the index of its document.
+func InsertFromFile(tree Tree, r io.Reader, origin Origin) error {
+	return insertFromReader(tree, r, &origin)
+}
+
+func insertFromReader(tree Tree, r io.Reader, origin *Origin) error {
 	d := yaml.NewDecoder(r)
-	for {
+	for index := 0; ; index++ {
 		var m map[string]any
 		if err := d.Decode(&m); err != nil {
 			if errors.Is(err, io.EOF) {
@@ -72,7 +92,13 @@ func InsertFromReader(tree Tree, r io.Reader) error {
 		if len(m) == 0 {
 			continue
 		}
-		if err := tree.Insert(Unstructured(m)); err != nil {
+		obj := Unstructured(m)
+		if origin != nil {
+			o := *origin
+			o.DocumentIndex = index
+			obj.SetOrigin(&o)
+		}
+		if err := tree.Insert(obj); err != nil {
 			return err
 		}
 	}
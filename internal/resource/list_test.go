@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"strings"
 	"testing"
 
 	qt "github.com/frankban/quicktest"
@@ -19,3 +20,46 @@ func TestList_Insert(t *testing.T) {
 	qt.Assert(t, l.Insert(n), qt.IsNil)
 	qt.Assert(t, l.objs, qt.HasLen, 1)
 }
+
+func TestInsertFromFile_Conflict(t *testing.T) {
+	const configMaps = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  port: "8080"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  port: "9090"
+`
+	for name, tree := range map[string]Tree{"Tree": NewTree(), "List": NewList()} {
+		t.Run(name, func(t *testing.T) {
+			err := InsertFromFile(tree, strings.NewReader(configMaps), Origin{
+				Path:       "base/configmap.yaml",
+				IncludedBy: []string{"base/dinghyfile.yaml"},
+			})
+			qt.Assert(t, err, qt.ErrorIs, ErrResourceConflict)
+
+			var conflict *ConflictError
+			qt.Assert(t, err, qt.ErrorAs, &conflict)
+			qt.Assert(t, conflict.Existing.DocumentIndex, qt.Equals, 0)
+			qt.Assert(t, conflict.Inserted.DocumentIndex, qt.Equals, 1)
+			qt.Assert(t, err, qt.ErrorMatches, `.*v1.ConfigMap/web is in both `+
+				`base/configmap.yaml \(document 0\) included by base/dinghyfile.yaml and `+
+				`base/configmap.yaml \(document 1\) included by base/dinghyfile.yaml`)
+		})
+	}
+}
+
+func TestList_Insert_Equal(t *testing.T) {
+	m := map[string]any{"apiVersion": "v1", "kind": "Pod", "metadata": map[string]any{"name": "foo"}}
+	l := NewList()
+	qt.Assert(t, l.Insert(Unstructured(m)), qt.IsNil)
+	qt.Assert(t, l.Insert(Unstructured(m)), qt.IsNil)
+	qt.Assert(t, l.objs, qt.HasLen, 1)
+}
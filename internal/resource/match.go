@@ -1,86 +1,254 @@
 package resource
 
 import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
-// MatchKinds limits a match query to just the provided kinds.
-// MatchKinds doesn't replace the existing kinds on matchOptions,
-// so multiple MatchKinds options can be used together.
+// Any matches any group, version, kind, name or namespace
+const Any = "*"
+
+// MatchKinds limits a match query to just the provided kinds. A group,
+// version or kind of Any matches every value, and an empty group is the
+// core group. MatchKinds doesn't replace the existing kinds on the
+// selector, so multiple MatchKinds options can be used together.
 // Map.Matches(MatchKinds("Pod"), MatchKinds("StatefulSet"))
 func MatchKinds(kinds ...schema.GroupVersionKind) MatchOption {
-	return func(o *matchOptions) {
-		if len(kinds) == 0 {
-			return
+	return func(s *Selector) {
+		s.kinds = append(s.kinds, kinds...)
+	}
+}
+
+// MatchNames limits a match query to the resources with any of the
+// names
+func MatchNames(names ...string) MatchOption {
+	return func(s *Selector) {
+		for _, name := range names {
+			s.names.Insert(strings.ToLower(name))
 		}
-		if o.kinds == nil {
-			o.kinds = sets.New[schema.GroupVersionKind]()
+	}
+}
+
+// MatchNamespaces limits a match query to the resources in any of the
+// namespaces. Cluster scoped resources have the namespace "".
+func MatchNamespaces(namespaces ...string) MatchOption {
+	return func(s *Selector) {
+		for _, namespace := range namespaces {
+			s.namespaces.Insert(strings.ToLower(namespace))
 		}
-		o.kinds.Insert(kinds...)
 	}
 }
 
-func MatchNames(names ...string) MatchOption {
-	return func(o *matchOptions) {
-		if len(names) == 0 {
+// MatchLabels matches the resources with every label
+func MatchLabels(l map[string]string) MatchOption {
+	return func(s *Selector) {
+		if len(l) == 0 {
 			return
 		}
-		if o.names == nil {
-			o.names = sets.New[string]()
+		s.labels = append(s.labels, labels.SelectorFromSet(l))
+	}
+}
+
+// MatchAnnotations matches the resources with every annotation
+func MatchAnnotations(annotations map[string]string) MatchOption {
+	return func(s *Selector) {
+		if len(annotations) == 0 {
+			return
 		}
-		o.names.Insert(names...)
+		s.annotations = append(s.annotations, labels.SelectorFromSet(annotations))
 	}
 }
 
-func MatchNamespaces(namespaces ...string) MatchOption {
-	return func(o *matchOptions) {
-		if len(namespaces) == 0 {
+// MatchNamePatterns matches the resources with a name matched by any of
+// the patterns, or by MatchNames. Patterns aren't anchored, so a pattern
+// that must match the whole name should start with ^ and end with $.
+func MatchNamePatterns(patterns ...*regexp.Regexp) MatchOption {
+	return func(s *Selector) {
+		s.namePatterns = append(s.namePatterns, patterns...)
+	}
+}
+
+// MatchLabelSelector matches the resources with labels matched by the
+// selector, which can have set based requirements such as
+// `tier in (web, api)` or `!sidecar.dinghy.dev/skip`
+func MatchLabelSelector(selector labels.Selector) MatchOption {
+	return func(s *Selector) {
+		if selector == nil || selector.Empty() {
 			return
 		}
-		if o.namespaces == nil {
-			o.namespaces = sets.New[string]()
+		s.labels = append(s.labels, selector)
+	}
+}
+
+// MatchAnnotationSelector matches the resources with annotations matched
+// by the selector
+func MatchAnnotationSelector(selector labels.Selector) MatchOption {
+	return func(s *Selector) {
+		if selector == nil || selector.Empty() {
+			return
 		}
-		o.names.Insert(namespaces...)
+		s.annotations = append(s.annotations, selector)
 	}
 }
 
-func MatchLabels(labels map[string]string) MatchOption {
-	return func(o *matchOptions) {
-		if len(labels) == 0 {
+// MatchScope matches the resources with the scope. Kinds are cluster
+// scoped if they're listed in scope.yaml, or defined by a
+// CustomResourceDefinition in the tree that's visited.
+func MatchScope(scope Scope) MatchOption {
+	return func(s *Selector) {
+		s.scope = scope
+	}
+}
+
+// MatchExclude skips the resources that match every option in opts.
+// Multiple MatchExclude options skip the resources matched by any of them.
+func MatchExclude(opts ...MatchOption) MatchOption {
+	return func(s *Selector) {
+		if len(opts) == 0 {
 			return
 		}
-		if o.matchLabels == nil {
-			o.matchLabels = make(map[string]string)
+		s.exclude = append(s.exclude, NewSelector(opts...))
+	}
+}
+
+// A MatchOption is used to limit the set of resources
+// returned by a Map.Matches query.
+type MatchOption func(s *Selector)
+
+// Selector selects resources by kind, name, namespace, labels,
+// annotations and scope. A resource is selected if it matches every
+// field that's set, and fields that aren't set match every resource.
+// Kinds, names and namespaces aren't case-sensitive.
+type Selector struct {
+	kinds        []schema.GroupVersionKind
+	names        sets.Set[string]
+	namePatterns []*regexp.Regexp
+	namespaces   sets.Set[string]
+	labels       []labels.Selector
+	annotations  []labels.Selector
+	scope        Scope
+	exclude      []*Selector
+}
+
+// NewSelector returns the selector of the options
+func NewSelector(opts ...MatchOption) *Selector {
+	s := &Selector{
+		names:      sets.New[string](),
+		namespaces: sets.New[string](),
+	}
+	for _, f := range opts {
+		f(s)
+	}
+	return s
+}
+
+// Matches reports whether the selector matches obj. clusterScoped are the
+// cluster scoped kinds, written as GroupKind.String(), and are only read
+// if the selector matches a scope.
+func (s *Selector) Matches(obj *Object, clusterScoped sets.Set[string]) bool {
+	if !s.matchesKind(obj.GroupVersionKind()) || !s.matchesName(obj.GetName()) {
+		return false
+	}
+	if s.namespaces.Len() > 0 && !s.namespaces.HasAny(Any, strings.ToLower(obj.GetNamespace())) {
+		return false
+	}
+	for _, selector := range s.labels {
+		if !selector.Matches(labels.Set(obj.GetLabels())) {
+			return false
 		}
-		for key, value := range labels {
-			o.matchLabels[key] = value
+	}
+	for _, selector := range s.annotations {
+		if !selector.Matches(labels.Set(obj.GetAnnotations())) {
+			return false
 		}
 	}
+	if s.scope != "" && scopeOf(obj, clusterScoped) != s.scope {
+		return false
+	}
+	for _, exclude := range s.exclude {
+		if exclude.Matches(obj, clusterScoped) {
+			return false
+		}
+	}
+	return true
 }
 
-func MatchAnnotations(annotations map[string]string) MatchOption {
-	return func(o *matchOptions) {
-		if len(annotations) == 0 {
-			return
+func (s *Selector) matchesKind(gvk schema.GroupVersionKind) bool {
+	if len(s.kinds) == 0 {
+		return true
+	}
+	for _, kind := range s.kinds {
+		if matchesPart(kind.Group, gvk.Group) && matchesPart(kind.Version, gvk.Version) &&
+			matchesPart(kind.Kind, gvk.Kind) {
+			return true
 		}
-		if o.matchAnnotations == nil {
-			o.matchAnnotations = make(map[string]string)
+	}
+	return false
+}
+
+func (s *Selector) matchesName(name string) bool {
+	if s.names.Len() == 0 && len(s.namePatterns) == 0 {
+		return true
+	}
+	if s.names.HasAny(Any, strings.ToLower(name)) {
+		return true
+	}
+	for _, pattern := range s.namePatterns {
+		if pattern.MatchString(name) {
+			return true
 		}
-		for key, value := range annotations {
-			o.matchLabels[key] = value
+	}
+	return false
+}
+
+func matchesPart(want, got string) bool {
+	return want == Any || strings.EqualFold(want, got)
+}
+
+// scopes returns the cluster scoped kinds of tree if the selector, or any
+// of its exclusions, matches a scope
+func (s *Selector) scopes(tree Tree) (sets.Set[string], error) {
+	if !s.matchesScope() {
+		return nil, nil
+	}
+	return ClusterScopedKinds(tree)
+}
+
+func (s *Selector) matchesScope() bool {
+	if s.scope != "" {
+		return true
+	}
+	for _, exclude := range s.exclude {
+		if exclude.matchesScope() {
+			return true
 		}
 	}
+	return false
 }
 
-// A MatchOption is used to limit the set of resources
-// returned by a Map.Matches query.
-type MatchOption func(o *matchOptions)
-
-type matchOptions struct {
-	kinds            sets.Set[schema.GroupVersionKind]
-	names            sets.Set[string]
-	namespaces       sets.Set[string]
-	matchLabels      map[string]string
-	matchAnnotations map[string]string
+// ParseKind parses a kind selector, which is either Kind, group/Kind
+// or group/version/Kind. Omitted parts match any value, and so do parts
+// that are Any. The core group is written as an empty group, e.g. /v1/Pod.
+func ParseKind(kind string) (schema.GroupVersionKind, error) {
+	parts := strings.Split(kind, "/")
+	var gvk schema.GroupVersionKind
+	switch len(parts) {
+	case 1:
+		gvk = schema.GroupVersionKind{Group: Any, Version: Any, Kind: parts[0]}
+	case 2:
+		gvk = schema.GroupVersionKind{Group: parts[0], Version: Any, Kind: parts[1]}
+	case 3:
+		gvk = schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}
+	default:
+		return gvk, errors.Errorf("%q must be Kind, group/Kind or group/version/Kind", kind)
+	}
+	if gvk.Kind == "" || gvk.Version == "" {
+		return gvk, errors.Errorf("%q must be Kind, group/Kind or group/version/Kind", kind)
+	}
+	return gvk, nil
 }
@@ -0,0 +1,270 @@
+package resource
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMatchOptions(t *testing.T) {
+	objs := []map[string]any{
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]any{
+				"name":        "web",
+				"namespace":   "app",
+				"labels":      map[string]any{"tier": "web"},
+				"annotations": map[string]any{"team": "platform"},
+			},
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]any{
+				"name":      "web-api",
+				"namespace": "app",
+				"labels":    map[string]any{"tier": "api", "sidecar.dinghy.dev/skip": "true"},
+			},
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "worker", "namespace": "jobs"},
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"metadata":   map[string]any{"name": "web"},
+		},
+		{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]any{"name": "widgets.example.com"},
+			"spec": map[string]any{
+				"group": "example.com",
+				"scope": "Cluster",
+				"names": map[string]any{"kind": "Widget"},
+			},
+		},
+		{
+			"apiVersion": "example.com/v1",
+			"kind":       "Widget",
+			"metadata":   map[string]any{"name": "web"},
+		},
+	}
+	mustParse := func(selector string) labels.Selector {
+		s, err := labels.Parse(selector)
+		qt.Assert(t, err, qt.IsNil)
+		return s
+	}
+	deployments := MatchKinds(schema.GroupVersionKind{Group: "apps", Version: "*", Kind: "Deployment"})
+
+	tests := map[string]struct {
+		options []MatchOption
+		want    []string
+		// tree is set if the resources only match in a tree, since
+		// Object.Matches doesn't know the scope of custom resources
+		tree bool
+	}{
+		"MatchAnnotations": {
+			options: []MatchOption{MatchAnnotations(map[string]string{"team": "platform"})},
+			want:    []string{"apps.v1.Deployment/app/web"},
+		},
+		"MatchNamePatterns": {
+			options: []MatchOption{MatchNamePatterns(regexp.MustCompile("^web-.*$"))},
+			want:    []string{"apps.v1.Deployment/app/web-api"},
+		},
+		"MatchNamePatternsOrNames": {
+			options: []MatchOption{
+				deployments,
+				MatchNames("worker"),
+				MatchNamePatterns(regexp.MustCompile("^web-.*$")),
+			},
+			want: []string{"apps.v1.Deployment/app/web-api", "apps.v1.Deployment/jobs/worker"},
+		},
+		"MatchLabelSelectorIn": {
+			options: []MatchOption{MatchLabelSelector(mustParse("tier in (web, api)"))},
+			want:    []string{"apps.v1.Deployment/app/web", "apps.v1.Deployment/app/web-api"},
+		},
+		"MatchLabelSelectorDoesNotExist": {
+			options: []MatchOption{deployments, MatchLabelSelector(mustParse("!tier"))},
+			want:    []string{"apps.v1.Deployment/jobs/worker"},
+		},
+		"MatchAnnotationSelector": {
+			options: []MatchOption{deployments, MatchAnnotationSelector(mustParse("team notin (platform)"))},
+			want:    []string{"apps.v1.Deployment/app/web-api", "apps.v1.Deployment/jobs/worker"},
+		},
+		"MatchExclude": {
+			options: []MatchOption{
+				deployments,
+				MatchExclude(MatchLabelSelector(mustParse("sidecar.dinghy.dev/skip"))),
+				MatchExclude(MatchNamespaces("jobs")),
+			},
+			want: []string{"apps.v1.Deployment/app/web"},
+		},
+		"MatchScopeNamespaced": {
+			options: []MatchOption{MatchNames("web"), MatchScope(ScopeNamespaced)},
+			want:    []string{"apps.v1.Deployment/app/web"},
+			tree:    true,
+		},
+		"MatchScopeCluster": {
+			options: []MatchOption{MatchScope(ScopeCluster)},
+			want: []string{
+				"apiextensions.k8s.io.v1.CustomResourceDefinition/widgets.example.com",
+				"example.com.v1.Widget/web",
+				"rbac.authorization.k8s.io.v1.ClusterRole/web",
+			},
+			tree: true,
+		},
+	}
+	visit := func(t *testing.T, tree Tree, opts []MatchOption) []string {
+		got := make([]string, 0)
+		qt.Assert(t, tree.Visit(VisitorFunc(func(obj *Object) error {
+			got = append(got, newResourceKey(obj).String())
+			return nil
+		}), opts...), qt.IsNil)
+		sort.Strings(got)
+		return got
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tree, list := NewTree(), NewList()
+			for _, obj := range objs {
+				qt.Assert(t, tree.Insert(Unstructured(obj)), qt.IsNil)
+				qt.Assert(t, list.Insert(Unstructured(obj)), qt.IsNil)
+			}
+			qt.Assert(t, visit(t, tree, tt.options), qt.DeepEquals, tt.want)
+			qt.Assert(t, visit(t, list, tt.options), qt.DeepEquals, tt.want)
+			if tt.tree {
+				return
+			}
+			got := make([]string, 0)
+			for _, obj := range objs {
+				if o := Unstructured(obj); o.Matches(tt.options...) {
+					got = append(got, newResourceKey(o).String())
+				}
+			}
+			sort.Strings(got)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	deployment := Unstructured(map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":        "web",
+			"namespace":   "app",
+			"labels":      map[string]any{"tier": "web"},
+			"annotations": map[string]any{"team": "platform"},
+		},
+	})
+	configMap := Unstructured(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "web-config", "namespace": "app"},
+	})
+	clusterRole := Unstructured(map[string]any{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "ClusterRole",
+		"metadata":   map[string]any{"name": "web"},
+	})
+	kind := func(s string) MatchOption {
+		gvk, err := ParseKind(s)
+		qt.Assert(t, err, qt.IsNil)
+		return MatchKinds(gvk)
+	}
+	parse := func(s string) labels.Selector {
+		selector, err := labels.Parse(s)
+		qt.Assert(t, err, qt.IsNil)
+		return selector
+	}
+
+	tests := map[string]struct {
+		options []MatchOption
+		obj     *Object
+		want    bool
+	}{
+		"Empty":                     {obj: deployment, want: true},
+		"Kind":                      {options: []MatchOption{kind("Deployment")}, obj: deployment, want: true},
+		"KindCaseInsensitive":       {options: []MatchOption{kind("deployment")}, obj: deployment, want: true},
+		"KindOtherKind":             {options: []MatchOption{kind("StatefulSet")}, obj: deployment},
+		"GroupKind":                 {options: []MatchOption{kind("apps/Deployment")}, obj: deployment, want: true},
+		"GroupKindOtherGroup":       {options: []MatchOption{kind("extensions/Deployment")}, obj: deployment},
+		"GroupVersionKind":          {options: []MatchOption{kind("apps/v1/Deployment")}, obj: deployment, want: true},
+		"GroupVersionKindOther":     {options: []MatchOption{kind("apps/v1beta1/Deployment")}, obj: deployment},
+		"CoreGroup":                 {options: []MatchOption{kind("/ConfigMap")}, obj: configMap, want: true},
+		"CoreGroupOtherGroup":       {options: []MatchOption{kind("/Deployment")}, obj: deployment},
+		"AnyKind":                   {options: []MatchOption{kind("apps/*")}, obj: deployment, want: true},
+		"AnyOfKinds":                {options: []MatchOption{kind("ConfigMap"), kind("Deployment")}, obj: deployment, want: true},
+		"Name":                      {options: []MatchOption{MatchNames("web")}, obj: deployment, want: true},
+		"NameOtherName":             {options: []MatchOption{MatchNames("api")}, obj: deployment},
+		"AnyName":                   {options: []MatchOption{MatchNames(Any)}, obj: deployment, want: true},
+		"NamePattern":               {options: []MatchOption{MatchNamePatterns(regexp.MustCompile("^web-"))}, obj: configMap, want: true},
+		"NamePatternNoMatch":        {options: []MatchOption{MatchNamePatterns(regexp.MustCompile("^web-"))}, obj: deployment},
+		"NameOrNamePattern":         {options: []MatchOption{MatchNames("web"), MatchNamePatterns(regexp.MustCompile("^api-"))}, obj: deployment, want: true},
+		"Namespace":                 {options: []MatchOption{MatchNamespaces("app")}, obj: deployment, want: true},
+		"NamespaceIsNotName":        {options: []MatchOption{MatchNamespaces("web")}, obj: deployment},
+		"NamespaceClusterScoped":    {options: []MatchOption{MatchNamespaces("")}, obj: clusterRole, want: true},
+		"NamespaceOtherNamespace":   {options: []MatchOption{MatchNamespaces("other")}, obj: deployment},
+		"Labels":                    {options: []MatchOption{MatchLabels(map[string]string{"tier": "web"})}, obj: deployment, want: true},
+		"LabelsOtherValue":          {options: []MatchOption{MatchLabels(map[string]string{"tier": "api"})}, obj: deployment},
+		"LabelsAreNotAnnotations":   {options: []MatchOption{MatchLabels(map[string]string{"team": "platform"})}, obj: deployment},
+		"Annotations":               {options: []MatchOption{MatchAnnotations(map[string]string{"team": "platform"})}, obj: deployment, want: true},
+		"AnnotationsAreNotLabels":   {options: []MatchOption{MatchAnnotations(map[string]string{"tier": "web"})}, obj: deployment},
+		"LabelSelectorIn":           {options: []MatchOption{MatchLabelSelector(parse("tier in (web,api)"))}, obj: deployment, want: true},
+		"LabelSelectorNotIn":        {options: []MatchOption{MatchLabelSelector(parse("tier notin (web)"))}, obj: deployment},
+		"LabelSelectorExists":       {options: []MatchOption{MatchLabelSelector(parse("tier"))}, obj: deployment, want: true},
+		"LabelSelectorDoesNotExist": {options: []MatchOption{MatchLabelSelector(parse("!tier"))}, obj: deployment},
+		"AnnotationSelector":        {options: []MatchOption{MatchAnnotationSelector(parse("team=platform"))}, obj: deployment, want: true},
+		"ScopeNamespaced":           {options: []MatchOption{MatchScope(ScopeNamespaced)}, obj: deployment, want: true},
+		"ScopeCluster":              {options: []MatchOption{MatchScope(ScopeCluster)}, obj: clusterRole, want: true},
+		"ScopeOtherScope":           {options: []MatchOption{MatchScope(ScopeCluster)}, obj: deployment},
+		"Exclude":                   {options: []MatchOption{MatchExclude(MatchNamespaces("app"))}, obj: deployment},
+		"ExcludeNoMatch":            {options: []MatchOption{MatchExclude(MatchNamespaces("other"))}, obj: deployment, want: true},
+		"ExcludeEveryOption":        {options: []MatchOption{MatchExclude(MatchNamespaces("app"), kind("ConfigMap"))}, obj: deployment, want: true},
+		"EveryOption":               {options: []MatchOption{kind("Deployment"), MatchNames("web"), MatchNamespaces("other")}, obj: deployment},
+	}
+	clusterScoped, err := ClusterScopedKinds(nil)
+	qt.Assert(t, err, qt.IsNil)
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			qt.Assert(t, NewSelector(tt.options...).Matches(tt.obj, clusterScoped), qt.Equals, tt.want)
+		})
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	tests := map[string]struct {
+		kind string
+		want schema.GroupVersionKind
+		err  string
+	}{
+		"Kind":             {kind: "Deployment", want: schema.GroupVersionKind{Group: Any, Version: Any, Kind: "Deployment"}},
+		"GroupKind":        {kind: "apps/Deployment", want: schema.GroupVersionKind{Group: "apps", Version: Any, Kind: "Deployment"}},
+		"GroupVersionKind": {kind: "apps/v1/Deployment", want: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}},
+		"CoreGroup":        {kind: "/v1/ConfigMap", want: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}},
+		"Empty":            {kind: "", err: `"" must be Kind, group/Kind or group/version/Kind`},
+		"EmptyKind":        {kind: "apps/", err: `"apps/" must be .*`},
+		"EmptyVersion":     {kind: "apps//Deployment", err: `"apps//Deployment" must be .*`},
+		"TooManyParts":     {kind: "apps/v1/Deployment/scale", err: `"apps/v1/Deployment/scale" must be .*`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			gvk, err := ParseKind(tt.kind)
+			if tt.err != "" {
+				qt.Assert(t, err, qt.ErrorMatches, tt.err)
+				return
+			}
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, gvk, qt.Equals, tt.want)
+		})
+	}
+}
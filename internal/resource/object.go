@@ -5,20 +5,21 @@ import (
 	"github.com/imdario/mergo"
 	"github.com/johnhoman/dinghy/internal/errors"
 	"reflect"
+	"strings"
 	"sync"
 
 	jsonpatch "github.com/evanphx/json-patch"
-	"github.com/google/go-cmp/cmp"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v3"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 
 	"github.com/johnhoman/dinghy/internal/fieldpath"
 	"github.com/johnhoman/dinghy/internal/scheme"
 )
 
-type Event struct{}
-
 type Trackable interface {
 	Record(event Event)
 }
@@ -34,29 +35,22 @@ func (f VisitorFunc) Visit(obj *Object) error { return f(obj) }
 type Option func(o *Object)
 
 func Unstructured(m map[string]any) *Object {
-	o := &Object{
+	return &Object{
 		Unstructured: &unstructured.Unstructured{Object: m},
 		mu:           sync.RWMutex{},
 		events:       make([]Event, 0),
 	}
-	gvk := o.GroupVersionKind()
-	o.matchKeys = []schema.GroupVersionKind{
-		{Group: "*", Version: "*", Kind: "*"},
-		{Group: "*", Version: "*", Kind: gvk.Kind},
-		{Group: "*", Version: gvk.Version, Kind: "*"},
-		{Group: "*", Version: gvk.Version, Kind: gvk.Kind},
-		{Group: gvk.Group, Version: "*", Kind: "*"},
-		{Group: gvk.Group, Version: "*", Kind: gvk.Kind},
-		{Group: gvk.Group, Version: gvk.Version, Kind: "*"},
-		{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
-	}
-	return o
 }
 
 type Object struct {
 	*unstructured.Unstructured
-	matchKeys []schema.GroupVersionKind
-	mu        sync.RWMutex
+	mu sync.RWMutex
+	// sequence is the order the resource was first inserted into a tree
+	// or list, and is 0 until it is
+	sequence int64
+	// origin is where the resource was read from or generated, if it's
+	// known
+	origin *Origin
 
 	events []Event
 }
@@ -81,25 +75,79 @@ func (o *Object) HasAnnotations(annotations map[string]string) bool {
 	return true
 }
 
+// Matches reports whether the resource is matched by every option. Only
+// the builtin cluster scoped kinds are known to MatchScope, since there's
+// no tree to read CustomResourceDefinitions from.
 func (o *Object) Matches(opts ...MatchOption) bool {
-	if len(opts) == 0 {
-		return true
-	}
-	opt := newOptions(opts...)
-	if opt.kinds.HasAny(o.matchKeys...) && opt.names.HasAny("*", o.GetName()) && opt.namespaces.HasAny(o.GetNamespace(), "*") {
-		if len(opt.matchLabels) == 0 || o.HasLabels(opt.matchLabels) {
-			if len(opt.matchAnnotations) == 0 || o.HasAnnotations(opt.matchAnnotations) {
-				return true
-			}
+	return NewSelector(opts...).Matches(o, sets.New[string](clusterScoped...))
+}
+
+// Copy returns a deep copy of the resource. Unlike DeepCopy, Copy
+// doesn't panic on values that aren't valid JSON types, such as the
+// ints decoded from YAML. The copy keeps the insertion order, the origin
+// and the events of the resource.
+func (o *Object) Copy() *Object {
+	m, _ := copyValue(o.Object).(map[string]any)
+	c := Unstructured(m)
+	c.sequence = o.sequence
+	c.origin = o.origin
+	c.events = append(c.events, o.events...)
+	return c
+}
+
+func copyValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for key, value := range t {
+			m[key] = copyValue(value)
+		}
+		return m
+	case []any:
+		s := make([]any, len(t))
+		for k, value := range t {
+			s[k] = copyValue(value)
 		}
+		return s
+	default:
+		return v
 	}
-	return false
 }
 
+// Diff returns a unified diff of the YAML of o and o2, with 3 lines of
+// context, or "" if they're equal. Either object can be nil, so added and
+// removed resources are diffed against /dev/null.
 func (o *Object) Diff(o2 *Object) string {
-	return cmp.Diff(o.Object, o2.Object)
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        o.diffLines(),
+		B:        o2.diffLines(),
+		FromFile: o.diffName("a/"),
+		ToFile:   o2.diffName("b/"),
+		Context:  3,
+	})
+	return diff
 }
 
+func (o *Object) diffName(prefix string) string {
+	if o == nil {
+		return "/dev/null"
+	}
+	return prefix + newResourceKey(o).String()
+}
+
+func (o *Object) diffLines() []string {
+	if o == nil {
+		return nil
+	}
+	data, err := yaml.Marshal(o.Object)
+	if err != nil {
+		return []string{err.Error() + "\n"}
+	}
+	return difflib.SplitLines(strings.TrimSuffix(string(data), "\n"))
+}
+
+// Equals reports whether two resources have the same content. Bookkeeping,
+// such as the origin, the events and the insertion order, isn't compared.
 func (o *Object) Equals(o2 *Object) bool {
 	return reflect.DeepEqual(o.Object, o2.Object)
 }
@@ -138,11 +186,35 @@ func (o *Object) SetNameSuffix(fix string) {
 	o.SetName(o.GetName() + fix)
 }
 
-func (o *Object) StrategicMergePatch(patch map[string]any) error {
+// PatchSchema looks up the strategic merge patch metadata of kinds that
+// aren't registered with the scheme, such as custom resources
+type PatchSchema interface {
+	LookupPatchMeta(gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, bool)
+}
+
+// StrategicMergePatch applies a strategic merge patch to the resource.
+// Merge keys are read from the type registered with the scheme, or from
+// the first of the schemas that has the kind.
+func (o *Object) StrategicMergePatch(patch map[string]any, schemas ...PatchSchema) error {
+	var lookup strategicpatch.LookupPatchMeta
 	// structs registered with the scheme will have
 	// the strategicMergePatch tags defined on the struct
-	d, err := scheme.Scheme.New(o.GroupVersionKind())
-	if err != nil {
+	if d, err := scheme.Scheme.New(o.GroupVersionKind()); err == nil {
+		meta, err := strategicpatch.NewPatchMetaFromStruct(d)
+		if err != nil {
+			return err
+		}
+		lookup = meta
+	}
+	for _, s := range schemas {
+		if lookup != nil || s == nil {
+			break
+		}
+		if meta, ok := s.LookupPatchMeta(o.GroupVersionKind()); ok {
+			lookup = meta
+		}
+	}
+	if lookup == nil {
 		return &errors.ErrPatchStrategicMergeUnregisteredSchema{
 			GroupVersionKind: o.GroupVersionKind(),
 			Name:             o.GetName(),
@@ -151,8 +223,7 @@ func (o *Object) StrategicMergePatch(patch map[string]any) error {
 		}
 	}
 
-	// I'll need to write this logic myself
-	obj, err := strategicpatch.StrategicMergeMapPatch(o.UnstructuredContent(), patch, d)
+	obj, err := strategicpatch.StrategicMergeMapPatchUsingLookupPatchMeta(o.UnstructuredContent(), patch, lookup)
 	if err != nil {
 		return &errors.ErrPatchStrategicMerge{
 			GroupVersionKind: o.GroupVersionKind(),
@@ -205,3 +276,9 @@ func (o *Object) JSONPatch(patch jsonpatch.Patch) error {
 func (o *Object) Record(event Event) {
 	o.events = append(o.events, event)
 }
+
+// Events returns the events recorded on the resource, in the order they
+// were recorded
+func (o *Object) Events() []Event {
+	return append([]Event(nil), o.events...)
+}
@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OriginAnnotation is the annotation that records the Origin of a
+// resource, when a build adds origin annotations
+const OriginAnnotation = "dinghy.dev/origin"
+
+// Origin is where a resource came from. Resources are either read from a
+// file, or emitted by a generator.
+type Origin struct {
+	// Path is the file the resource was read from. Files in a GitHub
+	// repository are relative to the root of the repository.
+	Path string `yaml:"path,omitempty"`
+	// Repo is the URL of the repository of a remote file
+	Repo string `yaml:"repo,omitempty"`
+	// Ref is the ref of the repository, or empty for the default branch
+	Ref string `yaml:"ref,omitempty"`
+	// DocumentIndex is the index of the resource in the stream of YAML
+	// documents in the file, starting at 0
+	DocumentIndex int `yaml:"documentIndex,omitempty"`
+	// ConfiguredIn is the dinghyfile of the generator that emitted the
+	// resource
+	ConfiguredIn string `yaml:"configuredIn,omitempty"`
+	// ConfiguredBy is the plugin of the generator that emitted the
+	// resource
+	ConfiguredBy string `yaml:"configuredBy,omitempty"`
+	// IncludedBy are the dinghyfiles that included the resource, starting
+	// with the one that read the file
+	IncludedBy []string `yaml:"includedBy,omitempty"`
+}
+
+// String describes the origin, e.g.
+// `base/configmap.yaml (document 1) included by base/dinghyfile.yaml, dinghyfile.yaml`
+func (o *Origin) String() string {
+	if o == nil {
+		return "an unknown source"
+	}
+	b := new(strings.Builder)
+	if o.Path != "" {
+		if o.Repo != "" {
+			b.WriteString(o.Repo + "/")
+		}
+		b.WriteString(o.Path)
+		if o.Ref != "" {
+			b.WriteString("?ref=" + o.Ref)
+		}
+		fmt.Fprintf(b, " (document %d)", o.DocumentIndex)
+	} else {
+		fmt.Fprintf(b, "%s in %s", o.ConfiguredBy, o.ConfiguredIn)
+	}
+	if len(o.IncludedBy) > 0 {
+		fmt.Fprintf(b, " included by %s", strings.Join(o.IncludedBy, ", "))
+	}
+	return b.String()
+}
+
+// Origin returns where the resource came from, or nil if it isn't known
+func (o *Object) Origin() *Origin {
+	return o.origin
+}
+
+// SetOrigin sets where the resource came from
+func (o *Object) SetOrigin(origin *Origin) {
+	o.origin = origin
+}
+
+// ConflictError is returned when a resource is inserted into a tree that
+// already has a different resource with the same key. It names the
+// origins of both resources.
+type ConflictError struct {
+	Key Key
+	// Existing is the origin of the resource that's in the tree
+	Existing *Origin
+	// Inserted is the origin of the resource that was inserted
+	Inserted *Origin
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s is in both %s and %s", ErrResourceConflict, e.Key.String(), e.Existing, e.Inserted)
+}
+
+// Unwrap returns ErrResourceConflict
+func (e *ConflictError) Unwrap() error {
+	return ErrResourceConflict
+}
+
+func conflictError(existing, inserted *Object) error {
+	return &ConflictError{
+		Key:      newResourceKey(inserted),
+		Existing: existing.origin,
+		Inserted: inserted.origin,
+	}
+}
@@ -0,0 +1,70 @@
+package resource
+
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
+// podSpecPaths are the locations of the pod spec for each of the builtin
+// workload kinds
+var podSpecPaths = map[schema.GroupKind][]string{
+	{Group: "", Kind: "Pod"}:                   {"spec"},
+	{Group: "", Kind: "PodTemplate"}:           {"template", "spec"},
+	{Group: "", Kind: "ReplicationController"}: {"spec", "template", "spec"},
+	{Group: "apps", Kind: "Deployment"}:        {"spec", "template", "spec"},
+	{Group: "apps", Kind: "ReplicaSet"}:        {"spec", "template", "spec"},
+	{Group: "apps", Kind: "StatefulSet"}:       {"spec", "template", "spec"},
+	{Group: "apps", Kind: "DaemonSet"}:         {"spec", "template", "spec"},
+	{Group: "batch", Kind: "Job"}:              {"spec", "template", "spec"},
+	{Group: "batch", Kind: "CronJob"}:          {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// ContainerFields are the fields of a pod spec that hold containers
+var ContainerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// PodSpecPath returns the field path to the pod spec of the provided kind. If
+// the kind doesn't embed a pod spec, false is returned.
+func PodSpecPath(gk schema.GroupKind) ([]string, bool) {
+	p, ok := podSpecPaths[gk]
+	return p, ok
+}
+
+// PodSpec returns the pod spec of a workload resource. If the resource isn't a
+// known workload kind or the pod spec isn't set, false is returned.
+func (o *Object) PodSpec() (map[string]any, bool) {
+	p, ok := PodSpecPath(o.GroupVersionKind().GroupKind())
+	if !ok {
+		return nil, false
+	}
+	// unstructured.NestedMap returns a copy, so walk the resource to get
+	// a reference to the underlying map
+	m := o.Object
+	for _, field := range p {
+		next, ok := m[field].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	return m, true
+}
+
+// Containers returns every container defined in the pod spec, including
+// init and ephemeral containers. The returned maps reference the
+// containers in the resource, so changes to them change the resource.
+func (o *Object) Containers() []map[string]any {
+	spec, ok := o.PodSpec()
+	if !ok {
+		return nil
+	}
+	rv := make([]map[string]any, 0)
+	for _, field := range ContainerFields {
+		items, ok := spec[field].([]any)
+		if !ok {
+			continue
+		}
+		for _, item := range items {
+			if c, ok := item.(map[string]any); ok {
+				rv = append(rv, c)
+			}
+		}
+	}
+	return rv
+}
@@ -0,0 +1,65 @@
+package resource
+
+import (
+	_ "embed"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Scope is whether the resources of a kind are namespaced, or cluster
+// scoped
+type Scope string
+
+const (
+	ScopeNamespaced Scope = "Namespaced"
+	ScopeCluster    Scope = "Cluster"
+)
+
+// ClusterScopedKinds returns the cluster scoped kinds, written as
+// GroupKind.String(), including the custom resources defined by the
+// CustomResourceDefinitions in tree. tree can be nil, in which case only
+// the builtin kinds are returned.
+func ClusterScopedKinds(tree Tree) (sets.Set[string], error) {
+	kinds := sets.New[string](clusterScoped...)
+	if tree == nil {
+		return kinds, nil
+	}
+	err := tree.Visit(VisitorFunc(func(crd *Object) error {
+		gvk := crd.GroupVersionKind()
+		if gvk.Group != "apiextensions.k8s.io" || gvk.Kind != "CustomResourceDefinition" {
+			return nil
+		}
+		scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		if Scope(scope) == ScopeCluster {
+			kinds.Insert(schema.GroupKind{Group: group, Kind: kind}.String())
+		}
+		return nil
+	}))
+	return kinds, err
+}
+
+// scopeOf returns the scope of obj, given the cluster scoped kinds
+func scopeOf(obj *Object, clusterScoped sets.Set[string]) Scope {
+	if clusterScoped.Has(obj.GroupVersionKind().GroupKind().String()) {
+		return ScopeCluster
+	}
+	return ScopeNamespaced
+}
+
+var (
+	//go:embed scope.yaml
+	clusterScopedContent []byte
+	clusterScoped        []string
+)
+
+func init() {
+	if err := yaml.Unmarshal(clusterScopedContent, &clusterScoped); err != nil {
+		panic(errors.Wrap(err, "failed to unmarshal cluster scoped kinds"))
+	}
+}
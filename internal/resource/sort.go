@@ -0,0 +1,114 @@
+package resource
+
+import (
+	_ "embed"
+	"sort"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SortOrder is the order resources are written in
+type SortOrder string
+
+const (
+	// SortLegacy sorts resources in apply order, so that Namespaces and
+	// CustomResourceDefinitions come before the resources that need them,
+	// and webhooks come last. Resources of the same rank are sorted by
+	// apiVersion and kind, then by namespace and name.
+	SortLegacy SortOrder = "legacy"
+	// SortNone leaves resources in the order the tree visits them, which
+	// is by key
+	SortNone SortOrder = "none"
+	// SortFIFO sorts resources in the order they were first inserted into
+	// a tree or list, which is the order of the sources they were read
+	// from
+	SortFIFO SortOrder = "fifo"
+)
+
+// SortOrders are the supported sort orders
+var SortOrders = []SortOrder{SortLegacy, SortNone, SortFIFO}
+
+// sequence is the insertion order of the last resource inserted into a
+// tree or list
+var sequence atomic.Int64
+
+// Sorted returns every resource in the tree, sorted in order
+func Sorted(tree Tree, order SortOrder) ([]*Object, error) {
+	objs := make([]*Object, 0)
+	err := tree.Visit(VisitorFunc(func(obj *Object) error {
+		objs = append(objs, obj)
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return objs, Sort(objs, order)
+}
+
+// Sort sorts the resources in order. The sort is stable, so resources
+// that are equal in order keep their relative order.
+func Sort(objs []*Object, order SortOrder) error {
+	switch order {
+	case SortLegacy:
+		sort.SliceStable(objs, func(i, j int) bool {
+			return legacyLess(objs[i], objs[j])
+		})
+	case SortNone:
+	case SortFIFO:
+		sort.SliceStable(objs, func(i, j int) bool {
+			return objs[i].sequence < objs[j].sequence
+		})
+	default:
+		return errors.Errorf("unknown sort order %q, expected one of %v", order, SortOrders)
+	}
+	return nil
+}
+
+func legacyLess(a, b *Object) bool {
+	ga, gb := a.GroupVersionKind(), b.GroupVersionKind()
+	if ra, rb := kindOrder[ga.Kind], kindOrder[gb.Kind]; ra != rb {
+		return ra < rb
+	}
+	if ga.String() != gb.String() {
+		return ga.String() < gb.String()
+	}
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+	return a.GetName() < b.GetName()
+}
+
+// setSequence records the insertion order of obj the first time it's
+// inserted
+func setSequence(obj *Object) {
+	if obj.sequence == 0 {
+		obj.sequence = sequence.Add(1)
+	}
+}
+
+var (
+	//go:embed sort.yaml
+	kindOrderContent []byte
+	// kindOrder is the rank of each kind in the legacy sort order. Kinds
+	// that aren't listed have the rank 0.
+	kindOrder map[string]int
+)
+
+func init() {
+	var order struct {
+		First []string `yaml:"first"`
+		Last  []string `yaml:"last"`
+	}
+	if err := yaml.Unmarshal(kindOrderContent, &order); err != nil {
+		panic(errors.Wrap(err, "failed to unmarshal the sort order"))
+	}
+	kindOrder = make(map[string]int, len(order.First)+len(order.Last))
+	for k, kind := range order.First {
+		kindOrder[kind] = k - len(order.First)
+	}
+	for k, kind := range order.Last {
+		kindOrder[kind] = k + 1
+	}
+}
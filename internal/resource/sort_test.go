@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSort(t *testing.T) {
+	newObject := func(apiVersion, kind, namespace, name string) *Object {
+		return Unstructured(map[string]any{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]any{"name": name, "namespace": namespace},
+		})
+	}
+	// source is the order the resources are inserted in
+	source := []*Object{
+		newObject("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "", "validate"),
+		newObject("apps/v1", "Deployment", "b", "web"),
+		newObject("example.com/v1", "Widget", "a", "widget"),
+		newObject("apps/v1", "Deployment", "a", "web"),
+		newObject("v1", "Service", "a", "web"),
+		newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "widgets.example.com"),
+		newObject("apps/v1", "Deployment", "a", "api"),
+		newObject("v1", "Namespace", "", "a"),
+		newObject("admissionregistration.k8s.io/v1", "MutatingWebhookConfiguration", "", "mutate"),
+	}
+	tests := map[SortOrder][]string{
+		SortLegacy: {
+			"v1.Namespace/a",
+			"apiextensions.k8s.io.v1.CustomResourceDefinition/widgets.example.com",
+			"v1.Service/a/web",
+			"apps.v1.Deployment/a/api",
+			"apps.v1.Deployment/a/web",
+			"apps.v1.Deployment/b/web",
+			"example.com.v1.Widget/a/widget",
+			"admissionregistration.k8s.io.v1.MutatingWebhookConfiguration/mutate",
+			"admissionregistration.k8s.io.v1.ValidatingWebhookConfiguration/validate",
+		},
+		SortNone: {
+			"admissionregistration.k8s.io.v1.MutatingWebhookConfiguration/mutate",
+			"admissionregistration.k8s.io.v1.ValidatingWebhookConfiguration/validate",
+			"apiextensions.k8s.io.v1.CustomResourceDefinition/widgets.example.com",
+			"apps.v1.Deployment/a/api",
+			"apps.v1.Deployment/a/web",
+			"apps.v1.Deployment/b/web",
+			"example.com.v1.Widget/a/widget",
+			"v1.Namespace/a",
+			"v1.Service/a/web",
+		},
+		SortFIFO: {
+			"admissionregistration.k8s.io.v1.ValidatingWebhookConfiguration/validate",
+			"apps.v1.Deployment/b/web",
+			"example.com.v1.Widget/a/widget",
+			"apps.v1.Deployment/a/web",
+			"v1.Service/a/web",
+			"apiextensions.k8s.io.v1.CustomResourceDefinition/widgets.example.com",
+			"apps.v1.Deployment/a/api",
+			"v1.Namespace/a",
+			"admissionregistration.k8s.io.v1.MutatingWebhookConfiguration/mutate",
+		},
+	}
+	for order, want := range tests {
+		t.Run(string(order), func(t *testing.T) {
+			tree := NewTree()
+			for _, obj := range source {
+				qt.Assert(t, tree.Insert(obj.Copy()), qt.IsNil)
+			}
+			objs, err := Sorted(tree, order)
+			qt.Assert(t, err, qt.IsNil)
+			got := make([]string, 0, len(objs))
+			for _, obj := range objs {
+				got = append(got, newResourceKey(obj).String())
+			}
+			qt.Assert(t, got, qt.DeepEquals, want)
+		})
+	}
+}
+
+func TestSort_FIFOKeepsFirstInsertion(t *testing.T) {
+	a := Unstructured(map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "a"}})
+	b := Unstructured(map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "b"}})
+	list := NewList()
+	qt.Assert(t, list.Insert(b), qt.IsNil)
+	qt.Assert(t, list.Insert(a), qt.IsNil)
+
+	// copying into a tree, in any order, keeps the order of the list
+	tree := NewTree()
+	qt.Assert(t, CopyTree(tree, list), qt.IsNil)
+	objs, err := Sorted(tree, SortFIFO)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, objs, qt.HasLen, 2)
+	qt.Assert(t, objs[0] == b && objs[1] == a, qt.IsTrue)
+}
+
+func TestSort_UnknownOrder(t *testing.T) {
+	err := Sort(nil, "random")
+	qt.Assert(t, err, qt.ErrorMatches, `unknown sort order "random", expected one of \[legacy none fifo\]`)
+}
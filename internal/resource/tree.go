@@ -1,13 +1,11 @@
 package resource
 
 import (
-	goerr "errors"
-	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 var (
@@ -25,45 +23,61 @@ type treeNode struct {
 	obj   *Object
 }
 
+// Visit visits every resource matched by opts exactly once, in the order
+// of their keys. The matches are found before any of them are visited, so
+// resources that are re-keyed or inserted by the visitor aren't visited
+// again, and resources that are popped by the visitor aren't visited.
+// Visiting stops at the first error.
 func (tree *treeNode) Visit(visitor Visitor, opts ...MatchOption) error {
-	o := newOptions(opts...)
+	s := NewSelector(opts...)
+	clusterScoped, err := s.scopes(tree)
+	if err != nil {
+		return err
+	}
+	matches := make([]*Object, 0)
+	tree.walk(func(obj *Object) {
+		if s.Matches(obj, clusterScoped) {
+			matches = append(matches, obj)
+		}
+	})
+	sort.Slice(matches, func(i, j int) bool {
+		return newResourceKey(matches[i]).String() < newResourceKey(matches[j]).String()
+	})
+
 	// the replacer visitor resets a node in the tree if
 	// any of the identifying information changes
 	visitor = replaceVisitor(tree, visitor)
-	if len(o.matchLabels) > 0 {
-		visitor = matchLabels(o.matchLabels, visitor)
-	}
-	if len(o.matchAnnotations) > 0 {
-		visitor = matchAnnotations(o.matchAnnotations, visitor)
-	}
-
-	if o.kinds.Len() == 0 {
-		o.kinds.Insert(schema.GroupVersionKind{Group: "*", Version: "*", Kind: "*"})
+	for _, obj := range matches {
+		if !tree.contains(obj) {
+			continue
+		}
+		if err := visitor.Visit(obj); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	if o.namespaces.Len() == 0 {
-		o.namespaces.Insert("*")
+// walk calls fn with every resource in the tree
+func (tree *treeNode) walk(fn func(obj *Object)) {
+	if tree.obj != nil {
+		fn(tree.obj)
 	}
-
-	if o.names.Len() == 0 {
-		o.names.Insert("*")
+	for _, node := range tree.nodes {
+		node.walk(fn)
 	}
+}
 
-	errs := make([]error, 0)
-	for gvk := range o.kinds {
-		for namespace := range o.namespaces {
-			for name := range o.names {
-				path := []string{gvk.Group, gvk.Version, gvk.Kind, namespace, name}
-				if err := tree.visit(visitor, path...); err != nil {
-					errs = append(errs, err)
-				}
-			}
+// contains reports whether obj is in the tree at its key
+func (tree *treeNode) contains(obj *Object) bool {
+	node := tree
+	for _, zero := range tree.path(newResourceKey(obj)) {
+		var ok bool
+		if node, ok = node.nodes[strings.ToLower(zero)]; !ok {
+			return false
 		}
 	}
-	if len(errs) > 0 {
-		return goerr.Join(errs...)
-	}
-	return nil
+	return node.obj == obj
 }
 
 func (tree *treeNode) path(key Key) []string {
@@ -77,6 +91,7 @@ func (tree *treeNode) path(key Key) []string {
 // Insert a resource into the treeNode. If a resource already exists in the tree
 // and the resource content is different, and error will be returned.
 func (tree *treeNode) Insert(obj *Object) error {
+	setSequence(obj)
 	err := tree.insert(obj, tree.path(newResourceKey(obj))...)
 	return errors.Wrapf(err, "%s: %s", ErrInsertResource, treeError(obj))
 }
@@ -88,23 +103,12 @@ func (tree *treeNode) Pop(key Key) (*Object, error) {
 	return obj, errors.Wrapf(err, "%s: %s", ErrPopResource, key.String())
 }
 
-func (tree *treeNode) visitNodes(visitor Visitor, path ...string) error {
-	errs := make([]error, 0)
-	for _, node := range tree.nodes {
-		if err := node.visit(visitor, path...); err != nil {
-			errs = append(errs, err)
-		}
-	}
-	if len(errs) > 0 {
-		return goerr.Join(errs...)
-	}
-	return nil
-}
-
 func (tree *treeNode) insert(obj *Object, path ...string) error {
 	if len(path) == 0 {
-		if tree.obj != nil && !reflect.DeepEqual(obj, tree.obj) {
-			return ErrResourceConflict
+		// only the content is compared, since the same resource can be
+		// inserted more than once, such as a base that's included twice
+		if tree.obj != nil && !obj.Equals(tree.obj) {
+			return conflictError(tree.obj, obj)
 		}
 		tree.obj = obj
 		return nil
@@ -153,39 +157,6 @@ func (tree *treeNode) pop(path ...string) (*Object, error) {
 	return obj, nil
 }
 
-func (tree *treeNode) visit(visitor Visitor, path ...string) error {
-	if len(path) == 0 {
-		if tree.obj == nil {
-			return nil
-		}
-		return visitor.Visit(tree.obj)
-	}
-	zero, path := strings.ToLower(path[0]), path[1:]
-	if zero == "*" {
-		// matches on all nodes in the tree
-		return tree.visitNodes(visitor, path...)
-	}
-	t, ok := tree.nodes[zero]
-	if !ok {
-		return nil
-	}
-	return t.visit(visitor, path...)
-}
-
-func newOptions(opts ...MatchOption) *matchOptions {
-	o := &matchOptions{
-		kinds:            sets.New[schema.GroupVersionKind](),
-		names:            sets.New[string](),
-		namespaces:       sets.New[string](),
-		matchLabels:      make(map[string]string),
-		matchAnnotations: make(map[string]string),
-	}
-	for _, f := range opts {
-		f(o)
-	}
-	return o
-}
-
 func treeError(obj *Object) string {
 	return newResourceKey(obj).String()
 }
@@ -3,6 +3,7 @@ package resource
 import (
 	qt "github.com/frankban/quicktest"
 	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"testing"
 )
@@ -40,6 +41,16 @@ func TestTreeNode_Insert(t *testing.T) {
 	}
 }
 
+func TestTreeNode_Insert_Equal(t *testing.T) {
+	m := map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "a", "namespace": "x"}}
+	tree := NewTree()
+	qt.Assert(t, tree.Insert(Unstructured(m)), qt.IsNil)
+	qt.Assert(t, tree.Insert(Unstructured(m)), qt.IsNil)
+
+	changed := Unstructured(map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "a", "namespace": "x"}, "data": map[string]any{"a": "b"}})
+	qt.Assert(t, tree.Insert(changed), qt.ErrorIs, ErrResourceConflict)
+}
+
 func TestTreeNode_Visit(t *testing.T) {
 	tests := map[string]struct {
 		initObjs []*Object
@@ -127,3 +138,96 @@ func TestTreeNode_Pop(t *testing.T) {
 		})
 	}
 }
+
+func TestTreeNode_Visit_ExactlyOnce(t *testing.T) {
+	deployment := func(name string) *Object {
+		return Unstructured(map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": name, "namespace": "app"},
+		})
+	}
+	tests := map[string]struct {
+		options []MatchOption
+		// visitor is called with every visited resource
+		visitor func(tree Tree, obj *Object) error
+		want    []string
+	}{
+		"OverlappingKinds": {
+			options: []MatchOption{
+				MatchKinds(schema.GroupVersionKind{Group: "apps", Version: Any, Kind: "Deployment"}),
+				MatchKinds(schema.GroupVersionKind{Group: Any, Version: "v1", Kind: "Deployment"}),
+			},
+			want: []string{"apps.v1.Deployment/app/a", "apps.v1.Deployment/app/b", "apps.v1.Deployment/app/c"},
+		},
+		"OverlappingNamesAndNamespaces": {
+			options: []MatchOption{MatchNames("a", Any), MatchNamespaces("app", Any)},
+			want:    []string{"apps.v1.Deployment/app/a", "apps.v1.Deployment/app/b", "apps.v1.Deployment/app/c"},
+		},
+		"Renamed": {
+			visitor: func(tree Tree, obj *Object) error {
+				// z sorts after every other name, so it would be visited
+				// again if it were looked up after the rename
+				obj.SetName("z-" + obj.GetName())
+				return nil
+			},
+			want: []string{"apps.v1.Deployment/app/a", "apps.v1.Deployment/app/b", "apps.v1.Deployment/app/c"},
+		},
+		"Popped": {
+			visitor: func(tree Tree, obj *Object) error {
+				if obj.GetName() == "a" {
+					_, err := tree.Pop(ParseKey(deployment("b")))
+					return err
+				}
+				return nil
+			},
+			want: []string{"apps.v1.Deployment/app/a", "apps.v1.Deployment/app/c"},
+		},
+		"Inserted": {
+			visitor: func(tree Tree, obj *Object) error {
+				if obj.GetName() == "a" {
+					return tree.Insert(deployment("aa"))
+				}
+				return nil
+			},
+			want: []string{"apps.v1.Deployment/app/a", "apps.v1.Deployment/app/b", "apps.v1.Deployment/app/c"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tree := NewTree()
+			for _, name := range []string{"c", "a", "b"} {
+				qt.Assert(t, tree.Insert(deployment(name)), qt.IsNil)
+			}
+			got := make([]string, 0)
+			err := tree.Visit(VisitorFunc(func(obj *Object) error {
+				got = append(got, newResourceKey(obj).String())
+				if tt.visitor != nil {
+					return tt.visitor(tree, obj)
+				}
+				return nil
+			}), tt.options...)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestTreeNode_Visit_Error(t *testing.T) {
+	tree := NewTree()
+	for _, name := range []string{"a", "b"} {
+		qt.Assert(t, tree.Insert(Unstructured(map[string]any{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": name},
+		})), qt.IsNil)
+	}
+	// visiting stops at the first error
+	visited := 0
+	err := tree.Visit(VisitorFunc(func(obj *Object) error {
+		visited++
+		return ErrNotFound
+	}))
+	qt.Assert(t, err, qt.ErrorIs, ErrNotFound)
+	qt.Assert(t, visited, qt.Equals, 1)
+}
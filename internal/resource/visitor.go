@@ -3,15 +3,26 @@ package resource
 import (
 	"gopkg.in/yaml.v3"
 	"io"
-	"k8s.io/apimachinery/pkg/labels"
 )
 
 func CopyTree(to, from Tree) error {
 	return from.Visit(copyTree(to))
 }
 
-func PrintTree(tree Tree, w io.Writer) error {
-	return tree.Visit(printTree(yaml.NewEncoder(w)))
+// PrintTree writes every resource in the tree to w as a stream of YAML
+// documents, sorted in order
+func PrintTree(tree Tree, w io.Writer, order SortOrder) error {
+	objs, err := Sorted(tree, order)
+	if err != nil {
+		return err
+	}
+	e := yaml.NewEncoder(w)
+	for _, obj := range objs {
+		if err := e.Encode(obj.Object); err != nil {
+			return err
+		}
+	}
+	return e.Close()
 }
 
 func copyTree(to Tree) Visitor {
@@ -20,38 +31,6 @@ func copyTree(to Tree) Visitor {
 	})
 }
 
-func printTree(e *yaml.Encoder) Visitor {
-	return VisitorFunc(func(obj *Object) error {
-		return e.Encode(obj.Object)
-	})
-}
-
-// matchLabels is a visitor predicate that only runs the next visitor if the resource
-// matches the provided labels.
-func matchLabels(l map[string]string, next Visitor) Visitor {
-	return VisitorFunc(func(obj *Object) error {
-		set := labels.Set(l)
-		selector := labels.SelectorFromSet(set)
-		if selector.Matches(labels.Set(obj.GetLabels())) {
-			return next.Visit(obj)
-		}
-		return nil
-	})
-}
-
-// matchLabels is a visitor predicate that only runs the next visitor if the resource
-// matches the provided labels.
-func matchAnnotations(l map[string]string, next Visitor) Visitor {
-	return VisitorFunc(func(obj *Object) error {
-		set := labels.Set(l)
-		selector := labels.SelectorFromSet(set)
-		if selector.Matches(labels.Set(obj.GetAnnotations())) {
-			return next.Visit(obj)
-		}
-		return nil
-	})
-}
-
 // replaceVisitor wraps a visitor and checks to see if the visitor changed the key. If the
 // visitor changed the key, it reinserts the resource in the tree
 func replaceVisitor(tree *treeNode, next Visitor) Visitor {
@@ -0,0 +1,57 @@
+package script
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/dop251/goja"
+
+	"github.com/johnhoman/dinghy/internal/logging"
+)
+
+// defineConsole adds a `console` global with log, warn and error
+// functions, which write to the host logger
+func (p *Program) defineConsole() error {
+	console := p.vm.NewObject()
+	for name, level := range map[string]func(l *logging.Logger) func(string, ...any){
+		"log":   func(l *logging.Logger) func(string, ...any) { return l.Info },
+		"info":  func(l *logging.Logger) func(string, ...any) { return l.Info },
+		"warn":  func(l *logging.Logger) func(string, ...any) { return l.Warn },
+		"error": func(l *logging.Logger) func(string, ...any) { return l.Error },
+	} {
+		level := level
+		if err := console.Set(name, func(call goja.FunctionCall) goja.Value {
+			logger := p.host.Logger
+			if logger == nil {
+				logger = logging.New()
+			}
+			level(logger)("%s: %s", p.name, formatArgs(call.Arguments))
+			return goja.Undefined()
+		}); err != nil {
+			return err
+		}
+	}
+	return p.vm.Set("console", console)
+}
+
+// formatArgs joins the console arguments with spaces. Objects and arrays
+// are formatted as JSON.
+func formatArgs(args []goja.Value) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if IsNullish(arg) {
+			parts = append(parts, arg.String())
+			continue
+		}
+		switch arg.Export().(type) {
+		case map[string]any, []any:
+			data, err := json.Marshal(arg.Export())
+			if err == nil {
+				parts = append(parts, string(data))
+				continue
+			}
+		}
+		parts = append(parts, arg.String())
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,126 @@
+package script
+
+import (
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/decode"
+)
+
+type pluginConfig struct {
+	Script string         `yaml:"script"`
+	Config map[string]any `yaml:"config"`
+	// Timeout is how long a single call into the script can run,
+	// e.g. 30s. It defaults to 10s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Plugin is the script of a script generator, mutator or validator. The
+// script is either the builtin.dinghy.dev/script/js plugin, which is
+// configured with its source, or a script loaded from a module, which is
+// configured with the config passed to it. Each kind of plugin calls one
+// function the script declares, such as mutate, with the config as the
+// last argument.
+type Plugin struct {
+	// name and source are only set for scripts loaded from
+	// a module
+	name   string
+	source string
+
+	// opts are passed to the script when it's compiled
+	opts []Option
+	// host is the environment the script runs in. It's kept so that
+	// it can be set on scripts that are compiled after SetHost
+	host Host
+	prog *Program
+
+	fn     Function
+	config map[string]any
+}
+
+// NewPlugin returns a Plugin that runs the provided source, such as
+// a script loaded from a module. The Plugin is registered under name,
+// and the `with` config is passed to the script function as is.
+func NewPlugin(name, source string, opts ...Option) Plugin {
+	return Plugin{name: name, source: source, opts: opts}
+}
+
+func (p *Plugin) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	return "builtin.dinghy.dev/script/js"
+}
+
+// Decode decodes the config of the plugin and compiles the script. An
+// error is returned if the script doesn't declare function.
+func (p *Plugin) Decode(value *yaml.Node, function string) error {
+	if p.source != "" {
+		var config map[string]any
+		if err := value.Decode(&config); err != nil {
+			return err
+		}
+		return p.compile(function, p.source, config)
+	}
+
+	var in pluginConfig
+	if err := decode.Node(value, &in, ""); err != nil {
+		return err
+	}
+	return p.compile(function, in.Script, in.Config, WithTimeout(in.Timeout))
+}
+
+// Schema returns the schema of the config of the plugin
+func (p *Plugin) Schema(function string) *jsonschema.Schema {
+	if p.source != "" {
+		return &jsonschema.Schema{Type: "object", Description: "config passed to the " + function + " function"}
+	}
+	return decode.Schema(&pluginConfig{})
+}
+
+// SetHost sets the environment the script runs in
+func (p *Plugin) SetHost(host Host) {
+	p.host = host
+	if p.prog != nil {
+		p.prog.SetHost(host)
+	}
+}
+
+// Compile compiles the script if Decode hasn't, because the plugin
+// didn't have any config to decode. An error is returned if the script
+// doesn't declare function.
+func (p *Plugin) Compile(function string) error {
+	if p.fn != nil {
+		return nil
+	}
+	return p.compile(function, p.source, nil)
+}
+
+// Call calls function with args, followed by the config of the plugin.
+// The script must be compiled by Decode or Compile first.
+func (p *Plugin) Call(function string, args ...any) (goja.Value, error) {
+	if p.fn == nil {
+		return nil, errors.Errorf("%s: %s function isn't compiled", p.Name(), function)
+	}
+	return p.fn(append(args, p.config)...)
+}
+
+func (p *Plugin) compile(function, source string, config map[string]any, opts ...Option) error {
+	opts = append([]Option{WithName(p.Name())}, append(p.opts, opts...)...)
+	prog, err := Compile(source, opts...)
+	if err != nil {
+		return err
+	}
+	prog.SetHost(p.host)
+	p.prog = prog
+	p.fn, err = prog.Function(function)
+	if err != nil {
+		return err
+	}
+	p.config = config
+	return nil
+}
@@ -0,0 +1,45 @@
+package script
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPlugin_Decode(t *testing.T) {
+	var p Plugin
+	var node yaml.Node
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+script: |
+  function greet(name, config) {
+    return config.greeting + " " + name
+  }
+config:
+  greeting: hello
+`), &node), qt.IsNil)
+	qt.Assert(t, p.Decode(node.Content[0], "greet"), qt.IsNil)
+	qt.Assert(t, p.Name(), qt.Equals, "builtin.dinghy.dev/script/js")
+
+	v, err := p.Call("greet", "world")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, v.Export(), qt.Equals, "hello world")
+
+	p = Plugin{}
+	qt.Assert(t, p.Decode(node.Content[0], "mutate"), qt.ErrorMatches, "mutate function not found")
+}
+
+func TestPlugin_Call_Module(t *testing.T) {
+	// a module without any config isn't compiled until Compile is called
+	p := NewPlugin("example.com/greet", "function greet(name, config) { return config === null }")
+	_, err := p.Call("greet", "world")
+	qt.Assert(t, err, qt.ErrorMatches, "example.com/greet: greet function isn't compiled")
+	qt.Assert(t, p.Compile("mutate"), qt.ErrorMatches, "mutate function not found")
+	qt.Assert(t, p.Compile("greet"), qt.IsNil)
+
+	v, err := p.Call("greet", "world")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, v.Export(), qt.Equals, true)
+	qt.Assert(t, p.Name(), qt.Equals, "example.com/greet")
+	qt.Assert(t, p.Schema("greet").Description, qt.Equals, "config passed to the greet function")
+}
@@ -0,0 +1,250 @@
+// Package script runs the javascript used by the script generators,
+// mutators and validators.
+package script
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
+	"github.com/pkg/errors"
+
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/logging"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+const (
+	// DefaultTimeout is how long a single call into a script can run
+	// before it's interrupted
+	DefaultTimeout = 10 * time.Second
+	// DefaultName is the name of scripts that weren't given a name
+	DefaultName = "script.js"
+
+	// maxCallStackSize stops runaway recursion before it exhausts memory
+	maxCallStackSize = 1024
+)
+
+// Host is the environment a Program runs in
+type Host struct {
+	// Context interrupts running scripts when it's done, such as when
+	// the build deadline passes
+	Context context.Context
+	// Logger receives the output of console.log, console.warn and
+	// console.error
+	Logger *logging.Logger
+	// Tree is the resource tree the script can read from
+	Tree resource.Tree
+}
+
+// HostAware is implemented by scripts that run in a Host provided
+// by the build
+type HostAware interface {
+	SetHost(host Host)
+}
+
+// Loader is implemented by scripts that are compiled when they're
+// loaded, so that a script that doesn't declare the function the
+// plugin calls is reported before anything is built
+type Loader interface {
+	Load() error
+}
+
+// Program is a script that has been loaded into a javascript runtime,
+// so that the functions it declares can be called.
+type Program struct {
+	vm      *goja.Runtime
+	name    string
+	timeout time.Duration
+	host    Host
+}
+
+type Option func(p *Program)
+
+// WithName sets the name of the script, which is used in errors
+// and console output
+func WithName(name string) Option {
+	return func(p *Program) {
+		p.name = name
+	}
+}
+
+// WithTimeout sets how long a single call into the script can run
+// before it's interrupted. A timeout of zero uses DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Program) {
+		if timeout > 0 {
+			p.timeout = timeout
+		}
+	}
+}
+
+// Function is a javascript function declared by a Program. Arguments are
+// converted to javascript values, and Go maps and slices are passed by
+// reference, so changes made by the function are visible to the caller.
+type Function func(args ...any) (goja.Value, error)
+
+// Compile runs the script source in a new runtime
+func Compile(source string, opts ...Option) (*Program, error) {
+	p := &Program{vm: goja.New(), name: DefaultName, timeout: DefaultTimeout}
+	for _, f := range opts {
+		f(p)
+	}
+	p.vm.SetMaxCallStackSize(maxCallStackSize)
+
+	// parse the source separately from compiling it, so that syntax
+	// errors keep their position
+	ast, err := parser.ParseFile(nil, p.name, source, 0)
+	if err != nil {
+		return nil, p.error(err)
+	}
+	prog, err := goja.CompileAST(ast, false)
+	if err != nil {
+		return nil, p.error(err)
+	}
+	for _, define := range []func() error{p.defineConsole, p.defineStdlib, p.defineTree} {
+		if err := define(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.run(func() (goja.Value, error) { return p.vm.RunProgram(prog) }); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetHost sets the environment the script runs in. The host can be
+// changed at any time, and is used by every call after it's set.
+func (p *Program) SetHost(host Host) {
+	p.host = host
+}
+
+// Function returns the function the script declares as name. An error
+// is returned if the script doesn't declare the function.
+func (p *Program) Function(name string) (Function, error) {
+	fn, ok := goja.AssertFunction(p.vm.Get(name))
+	if !ok {
+		return nil, errors.Errorf("%s function not found", name)
+	}
+	return func(args ...any) (goja.Value, error) {
+		values := make([]goja.Value, 0, len(args))
+		for _, arg := range args {
+			values = append(values, p.vm.ToValue(arg))
+		}
+		return p.run(func() (goja.Value, error) {
+			return fn(goja.Undefined(), values...)
+		})
+	}, nil
+}
+
+// run calls fn, interrupting the runtime if the call takes longer than
+// the timeout or the host context is done
+func (p *Program) run(fn func() (goja.Value, error)) (goja.Value, error) {
+	ctx := p.host.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			p.vm.Interrupt(ctx.Err())
+		case <-stop:
+		}
+	}()
+	v, err := fn()
+	close(stop)
+	// wait for the watcher to exit before clearing the interrupt, so
+	// that it can't interrupt the next call
+	<-stopped
+	p.vm.ClearInterrupt()
+	if err != nil {
+		return nil, p.error(err)
+	}
+	return v, nil
+}
+
+// stackFrame matches a frame in a goja stack trace that points into a
+// script, e.g. "at mutate (script.js:3:9(5))". Frames for host functions
+// are "at name (native)", and don't match.
+var stackFrame = regexp.MustCompile(`(?m)^\s*at (?:.* \()?[^\s(]*:(\d+):(\d+)\(\d+\)\)?$`)
+
+// error converts errors from the runtime into an ErrScript, with the
+// position in the script the error was thrown from
+func (p *Program) error(err error) error {
+	rv := &dinghyerrors.ErrScript{Script: p.name, Message: err.Error(), Err: err}
+	var (
+		syntaxErrs   parser.ErrorList
+		compileErr   *goja.CompilerSyntaxError
+		interruptErr *goja.InterruptedError
+		exception    *goja.Exception
+	)
+	switch {
+	case errors.As(err, &syntaxErrs) && len(syntaxErrs) > 0:
+		first := syntaxErrs[0]
+		rv.Message = "SyntaxError: " + first.Message
+		rv.Line, rv.Column = first.Position.Line, first.Position.Column
+		return rv
+	case errors.As(err, &compileErr):
+		rv.Message = "SyntaxError: " + compileErr.Message
+		if compileErr.File != nil {
+			pos := compileErr.File.Position(compileErr.Offset)
+			rv.Line, rv.Column = pos.Line, pos.Column
+		}
+		return rv
+	case errors.As(err, &interruptErr):
+		rv.Message = "interrupted"
+		if cause, ok := interruptErr.Value().(error); ok {
+			rv.Err = cause
+			rv.Message = cause.Error()
+			if errors.Is(cause, context.DeadlineExceeded) {
+				rv.Message = "timed out after " + p.timeout.String()
+				if deadline, ok := p.deadline(); ok {
+					rv.Message = "build deadline exceeded at " + deadline.Format(time.RFC3339)
+				}
+			}
+		}
+	case errors.As(err, &exception):
+		if exception.Value() != nil {
+			rv.Message = exception.Value().String()
+		}
+	default:
+		return err
+	}
+	// the full stack is only available from String
+	if stack, ok := err.(fmt.Stringer); ok {
+		if m := stackFrame.FindStringSubmatch(stack.String()); m != nil {
+			rv.Line, _ = strconv.Atoi(m[1])
+			rv.Column, _ = strconv.Atoi(m[2])
+		}
+	}
+	return rv
+}
+
+// deadline returns the host deadline if it would have passed before
+// the script timeout
+func (p *Program) deadline() (time.Time, bool) {
+	if p.host.Context == nil {
+		return time.Time{}, false
+	}
+	deadline, ok := p.host.Context.Deadline()
+	if !ok || !time.Now().After(deadline) {
+		return time.Time{}, false
+	}
+	return deadline, true
+}
+
+// IsNullish reports whether the value returned by a function is
+// undefined or null.
+func IsNullish(v goja.Value) bool {
+	return v == nil || goja.IsUndefined(v) || goja.IsNull(v)
+}
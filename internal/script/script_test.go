@@ -0,0 +1,169 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	dinghyerrors "github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/logging"
+)
+
+func TestCompile_Errors(t *testing.T) {
+	cases := map[string]struct {
+		source string
+		want   dinghyerrors.ErrScript
+	}{
+		"SyntaxError": {
+			source: "function run() {\n  return (\n}\n",
+			want:   dinghyerrors.ErrScript{Script: "team.js", Line: 3, Column: 1},
+		},
+		"ThrowsAtTopLevel": {
+			source: "\n  throw new Error('boom')\n",
+			want:   dinghyerrors.ErrScript{Script: "team.js", Line: 2, Column: 9, Message: "Error: boom"},
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Compile(tt.source, WithName("team.js"))
+			var got *dinghyerrors.ErrScript
+			qt.Assert(t, err, qt.ErrorAs, &got)
+			qt.Assert(t, got.Script, qt.Equals, tt.want.Script)
+			qt.Assert(t, got.Line, qt.Equals, tt.want.Line)
+			qt.Assert(t, got.Column, qt.Equals, tt.want.Column)
+			if tt.want.Message != "" {
+				qt.Assert(t, got.Message, qt.Equals, tt.want.Message)
+			}
+		})
+	}
+}
+
+func TestProgram_Function_Exception(t *testing.T) {
+	prog, err := Compile("function run(obj) {\n  return obj.metadata.name\n}\n", WithName("team.js"))
+	qt.Assert(t, err, qt.IsNil)
+	run, err := prog.Function("run")
+	qt.Assert(t, err, qt.IsNil)
+	_, err = run(map[string]any{})
+	qt.Assert(t, err, qt.ErrorMatches, `script team.js:2:23: TypeError: Cannot read property 'name' of undefined`)
+}
+
+func TestProgram_Function_Timeout(t *testing.T) {
+	prog, err := Compile(`function run() { while (true) {} }`, WithTimeout(50*time.Millisecond))
+	qt.Assert(t, err, qt.IsNil)
+	run, err := prog.Function("run")
+	qt.Assert(t, err, qt.IsNil)
+	_, err = run()
+	qt.Assert(t, err, qt.ErrorMatches, `script script.js:1:\d+: timed out after 50ms`)
+	qt.Assert(t, err, qt.ErrorIs, context.DeadlineExceeded)
+
+	// the interrupt is cleared, so the runtime can still be used
+	prog, err = Compile(`let calls = 0; function run() { calls++; if (calls == 1) { while (true) {} }; return calls }`,
+		WithTimeout(50*time.Millisecond))
+	qt.Assert(t, err, qt.IsNil)
+	run, err = prog.Function("run")
+	qt.Assert(t, err, qt.IsNil)
+	_, err = run()
+	qt.Assert(t, err, qt.IsNotNil)
+	v, err := run()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, v.Export(), qt.Equals, int64(2))
+}
+
+func TestProgram_Function_HostDeadline(t *testing.T) {
+	prog, err := Compile(`function run() { while (true) {} }`)
+	qt.Assert(t, err, qt.IsNil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	prog.SetHost(Host{Context: ctx})
+	run, err := prog.Function("run")
+	qt.Assert(t, err, qt.IsNil)
+	_, err = run()
+	qt.Assert(t, err, qt.ErrorMatches, `script script.js:1:\d+: build deadline exceeded at .*`)
+}
+
+func TestProgram_Function_Recursion(t *testing.T) {
+	prog, err := Compile(`function run() { return run() }`)
+	qt.Assert(t, err, qt.IsNil)
+	run, err := prog.Function("run")
+	qt.Assert(t, err, qt.IsNil)
+	_, err = run()
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestProgram_Console(t *testing.T) {
+	buf := new(bytes.Buffer)
+	prog, err := Compile(`function run() {
+  console.log("replicas", 3, {app: "web"})
+  console.warn("deprecated")
+  console.error("failed")
+}`, WithName("team.js"))
+	qt.Assert(t, err, qt.IsNil)
+	prog.SetHost(Host{Logger: logging.NewWriter(buf)})
+	run, err := prog.Function("run")
+	qt.Assert(t, err, qt.IsNil)
+	_, err = run()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, buf.String(), qt.Contains, `team.js: replicas 3 {"app":"web"}`)
+	qt.Assert(t, buf.String(), qt.Matches, `(?s).*WARN:.* team.js: deprecated.*`)
+	qt.Assert(t, buf.String(), qt.Matches, `(?s).*ERROR:.* team.js: failed.*`)
+}
+
+func TestProgram_Stdlib(t *testing.T) {
+	cases := map[string]struct {
+		source string
+		want   any
+	}{
+		"Base64Encode": {
+			source: `function run() { return base64.encode("dinghy") }`,
+			want:   "ZGluZ2h5",
+		},
+		"Base64Decode": {
+			source: `function run() { return base64.decode("ZGluZ2h5") }`,
+			want:   "dinghy",
+		},
+		"Sha256": {
+			source: `function run() { return sha256("dinghy") }`,
+			want:   "5c8fb3b16ab74f8c78314f28b24c644bc45fe1e4b2747ef164c2be64358e49ed",
+		},
+		"YAMLParse": {
+			source: `function run() { return yaml.parse("app: web\nreplicas: 3").replicas }`,
+			want:   int64(3),
+		},
+		"YAMLStringify": {
+			source: `function run() { return yaml.stringify({app: "web"}) }`,
+			want:   "app: web\n",
+		},
+		"JSONPathGet": {
+			source: `function run() {
+  const obj = {spec: {containers: [{name: "main", image: "nginx"}]}}
+  return jsonpath.get(obj, "spec.containers[name=main].image")
+}`,
+			want: "nginx",
+		},
+		"JSONPathGetMissing": {
+			source: `function run() { return jsonpath.get({}, "spec.replicas") }`,
+			want:   nil,
+		},
+		"JSONPathSet": {
+			source: `function run() {
+  const obj = jsonpath.set({spec: {}}, "spec.replicas", 3)
+  return obj.spec.replicas
+}`,
+			want: int64(3),
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			prog, err := Compile(tt.source)
+			qt.Assert(t, err, qt.IsNil)
+			run, err := prog.Function("run")
+			qt.Assert(t, err, qt.IsNil)
+			v, err := run()
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, v.Export(), qt.DeepEquals, tt.want)
+		})
+	}
+}
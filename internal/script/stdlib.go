@@ -0,0 +1,89 @@
+package script
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/fieldpath"
+)
+
+// defineStdlib adds the helpers every script can use:
+//
+//	base64.encode(s), base64.decode(s)
+//	sha256(s)                        returns the hex encoded digest
+//	yaml.parse(s), yaml.stringify(v)
+//	jsonpath.get(obj, path)          returns the value at path, or undefined
+//	jsonpath.set(obj, path, value)   sets the value at path and returns obj
+//
+// Paths use the same syntax as the patch mutator field paths, such
+// as spec.template.spec.containers[name=main].image
+func (p *Program) defineStdlib() error {
+	b64 := p.vm.NewObject()
+	if err := b64.Set("encode", func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}); err != nil {
+		return err
+	}
+	if err := b64.Set("decode", func(s string) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(s)
+		return string(data), err
+	}); err != nil {
+		return err
+	}
+
+	y := p.vm.NewObject()
+	if err := y.Set("parse", func(s string) (any, error) {
+		var v any
+		if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}); err != nil {
+		return err
+	}
+	if err := y.Set("stringify", func(v any) (string, error) {
+		data, err := yaml.Marshal(v)
+		return string(data), err
+	}); err != nil {
+		return err
+	}
+
+	jp := p.vm.NewObject()
+	if err := jp.Set("get", func(obj map[string]any, path string) (any, error) {
+		fp, err := fieldpath.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		v, _, err := fp.GetValue(obj)
+		return v, err
+	}); err != nil {
+		return err
+	}
+	if err := jp.Set("set", func(obj map[string]any, path string, value any) (map[string]any, error) {
+		fp, err := fieldpath.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		return obj, fp.SetValue(obj, value)
+	}); err != nil {
+		return err
+	}
+
+	for name, v := range map[string]any{
+		"base64":   b64,
+		"yaml":     y,
+		"jsonpath": jp,
+		"sha256": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+	} {
+		if err := p.vm.Set(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
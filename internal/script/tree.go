@@ -0,0 +1,137 @@
+package script
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/dop251/goja"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
+)
+
+// treeKey identifies a single resource for tree.get
+type treeKey struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace"`
+}
+
+// defineTree gives the script read access to the host tree through
+// the `tree` global. The global has the following functions:
+//
+//	tree.list()          returns every resource in the tree
+//	tree.find(selector)  returns the resources matching a selector, which
+//	                     has the same fields as a plugin selector
+//	tree.get(key)        returns the resource with the provided apiVersion,
+//	                     kind, name and namespace, or null if there isn't one
+//
+// Resources are copied before they're passed to the script, so changes
+// made by the script aren't visible in the tree.
+func (p *Program) defineTree() error {
+	obj := p.vm.NewObject()
+	if err := obj.Set("list", func() []any {
+		rv, err := p.find()
+		if err != nil {
+			panic(p.vm.NewGoError(err))
+		}
+		return rv
+	}); err != nil {
+		return err
+	}
+	if err := obj.Set("find", func(selector goja.Value) []any {
+		var s types.ResourceSelector
+		if err := p.export(selector, &s); err != nil {
+			panic(p.vm.NewGoError(errors.Wrap(err, "tree.find: invalid selector")))
+		}
+		opts, err := s.MatchOptions()
+		if err != nil {
+			panic(p.vm.NewGoError(errors.Wrap(err, "tree.find: invalid selector")))
+		}
+		rv, err := p.find(opts...)
+		if err != nil {
+			panic(p.vm.NewGoError(err))
+		}
+		return rv
+	}); err != nil {
+		return err
+	}
+	if err := obj.Set("get", func(key goja.Value) any {
+		var k treeKey
+		if err := p.export(key, &k); err != nil {
+			panic(p.vm.NewGoError(errors.Wrap(err, "tree.get: invalid key")))
+		}
+		if k.APIVersion == "" || k.Kind == "" || k.Name == "" {
+			panic(p.vm.NewGoError(errors.New("tree.get: apiVersion, kind and name are required")))
+		}
+		gv, err := schema.ParseGroupVersion(k.APIVersion)
+		if err != nil {
+			panic(p.vm.NewGoError(errors.Wrap(err, "tree.get")))
+		}
+		opts := []resource.MatchOption{
+			resource.MatchKinds(gv.WithKind(k.Kind)),
+			resource.MatchNames(k.Name),
+		}
+		if k.Namespace != "" {
+			opts = append(opts, resource.MatchNamespaces(k.Namespace))
+		}
+		rv, err := p.find(opts...)
+		if err != nil {
+			panic(p.vm.NewGoError(err))
+		}
+		for _, item := range rv {
+			// cluster scoped resources are stored without a namespace, so
+			// a key without a namespace only matches those
+			obj := resource.Unstructured(item.(map[string]any))
+			if obj.GetNamespace() == k.Namespace {
+				return item
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return p.vm.Set("tree", obj)
+}
+
+// find returns a copy of every resource in the tree matching opts, sorted
+// by key so that scripts see the same order on every build
+func (p *Program) find(opts ...resource.MatchOption) ([]any, error) {
+	objs := make([]*resource.Object, 0)
+	if p.host.Tree != nil {
+		err := p.host.Tree.Visit(resource.VisitorFunc(func(obj *resource.Object) error {
+			objs = append(objs, obj.Copy())
+			return nil
+		}), opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return resource.ParseKey(objs[i]).String() < resource.ParseKey(objs[j]).String()
+	})
+	rv := make([]any, 0, len(objs))
+	for _, obj := range objs {
+		rv = append(rv, obj.Object)
+	}
+	return rv, nil
+}
+
+// export decodes a javascript value into out, failing on any
+// unknown fields
+func (p *Program) export(value goja.Value, out any) error {
+	if IsNullish(value) {
+		return nil
+	}
+	data, err := yaml.Marshal(value.Export())
+	if err != nil {
+		return err
+	}
+	d := yaml.NewDecoder(bytes.NewBuffer(data))
+	d.KnownFields(true)
+	return d.Decode(out)
+}
@@ -0,0 +1,136 @@
+package script
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func newTree(t *testing.T) resource.Tree {
+	tree := resource.NewTree()
+	for _, obj := range []map[string]any{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]any{
+				"name":      "settings",
+				"namespace": "default",
+				"labels":    map[string]any{"app": "web"},
+			},
+			"data": map[string]any{"port": "8080"},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]any{
+				"name":      "web",
+				"namespace": "default",
+				"labels":    map[string]any{"app": "web"},
+			},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]any{"name": "default"},
+		},
+	} {
+		qt.Assert(t, tree.Insert(resource.Unstructured(obj)), qt.IsNil)
+	}
+	return tree
+}
+
+func TestProgram_Tree(t *testing.T) {
+	cases := map[string]struct {
+		source string
+		want   any
+	}{
+		"ListsEveryResource": {
+			source: `function run() { return tree.list().map(o => o.kind) }`,
+			want:   []any{"ConfigMap", "Namespace", "Service"},
+		},
+		"FindsByKind": {
+			source: `function run() { return tree.find({kinds: ["Service"]}).map(o => o.metadata.name) }`,
+			want:   []any{"web"},
+		},
+		"FindsByLabels": {
+			source: `function run() { return tree.find({matchLabels: {app: "web"}}).map(o => o.kind) }`,
+			want:   []any{"ConfigMap", "Service"},
+		},
+		"FindsByNamespace": {
+			source: `function run() { return tree.find({namespaces: ["default"]}).length }`,
+			want:   int64(2),
+		},
+		"GetsResource": {
+			source: `function run() {
+  return tree.get({apiVersion: "v1", kind: "ConfigMap", namespace: "default", name: "settings"}).data.port
+}`,
+			want: "8080",
+		},
+		"GetsClusterScopedResource": {
+			source: `function run() { return tree.get({apiVersion: "v1", kind: "Namespace", name: "default"}).kind }`,
+			want:   "Namespace",
+		},
+		"GetReturnsNullWhenMissing": {
+			source: `function run() { return tree.get({apiVersion: "v1", kind: "ConfigMap", namespace: "other", name: "settings"}) }`,
+			want:   nil,
+		},
+		"ReturnsCopies": {
+			source: `function run() {
+  tree.list().forEach(o => { o.metadata.name = "changed" })
+  return tree.list().map(o => o.metadata.name)
+}`,
+			want: []any{"settings", "default", "web"},
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			prog, err := Compile(tt.source)
+			qt.Assert(t, err, qt.IsNil)
+			prog.SetHost(Host{Tree: newTree(t)})
+			run, err := prog.Function("run")
+			qt.Assert(t, err, qt.IsNil)
+			v, err := run()
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, v.Export(), qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestProgram_Tree_Errors(t *testing.T) {
+	cases := map[string]struct {
+		source string
+		err    string
+	}{
+		"UnknownSelectorField": {
+			source: `function run() { return tree.find({kind: "Service"}) }`,
+			err:    `(?s)script script.js:1:\d+: GoError: tree.find: invalid selector: .*field kind not found.*`,
+		},
+		"IncompleteKey": {
+			source: `function run() { return tree.get({kind: "Service"}) }`,
+			err:    `script script.js:1:\d+: GoError: tree.get: apiVersion, kind and name are required`,
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			prog, err := Compile(tt.source)
+			qt.Assert(t, err, qt.IsNil)
+			prog.SetHost(Host{Tree: newTree(t)})
+			run, err := prog.Function("run")
+			qt.Assert(t, err, qt.IsNil)
+			_, err = run()
+			qt.Assert(t, err, qt.ErrorMatches, tt.err)
+		})
+	}
+}
+
+func TestProgram_Tree_NotSet(t *testing.T) {
+	prog, err := Compile(`function run() { return tree.list().length }`)
+	qt.Assert(t, err, qt.IsNil)
+	run, err := prog.Function("run")
+	qt.Assert(t, err, qt.IsNil)
+	v, err := run()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, v.Export(), qt.Equals, int64(0))
+}
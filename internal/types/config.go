@@ -1,13 +1,19 @@
 package types
 
 import (
-	"bytes"
-	"fmt"
-	"gopkg.in/yaml.v3"
+	"path"
+	"regexp"
 	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
-	"github.com/johnhoman/dinghy/internal/generate"
-	"github.com/johnhoman/dinghy/internal/mutate"
+	"github.com/johnhoman/dinghy/internal/decode"
+	"github.com/johnhoman/dinghy/internal/resource"
 )
 
 var (
@@ -44,15 +50,139 @@ type Module struct {
 	// required attribute, but it is strongly encouraged to also provide
 	// a checksum.
 	Source Path `yaml:"source"`
+	// Timeout is how long a single call into the module can run, e.g.
+	// 30s. It defaults to 10s.
+	Timeout time.Duration `yaml:"timeout"`
+	// Node is the YAML node the module was decoded from. It's used to
+	// report the position of errors in the module, and is nil for
+	// modules created in code.
+	Node *yaml.Node `yaml:"-"`
 }
 
 // ResourceSelector selects resources based on attributes of the resource,
-// such as labels, annotations.
+// such as labels, annotations. A resource is selected if it matches every
+// field that's set.
 type ResourceSelector struct {
 	MatchLabels map[string]string `yaml:"matchLabels"`
-	Kinds       []string          `yaml:"kinds"`
-	Names       []string          `yaml:"names"`
-	Namespaces  []string          `yaml:"namespaces"`
+	// MatchExpressions are set based label requirements, with the
+	// operators In, NotIn, Exists and DoesNotExist
+	MatchExpressions []metav1.LabelSelectorRequirement `yaml:"matchExpressions"`
+	MatchAnnotations map[string]string                 `yaml:"matchAnnotations"`
+	// Kinds are either Kind, group/Kind or group/version/Kind, e.g.
+	// apps/Deployment. The core group is empty, e.g. /v1/ConfigMap.
+	Kinds []string `yaml:"kinds"`
+	// Names are either names, globs such as web-*, or regular expressions
+	// between slashes such as /^web-(api|ui)$/. A resource is selected if
+	// its name matches any of them.
+	Names      []string `yaml:"names"`
+	Namespaces []string `yaml:"namespaces"`
+	// Scope selects either Namespaced or Cluster scoped resources
+	Scope resource.Scope `yaml:"scope"`
+	// Exclude skips the resources it selects, e.g. the Deployments
+	// labeled sidecar.dinghy.dev/skip
+	Exclude *ResourceSelector `yaml:"exclude"`
+}
+
+// MatchOptions converts the selector into the MatchOptions used
+// to visit the resource tree. An error is returned if a kind, name
+// pattern, expression or scope is invalid.
+func (s ResourceSelector) MatchOptions() ([]resource.MatchOption, error) {
+	kinds := make([]schema.GroupVersionKind, 0, len(s.Kinds))
+	for _, kind := range s.Kinds {
+		gvk, err := resource.ParseKind(kind)
+		if err != nil {
+			return nil, errors.Wrap(err, "kinds")
+		}
+		kinds = append(kinds, gvk)
+	}
+	names := make([]string, 0, len(s.Names))
+	patterns := make([]*regexp.Regexp, 0)
+	for _, name := range s.Names {
+		pattern, err := namePattern(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "names: %q", name)
+		}
+		if pattern == nil {
+			names = append(names, name)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	expressions, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{MatchExpressions: s.MatchExpressions})
+	if err != nil {
+		return nil, errors.Wrap(err, "matchExpressions")
+	}
+	switch s.Scope {
+	case "", resource.ScopeNamespaced, resource.ScopeCluster:
+	default:
+		return nil, errors.Errorf("scope: %q must be %s or %s", s.Scope, resource.ScopeNamespaced, resource.ScopeCluster)
+	}
+	opts := []resource.MatchOption{
+		resource.MatchLabels(s.MatchLabels),
+		resource.MatchLabelSelector(expressions),
+		resource.MatchAnnotations(s.MatchAnnotations),
+		resource.MatchNames(names...),
+		resource.MatchNamePatterns(patterns...),
+		resource.MatchNamespaces(s.Namespaces...),
+		resource.MatchKinds(kinds...),
+	}
+	if s.Scope != "" {
+		opts = append(opts, resource.MatchScope(s.Scope))
+	}
+	if s.Exclude != nil {
+		exclude, err := s.Exclude.MatchOptions()
+		if err != nil {
+			return nil, errors.Wrap(err, "exclude")
+		}
+		opts = append(opts, resource.MatchExclude(exclude...))
+	}
+	return opts, nil
+}
+
+// namePattern returns the pattern of a names entry, which is a regular
+// expression between slashes, or a glob. Names without a pattern return
+// nil.
+func namePattern(name string) (*regexp.Regexp, error) {
+	if len(name) > 1 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
+		return regexp.Compile("^(?:" + name[1:len(name)-1] + ")$")
+	}
+	if !strings.ContainsAny(name, "*?[") {
+		return nil, nil
+	}
+	if _, err := path.Match(name, ""); err != nil {
+		return nil, err
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for k := 0; k < len(name); k++ {
+		switch c := name[k]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '[':
+			end := strings.IndexByte(name[k+1:], ']')
+			if end < 0 {
+				return nil, path.ErrBadPattern
+			}
+			end += k + 1
+			class := name[k+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			k = end
+		case '\\':
+			if k++; k == len(name) {
+				return nil, path.ErrBadPattern
+			}
+			expr.WriteString(regexp.QuoteMeta(name[k : k+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
 }
 
 // GeneratorSpec is a spec for resource generation rules.
@@ -62,6 +192,10 @@ type GeneratorSpec struct {
 	// Uses is the name or path to the plugin
 	Uses string `yaml:"uses" dinghy:"required"`
 	With any    `yaml:"with"`
+	// Node is the YAML node the spec was decoded from. It's used to
+	// report the position of errors in the spec, and is nil for specs
+	// created in code.
+	Node *yaml.Node `yaml:"-"`
 }
 
 // PluginSpec is a spec for resource mutation rules.
@@ -74,6 +208,10 @@ type PluginSpec struct {
 	// Uses is the name or path to the plugin
 	Uses string `yaml:"uses"`
 	With any    `yaml:"with"`
+	// Node is the YAML node the spec was decoded from. It's used to
+	// report the position of errors in the spec, and is nil for specs
+	// created in code.
+	Node *yaml.Node `yaml:"-"`
 }
 
 type (
@@ -85,58 +223,47 @@ type Config struct {
 	APIVersion string `yaml:"apiVersion" dinghy:"required"`
 	Kind       string `yaml:"kind" dinghy:"required"`
 
+	// Modules are external plugins, which can be referenced by
+	// name from the generate, mutate and validate sections
+	Modules     []Module         `yaml:"modules"`
 	Resources   []string         `yaml:"resources"`
 	Overlays    []string         `yaml:"overlays"`
 	Generators  []GeneratorSpec  `yaml:"generate"`
 	Mutations   []MutationSpec   `yaml:"mutate"`
 	Validations []ValidationSpec `yaml:"validate"`
+	// Schemas are files with the OpenAPI schemas of custom resources,
+	// either CustomResourceDefinitions or OpenAPI documents. Strategic
+	// merge patches use them to merge custom resources. CRDs in the
+	// build don't need to be listed.
+	Schemas []string `yaml:"schemas"`
 }
 
+// UnmarshalYAML decodes the config, reporting every unknown field with
+// its position in the document. The source node of each plugin spec is
+// kept so that the plugin's config can be decoded and checked when the
+// config is loaded for a build.
 func (c *Config) UnmarshalYAML(value *yaml.Node) error {
-	var in struct {
-		APIVersion string `yaml:"apiVersion"`
-		Kind       string `yaml:"kind"`
-
-		Resources   []string         `yaml:"resources"`
-		Overlays    []string         `yaml:"overlays"`
-		Generators  []GeneratorSpec  `yaml:"generate"`
-		Mutations   []MutationSpec   `yaml:"mutate"`
-		Validations []ValidationSpec `yaml:"validate"`
-	}
-	var m map[string]any
-	if err := value.Decode(&m); err != nil {
-		return err
-	}
-	if err := copyMapToStruct(&in, m); err != nil {
+	// config has the same fields as Config, but not the UnmarshalYAML
+	// method, so it can be decoded without recursing
+	type config Config
+	var in config
+	if err := decode.Node(value, &in, ""); err != nil {
 		return err
 	}
+	*c = Config(in)
 
-	errs := make([]string, 0)
-	for k, gen := range c.Generators {
-		if gen.Uses == "" {
-			errs = append(errs, fmt.Sprintf("generate[%d]: %q is a required field", k, "uses"))
-			continue
-		}
-		if !generate.Has(gen.Uses) {
-			errs = append(errs, fmt.Sprintf("generate[%d]: %q does not exist", k, gen.Uses))
-			continue
-		}
+	for k := range c.Modules {
+		c.Modules[k].Node = decode.SequenceItem(decode.MappingValue(value, "modules"), k)
 	}
-
-	for k, mu := range c.Mutations {
-		if mu.Uses == "" {
-			errs = append(errs, fmt.Sprintf("mutate[%d]: %q is a required field", k, "uses"))
-			continue
-		}
-		if !mutate.Has(mu.Uses) {
-			errs = append(errs, fmt.Sprintf("mutate[%d]: %q does not exist", k, mu.Uses))
-			continue
-		}
+	for k := range c.Generators {
+		c.Generators[k].Node = decode.SequenceItem(decode.MappingValue(value, "generate"), k)
+	}
+	for k := range c.Mutations {
+		c.Mutations[k].Node = decode.SequenceItem(decode.MappingValue(value, "mutate"), k)
+	}
+	for k := range c.Validations {
+		c.Validations[k].Node = decode.SequenceItem(decode.MappingValue(value, "validate"), k)
 	}
-	c.Resources = in.Resources
-	c.Overlays = in.Overlays
-	c.Mutations = in.Mutations
-	c.Generators = in.Generators
 	return nil
 }
 
@@ -187,13 +314,3 @@ func WithResource(path string) ConfigOption {
 		o.AddResource(path)
 	}
 }
-
-func copyMapToStruct(to any, from map[string]any) error {
-	buf := new(bytes.Buffer)
-	if err := yaml.NewEncoder(buf).Encode(from); err != nil {
-		return err
-	}
-	d := yaml.NewDecoder(buf)
-	d.KnownFields(true)
-	return d.Decode(to)
-}
@@ -1 +1,174 @@
 package types
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func TestConfig_UnmarshalYAML(t *testing.T) {
+	data := []byte(`apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resources:
+- deployment.yaml
+generate:
+- uses: builtin.dinghy.dev/template
+  with:
+    source: template
+mutate:
+- uses: builtin.dinghy.dev/metadata/namespace
+  with:
+    name: foo
+validate:
+- uses: builtin.dinghy.dev/requiredLabels
+  with:
+    keys:
+    - team
+`)
+	c := &Config{}
+	qt.Assert(t, yaml.Unmarshal(data, c), qt.IsNil)
+	qt.Assert(t, c.APIVersion, qt.Equals, "dinghy.dev/v1alpha1")
+	qt.Assert(t, c.Kind, qt.Equals, "Config")
+	qt.Assert(t, c.Resources, qt.DeepEquals, []string{"deployment.yaml"})
+	qt.Assert(t, c.Generators, qt.HasLen, 1)
+	qt.Assert(t, c.Mutations, qt.HasLen, 1)
+	qt.Assert(t, c.Validations, qt.HasLen, 1)
+
+	qt.Assert(t, c.Generators[0].Node.Line, qt.Equals, 6)
+	qt.Assert(t, c.Mutations[0].Node.Line, qt.Equals, 10)
+	qt.Assert(t, c.Validations[0].Node.Line, qt.Equals, 14)
+	qt.Assert(t, c.Validations[0].With, qt.DeepEquals, map[string]any{"keys": []any{"team"}})
+}
+
+func TestConfig_UnmarshalYAML_UnknownFields(t *testing.T) {
+	data := []byte(`apiVersion: dinghy.dev/v1alpha1
+kind: Config
+resource:
+- deployment.yaml
+mutate:
+- uses: builtin.dinghy.dev/metadata/namespace
+  selector:
+    kind:
+    - Deployment
+`)
+	err := yaml.Unmarshal(data, &Config{})
+	qt.Assert(t, err, qt.IsNotNil)
+
+	var list *errors.List
+	qt.Assert(t, err, qt.ErrorAs, &list)
+	qt.Assert(t, list.Errors(), qt.HasLen, 2)
+	qt.Assert(t, list.Errors()[0], qt.ErrorMatches, `3:1: resource: unknown field "resource"`)
+	qt.Assert(t, list.Errors()[1], qt.ErrorMatches, `8:5: mutate\[0\].selector.kind: unknown field "kind"`)
+}
+
+func TestResourceSelector_MatchOptions(t *testing.T) {
+	objects := map[string]*resource.Object{
+		"web": resource.Unstructured(map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web", "labels": map[string]any{"tier": "web"}},
+		}),
+		"web-api": resource.Unstructured(map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]any{
+				"name":   "web-api",
+				"labels": map[string]any{"tier": "api", "sidecar.dinghy.dev/skip": "true"},
+			},
+		}),
+		"worker": resource.Unstructured(map[string]any{
+			"apiVersion": "batch/v1",
+			"kind":       "Job",
+			"metadata":   map[string]any{"name": "worker", "annotations": map[string]any{"team": "data"}},
+		}),
+		"reader": resource.Unstructured(map[string]any{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"metadata":   map[string]any{"name": "reader"},
+		}),
+	}
+	tests := map[string]struct {
+		selector string
+		want     []string
+	}{
+		"Glob": {
+			selector: "names: [web-*]",
+			want:     []string{"web-api"},
+		},
+		"GlobCharacterClass": {
+			selector: "names: ['w[!e]rker', 'web?api']",
+			want:     []string{"web-api", "worker"},
+		},
+		"Regexp": {
+			selector: "names: ['/web|worker/']",
+			want:     []string{"web", "worker"},
+		},
+		"MatchExpressions": {
+			selector: `
+matchExpressions:
+- {key: tier, operator: In, values: [web, api]}
+- {key: sidecar.dinghy.dev/skip, operator: DoesNotExist}
+`,
+			want: []string{"web"},
+		},
+		"MatchAnnotations": {
+			selector: "matchAnnotations: {team: data}",
+			want:     []string{"worker"},
+		},
+		"Scope": {
+			selector: "scope: Cluster",
+			want:     []string{"reader"},
+		},
+		"Exclude": {
+			selector: `
+kinds: [apps/Deployment, Job]
+exclude:
+  matchExpressions:
+  - {key: sidecar.dinghy.dev/skip, operator: Exists}
+`,
+			want: []string{"web", "worker"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var s ResourceSelector
+			qt.Assert(t, yaml.Unmarshal([]byte(tt.selector), &s), qt.IsNil)
+			opts, err := s.MatchOptions()
+			qt.Assert(t, err, qt.IsNil)
+			got := make([]string, 0)
+			for _, name := range []string{"reader", "web", "web-api", "worker"} {
+				if objects[name].Matches(opts...) {
+					got = append(got, name)
+				}
+			}
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestResourceSelector_MatchOptions_Errors(t *testing.T) {
+	tests := map[string]struct {
+		selector string
+		err      string
+	}{
+		"Regexp":   {selector: "names: ['/web(/']", err: `names: "/web\(/": error parsing regexp: .*`},
+		"Glob":     {selector: "names: ['web-[']", err: `names: "web-\[": syntax error in pattern`},
+		"Operator": {selector: "matchExpressions: [{key: tier, operator: Equals}]", err: `matchExpressions: .*`},
+		"Values":   {selector: "matchExpressions: [{key: tier, operator: In}]", err: `matchExpressions: .*`},
+		"Kind":     {selector: "kinds: [apps/v1/Deployment/scale]", err: `kinds: .* must be Kind, group/Kind or group/version/Kind`},
+		"Scope":    {selector: "scope: Global", err: `scope: "Global" must be Namespaced or Cluster`},
+		"Exclude":  {selector: "exclude: {scope: Global}", err: `exclude: scope: .*`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var s ResourceSelector
+			qt.Assert(t, yaml.Unmarshal([]byte(tt.selector), &s), qt.IsNil)
+			_, err := s.MatchOptions()
+			qt.Assert(t, err, qt.ErrorMatches, tt.err)
+		})
+	}
+}
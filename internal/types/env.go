@@ -0,0 +1,37 @@
+package types
+
+import (
+	"context"
+
+	"github.com/johnhoman/dinghy/internal/logging"
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// Env is the build a plugin runs in
+type Env struct {
+	// Context is done when the build is cancelled, such as when the
+	// build deadline passes
+	Context context.Context
+	// Logger receives the output of the build
+	Logger *logging.Logger
+	// Tree holds the resources of the build so far
+	Tree resource.Tree
+	// Path is the directory of the dinghyfile that declares the plugin.
+	// It's zero if the config wasn't read from a path.
+	Path path.Path
+	// KubeVersion is the Kubernetes version whose schemas are used to
+	// patch resources, e.g. 1.27. It's empty if the build doesn't set
+	// one, in which case the default version is used.
+	KubeVersion string
+	// Schemas are the schema files of the config, which are read
+	// from Path if they're relative
+	Schemas []string
+}
+
+// EnvAware is implemented by plugins that need the build they run in,
+// such as its context or its tree. The build sets the Env of every
+// plugin in a config before it runs any of them.
+type EnvAware interface {
+	SetEnv(env Env)
+}
@@ -0,0 +1,53 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+var (
+	_ Validator = &ImageTags{}
+)
+
+// ImageTags reports containers that don't pin their image to a tag or
+// digest, or that use one of the disallowed tags, such as latest.
+type ImageTags struct {
+	Disallowed []string `yaml:"disallowed"`
+}
+
+func (i *ImageTags) Name() string {
+	return "builtin.dinghy.dev/imageTags"
+}
+
+func (i *ImageTags) Validate(obj *resource.Object) ([]string, error) {
+	rv := make([]string, 0)
+	for _, c := range obj.Containers() {
+		image, _ := c["image"].(string)
+		if image == "" || strings.Contains(image, "@") {
+			continue
+		}
+		tag := imageTag(image)
+		if tag == "" {
+			rv = append(rv, fmt.Sprintf("container %q image %q has no tag", c["name"], image))
+			continue
+		}
+		for _, d := range i.Disallowed {
+			if tag == d {
+				rv = append(rv, fmt.Sprintf("container %q image %q uses disallowed tag %q", c["name"], image, tag))
+			}
+		}
+	}
+	return rv, nil
+}
+
+// imageTag returns the tag of an image reference. The registry host can
+// contain a port, so only a colon after the last slash starts a tag.
+func imageTag(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if _, tag, ok := strings.Cut(name, ":"); ok {
+		return tag
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package validate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func deployment(images ...string) *resource.Object {
+	containers := make([]any, 0, len(images))
+	for k, image := range images {
+		containers = append(containers, map[string]any{
+			"name":  "c" + string(rune('0'+k)),
+			"image": image,
+		})
+	}
+	return resource.Unstructured(map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web", "namespace": "default"},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{"containers": containers},
+			},
+		},
+	})
+}
+
+func TestImageTags_Validate(t *testing.T) {
+	tests := map[string]struct {
+		disallowed []string
+		obj        *resource.Object
+		want       []string
+	}{
+		"Tagged": {
+			disallowed: []string{"latest"},
+			obj:        deployment("nginx:1.25", "localhost:5000/nginx:1.25"),
+			want:       []string{},
+		},
+		"Digest": {
+			obj:  deployment("nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"),
+			want: []string{},
+		},
+		"Untagged": {
+			obj:  deployment("localhost:5000/nginx"),
+			want: []string{`container "c0" image "localhost:5000/nginx" has no tag`},
+		},
+		"DisallowedTag": {
+			disallowed: []string{"latest"},
+			obj:        deployment("nginx:1.25", "nginx:latest"),
+			want:       []string{`container "c1" image "nginx:latest" uses disallowed tag "latest"`},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := &ImageTags{Disallowed: tt.disallowed}
+			got, err := v.Validate(tt.obj)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestCollect(t *testing.T) {
+	obj := deployment("nginx")
+	report := &errors.ErrValidation{}
+	v := Collect(&RequiredLabels{Keys: []string{"team"}}, report)
+	qt.Assert(t, v.Visit(obj), qt.IsNil)
+	qt.Assert(t, report.Violations, qt.DeepEquals, []errors.Violation{{
+		Validator: "builtin.dinghy.dev/requiredLabels",
+		Resource:  "apps.v1.Deployment/default/web",
+		Message:   `missing required label "team"`,
+	}})
+}
@@ -0,0 +1,50 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+var (
+	_ Validator = &RequiredLabels{}
+	_ Validator = &RequiredAnnotations{}
+)
+
+// RequiredLabels reports resources that are missing any of the
+// provided label keys.
+type RequiredLabels struct {
+	Keys []string `yaml:"keys"`
+}
+
+func (r *RequiredLabels) Name() string {
+	return "builtin.dinghy.dev/requiredLabels"
+}
+
+func (r *RequiredLabels) Validate(obj *resource.Object) ([]string, error) {
+	return missingKeys("label", r.Keys, obj.GetLabels()), nil
+}
+
+// RequiredAnnotations reports resources that are missing any of the
+// provided annotation keys.
+type RequiredAnnotations struct {
+	Keys []string `yaml:"keys"`
+}
+
+func (r *RequiredAnnotations) Name() string {
+	return "builtin.dinghy.dev/requiredAnnotations"
+}
+
+func (r *RequiredAnnotations) Validate(obj *resource.Object) ([]string, error) {
+	return missingKeys("annotation", r.Keys, obj.GetAnnotations()), nil
+}
+
+func missingKeys(kind string, keys []string, m map[string]string) []string {
+	rv := make([]string, 0)
+	for _, key := range keys {
+		if _, ok := m[key]; !ok {
+			rv = append(rv, fmt.Sprintf("missing required %s %q", kind, key))
+		}
+	}
+	return rv
+}
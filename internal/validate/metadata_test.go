@@ -0,0 +1,61 @@
+package validate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func TestRequiredLabels_Validate(t *testing.T) {
+	tests := map[string]struct {
+		keys []string
+		obj  *resource.Object
+		want []string
+	}{
+		"AllLabelsPresent": {
+			keys: []string{"team"},
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]any{
+					"name":   "foo",
+					"labels": map[string]any{"team": "platform"},
+				},
+			}),
+			want: []string{},
+		},
+		"MissingLabels": {
+			keys: []string{"team", "app.kubernetes.io/name"},
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]any{
+					"name":   "foo",
+					"labels": map[string]any{"team": "platform"},
+				},
+			}),
+			want: []string{`missing required label "app.kubernetes.io/name"`},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := &RequiredLabels{Keys: tt.keys}
+			got, err := v.Validate(tt.obj)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
+
+func TestRequiredAnnotations_Validate(t *testing.T) {
+	v := &RequiredAnnotations{Keys: []string{"owner"}}
+	got, err := v.Validate(resource.Unstructured(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "foo"},
+	}))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.DeepEquals, []string{`missing required annotation "owner"`})
+}
@@ -0,0 +1,97 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/johnhoman/dinghy/internal/openapi"
+	"github.com/johnhoman/dinghy/internal/path"
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/types"
+)
+
+var (
+	_ Validator      = &OpenAPI{}
+	_ types.EnvAware = &OpenAPI{}
+)
+
+// OpenAPI reports resources that don't match the Kubernetes OpenAPI
+// schema of their kind, such as unknown fields, fields with the wrong
+// type and missing required fields. Custom resources are validated with
+// the CustomResourceDefinitions in the build and in the CRDs files.
+type OpenAPI struct {
+	// KubeVersion is the Kubernetes version to validate against, e.g.
+	// 1.27. It defaults to openapi.DefaultVersion, and versions without
+	// embedded schemas are an error.
+	KubeVersion string `yaml:"kubeVersion"`
+	// CRDs are files with CustomResourceDefinitions that aren't part of
+	// the build. Relative files are read from the build path.
+	CRDs []string `yaml:"crds"`
+	// Strict reports resources that don't have a schema. By default
+	// they're skipped.
+	Strict bool `yaml:"strict"`
+
+	env     types.Env
+	schemas *openapi.Schemas
+}
+
+func (o *OpenAPI) Name() string {
+	return "builtin.dinghy.dev/openapi"
+}
+
+func (o *OpenAPI) SetEnv(env types.Env) {
+	o.env = env
+}
+
+// load loads the schemas for the Kubernetes version, and adds every
+// CustomResourceDefinition from the tree and the CRD files. It's called
+// before the first resource is validated, since validations run once
+// every resource is in the tree.
+func (o *OpenAPI) load() error {
+	env := o.env
+	schemas, err := openapi.Load(o.KubeVersion)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range o.CRDs {
+		data, err := path.ReadSource(file, env.Path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read crds from %s", file)
+		}
+		if err := schemas.AddFile(data); err != nil {
+			return errors.Wrapf(err, "failed to read crds from %s", file)
+		}
+	}
+	if env.Tree != nil {
+		if err := schemas.AddCRDs(env.Tree); err != nil {
+			return err
+		}
+	}
+	o.schemas = schemas
+	return nil
+}
+
+func (o *OpenAPI) Validate(obj *resource.Object) ([]string, error) {
+	if o.schemas == nil {
+		if err := o.load(); err != nil {
+			return nil, errors.Wrapf(err, "failed to load schemas for %s", o.Name())
+		}
+	}
+	violations, err := o.schemas.Validate(obj)
+	if errors.Is(err, openapi.ErrUnknownKind) {
+		if o.Strict {
+			return []string{fmt.Sprintf("no schema for %s %s in kubernetes %s", obj.GetAPIVersion(), obj.GetKind(), o.schemas.Version())}, nil
+		}
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]string, 0, len(violations))
+	for _, v := range violations {
+		rv = append(rv, v.String())
+	}
+	return rv, nil
+}
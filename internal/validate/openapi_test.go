@@ -0,0 +1,90 @@
+package validate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+func TestOpenAPI_Validate(t *testing.T) {
+	widget := resource.Unstructured(map[string]any{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]any{"name": "foo"},
+	})
+	tests := map[string]struct {
+		validator *OpenAPI
+		obj       *resource.Object
+		want      []string
+	}{
+		"Valid": {
+			validator: &OpenAPI{},
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"name": "foo"},
+				"data":       map[string]any{"key": "value"},
+			}),
+			want: []string{},
+		},
+		"Invalid": {
+			validator: &OpenAPI{KubeVersion: "1.21"},
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"name": "foo"},
+				"data":       []any{"value"},
+				"spec":       map[string]any{},
+			}),
+			want: []string{
+				"data: expected an object, got an array",
+				`spec: unknown field "spec"`,
+			},
+		},
+		"Required": {
+			validator: &OpenAPI{KubeVersion: "1.27"},
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]any{"name": "foo"},
+				"spec": map[string]any{
+					"template": map[string]any{
+						"spec": map[string]any{
+							"containers": []any{map[string]any{"name": "foo", "image": "foo"}},
+						},
+					},
+				},
+			}),
+			want: []string{"spec.selector: required field is missing"},
+		},
+		"Enum": {
+			validator: &OpenAPI{KubeVersion: "1.27"},
+			obj: resource.Unstructured(map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata":   map[string]any{"name": "foo"},
+				"spec":       map[string]any{"type": "Foo"},
+			}),
+			want: []string{`spec.type: unsupported value Foo, expected one of ["ClusterIP", "ExternalName", "LoadBalancer", "NodePort"]`},
+		},
+		"UnknownKind": {
+			validator: &OpenAPI{},
+			obj:       widget,
+			want:      []string{},
+		},
+		"UnknownKindStrict": {
+			validator: &OpenAPI{KubeVersion: "1.27", Strict: true},
+			obj:       widget,
+			want:      []string{"no schema for example.com/v1 Widget in kubernetes 1.27"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tt.validator.Validate(tt.obj)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+}
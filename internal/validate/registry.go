@@ -0,0 +1,43 @@
+package validate
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/johnhoman/dinghy/internal/registry"
+)
+
+var (
+	ErrNotFound = errors.New("validator not found")
+)
+
+// Registry maps names to validators. Registries are values, so that
+// builds in the same process can use different sets of validators.
+type Registry = registry.Registry[Validator]
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return registry.New[Validator](ErrNotFound)
+}
+
+// Default returns a copy of the registry of builtin validators, which
+// can be extended without changing the builtins
+func Default() *Registry {
+	return builtins.Clone()
+}
+
+// builtins are the validators that are always available
+var builtins = NewRegistry()
+
+// RegisterBuiltin adds a Validator to the builtins, so that every registry
+// returned by Default after it's called has the Validator
+func RegisterBuiltin(v Validator) {
+	builtins.Register(v)
+}
+
+func init() {
+	builtins.Register(&RequiredLabels{})
+	builtins.Register(&RequiredAnnotations{})
+	builtins.Register(&ImageTags{})
+	builtins.Register(&OpenAPI{})
+	builtins.Register(&Script{})
+}
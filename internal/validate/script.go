@@ -0,0 +1,68 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johnhoman/dinghy/internal/resource"
+	"github.com/johnhoman/dinghy/internal/script"
+)
+
+var (
+	_ Validator        = &Script{}
+	_ yaml.Unmarshaler = &Script{}
+	_ script.HostAware = &Script{}
+	_ script.Loader    = &Script{}
+)
+
+// Script validates resources with javascript. The script MUST define a
+// function `validate` with the signature validate(obj, config), which
+// returns an array of violation messages for the resource. Returning
+// nothing, or an empty array, means the resource is valid.
+type Script struct {
+	script.Plugin
+}
+
+// NewScript returns a Script that runs the provided source, such as
+// a script loaded from a module. The Script is registered under name,
+// and the `with` config is passed to the validate function as is.
+func NewScript(name, source string, opts ...script.Option) *Script {
+	return &Script{Plugin: script.NewPlugin(name, source, opts...)}
+}
+
+func (s *Script) UnmarshalYAML(value *yaml.Node) error {
+	return s.Decode(value, "validate")
+}
+
+func (s *Script) JSONSchema() *jsonschema.Schema {
+	return s.Schema("validate")
+}
+
+func (s *Script) Load() error {
+	return s.Compile("validate")
+}
+
+func (s *Script) Validate(obj *resource.Object) ([]string, error) {
+	v, err := s.Call("validate", obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]string, 0)
+	if script.IsNullish(v) {
+		return rv, nil
+	}
+	switch messages := v.Export().(type) {
+	case string:
+		rv = append(rv, messages)
+	case []any:
+		for _, msg := range messages {
+			rv = append(rv, fmt.Sprint(msg))
+		}
+	default:
+		return nil, errors.Errorf("validate must return an array of messages, got %s", v.ExportType())
+	}
+	return rv, nil
+}
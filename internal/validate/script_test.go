@@ -0,0 +1,45 @@
+package validate
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestScript_Validate(t *testing.T) {
+	s := &Script{}
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+script: |
+  function validate(obj, config) {
+    const replicas = obj.spec.replicas || 1
+    if (replicas < config.minReplicas) {
+      return ["expected at least " + config.minReplicas + " replicas, got " + replicas]
+    }
+  }
+config:
+  minReplicas: 2
+`), s), qt.IsNil)
+
+	obj := deployment("nginx:1.25")
+	got, err := s.Validate(obj)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.DeepEquals, []string{"expected at least 2 replicas, got 1"})
+
+	obj.Object["spec"].(map[string]any)["replicas"] = 3
+	got, err = s.Validate(obj)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got, qt.DeepEquals, []string{})
+}
+
+func TestScript_Validate_InvalidResult(t *testing.T) {
+	s := &Script{}
+	qt.Assert(t, yaml.Unmarshal([]byte(`
+script: |
+  function validate(obj, config) {
+    return 1
+  }
+`), s), qt.IsNil)
+	_, err := s.Validate(deployment("nginx:1.25"))
+	qt.Assert(t, err, qt.ErrorMatches, `validate must return an array of messages, got int64`)
+}
@@ -0,0 +1,34 @@
+package validate
+
+import (
+	"github.com/johnhoman/dinghy/internal/errors"
+	"github.com/johnhoman/dinghy/internal/resource"
+)
+
+// Validator inspects resources in the tree and reports any rules
+// the resource violates. Validators must not mutate the resource.
+type Validator interface {
+	// Validate returns a message for each rule the resource violates. An
+	// error should only be returned if the validator couldn't run.
+	Validate(obj *resource.Object) ([]string, error)
+	Name() string
+}
+
+// Collect returns a visitor that runs the validator on a copy of each
+// visited resource and appends any violations to the report.
+func Collect(v Validator, report *errors.ErrValidation) resource.Visitor {
+	return resource.VisitorFunc(func(obj *resource.Object) error {
+		messages, err := v.Validate(obj.Copy())
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			report.Append(errors.Violation{
+				Validator: v.Name(),
+				Resource:  resource.ParseKey(obj).String(),
+				Message:   msg,
+			})
+		}
+		return nil
+	})
+}